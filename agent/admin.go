@@ -0,0 +1,303 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"flashcat.cloud/categraf/inputs"
+	"flashcat.cloud/categraf/pkg/health"
+	"flashcat.cloud/categraf/types"
+)
+
+var (
+	ErrMetricsAgentDisabled = errors.New("metrics agent is not running")
+	ErrInputNotFound        = errors.New("input not found")
+)
+
+// InputStatus is the state of a running input
+type InputStatus struct {
+	Name     string `json:"name"`
+	Provider string `json:"provider"`
+	Checksum string `json:"checksum"`
+	Interval string `json:"interval"`
+	*health.Snapshot
+	Instances []InstanceStatus `json:"instances,omitempty"`
+}
+
+type InstanceStatus struct {
+	Index       int               `json:"index"`
+	Initialized bool              `json:"initialized"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	*health.Snapshot
+}
+
+func (a *Agent) metricsAgent() *MetricsAgent {
+	for _, ag := range a.agents {
+		if ma, ok := ag.(*MetricsAgent); ok {
+			return ma
+		}
+	}
+	return nil
+}
+
+// Inputs returns the state of every running input
+func (a *Agent) Inputs() ([]InputStatus, error) {
+	ma := a.metricsAgent()
+	if ma == nil {
+		return nil, ErrMetricsAgentDisabled
+	}
+
+	ma.InputReaders.lock.RLock()
+	defer ma.InputReaders.lock.RUnlock()
+
+	ret := make([]InputStatus, 0, len(ma.InputReaders.record))
+	for name, readers := range ma.InputReaders.record {
+		provider, _ := inputs.ParseInputName(name)
+		for sum, r := range readers {
+			status := InputStatus{
+				Name:     name,
+				Provider: provider,
+				Checksum: sum,
+				Interval: r.interval().String(),
+			}
+			status.Snapshot = snapshot(r.stat(r.input))
+			for i, ins := range inputs.MayGetInstances(r.input) {
+				is := InstanceStatus{
+					Index:       i,
+					Initialized: ins.Initialized(),
+					Labels:      ins.GetLabels(),
+				}
+				is.Snapshot = snapshot(r.stat(ins))
+				status.Instances = append(status.Instances, is)
+			}
+			ret = append(ret, status)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Name == ret[j].Name {
+			return ret[i].Checksum < ret[j].Checksum
+		}
+		return ret[i].Name < ret[j].Name
+	})
+	return ret, nil
+}
+
+// ReloadInput reloads the configuration of an input, name is <provider>.<input>
+// or only <input> which matches the input of any provider. the reload lock of
+// the provider is held so that it does not interleave with its reloader
+func (a *Agent) ReloadInput(name string) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	ma := a.metricsAgent()
+	if ma == nil {
+		return ErrMetricsAgentDisabled
+	}
+
+	found := false
+	for _, p := range ma.matchProviders(name) {
+		ok, err := ma.reloadInput(p, name)
+		if err != nil {
+			return err
+		}
+		found = found || ok
+	}
+	if !found {
+		return ErrInputNotFound
+	}
+	log.Println("I! input:", name, "reloaded")
+	return nil
+}
+
+// reloadInput reloads an input of the provider, it returns false if the input
+// is neither configured nor running
+func (ma *MetricsAgent) reloadInput(p inputs.Provider, name string) (bool, error) {
+	lock := inputs.ReloadLock(p.Name())
+	lock.Lock()
+	defer lock.Unlock()
+
+	_, inputKey := inputs.ParseInputName(name)
+	if !strings.Contains(name, ".") {
+		inputKey = name
+	}
+	fullName := inputs.FormatInputName(p.Name(), inputKey)
+
+	changed, err := p.LoadConfig()
+	if err != nil {
+		return false, err
+	}
+	if changed {
+		// changes of other inputs are taken by the load as well, so all
+		// inputs of the provider are reloaded to not miss them
+		return ma.reloadProvider(p, inputKey)
+	}
+
+	configs, err := p.GetInputConfig(inputKey)
+	if err != nil {
+		return false, err
+	}
+	_, running := ma.InputReaders.GetInput(fullName)
+	if len(configs) == 0 {
+		if running {
+			ma.DeregisterInput(fullName, "")
+		}
+		return running, nil
+	}
+	if running {
+		return true, ma.ReplaceInput(fullName, configs)
+	}
+	ma.RegisterInput(fullName, configs)
+	return true, nil
+}
+
+// reloadProvider restarts all inputs of the provider, the caller holds the
+// reload lock. it reports whether inputKey is configured or was running
+func (ma *MetricsAgent) reloadProvider(p inputs.Provider, inputKey string) (bool, error) {
+	names, err := p.GetInputs()
+	if err != nil {
+		return false, err
+	}
+	prefix := p.Name() + "."
+	_, found := ma.InputReaders.GetInput(prefix + inputKey)
+	var running []string
+	ma.InputReaders.lock.RLock()
+	for name := range ma.InputReaders.record {
+		if strings.HasPrefix(name, prefix) {
+			running = append(running, name)
+		}
+	}
+	ma.InputReaders.lock.RUnlock()
+	for _, name := range running {
+		ma.DeregisterInput(name, "")
+	}
+	for _, name := range names {
+		configs, err := p.GetInputConfig(name)
+		if err != nil {
+			log.Println("E! failed to get configuration of plugin:", name, "error:", err)
+			continue
+		}
+		if name == inputKey && len(configs) > 0 {
+			found = true
+		}
+		ma.RegisterInput(inputs.FormatInputName(p.Name(), name), configs)
+	}
+	return found, nil
+}
+
+// GatherInput gathers an input once with a new copy of its configuration,
+// so that the running one is not disturbed, and returns the samples
+func (a *Agent) GatherInput(name string) ([]*types.Sample, error) {
+	ma := a.metricsAgent()
+	if ma == nil {
+		return nil, ErrMetricsAgentDisabled
+	}
+
+	for _, p := range ma.matchProviders(name) {
+		inputKey := name
+		if strings.Contains(name, ".") {
+			_, inputKey = inputs.ParseInputName(name)
+		}
+		creator, has := inputs.InputCreators[inputKey]
+		if !has {
+			return nil, fmt.Errorf("input %s not supported", inputKey)
+		}
+		if _, ok := creator().(inputs.ServiceInput); ok {
+			return nil, fmt.Errorf("service input %s can not be gathered once", inputKey)
+		}
+		configs, err := p.GetInputConfig(inputKey)
+		if err != nil {
+			return nil, err
+		}
+		if len(configs) == 0 {
+			continue
+		}
+		ins, err := p.LoadInputConfig(configs, creator())
+		if err != nil {
+			return nil, err
+		}
+
+		var samples []*types.Sample
+		for _, in := range ins {
+			ss, err := gatherInputOnce(in)
+			if err != nil {
+				return nil, err
+			}
+			samples = append(samples, ss...)
+		}
+		return samples, nil
+	}
+	return nil, ErrInputNotFound
+}
+
+func snapshot(s *health.Stat) *health.Snapshot {
+	if s == nil {
+		return nil
+	}
+	ss := s.Snapshot()
+	return &ss
+}
+
+// matchProviders returns the provider of <provider>.<input> or all providers
+func (ma *MetricsAgent) matchProviders(name string) []inputs.Provider {
+	if !strings.Contains(name, ".") {
+		return ma.InputProviders
+	}
+	provider, _ := inputs.ParseInputName(name)
+	for _, p := range ma.InputProviders {
+		if p.Name() == provider {
+			return []inputs.Provider{p}
+		}
+	}
+	return nil
+}
+
+func gatherInputOnce(input inputs.Input) (samples []*types.Sample, err error) {
+	defer func() {
+		if rc := recover(); rc != nil {
+			err = fmt.Errorf("gather panic: %v", rc)
+		}
+	}()
+
+	if err = input.InitInternalConfig(); err != nil {
+		return nil, err
+	}
+	if err = inputs.MayInit(input); err != nil && !errors.Is(err, types.ErrInstancesEmpty) {
+		return nil, err
+	}
+	defer inputs.MayDrop(input)
+
+	slist := types.NewSampleList()
+	if err = inputs.MayGather(input, slist); err != nil {
+		return nil, err
+	}
+	samples = append(samples, popAll(input.Process(slist))...)
+
+	for _, ins := range inputs.MayGetInstances(input) {
+		if err = ins.InitInternalConfig(); err != nil {
+			return nil, err
+		}
+		if err = inputs.MayInit(ins); err != nil {
+			if errors.Is(err, types.ErrInstancesEmpty) {
+				continue
+			}
+			return nil, err
+		}
+		ins.SetInitialized()
+		insList := types.NewSampleList()
+		if err = inputs.MayGather(ins, insList); err != nil {
+			return nil, err
+		}
+		samples = append(samples, popAll(ins.Process(insList))...)
+	}
+	return samples, nil
+}
+
+func popAll(slist *types.SampleList) []*types.Sample {
+	if slist == nil {
+		return nil
+	}
+	return slist.PopBackAll()
+}
@@ -0,0 +1,198 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/inputs"
+	"flashcat.cloud/categraf/pkg/cfg"
+	"flashcat.cloud/categraf/types"
+)
+
+const adminTestInput = "admin_test"
+
+type adminTestPlugin struct {
+	config.PluginConfig
+	Value float64 `toml:"value"`
+}
+
+func (p *adminTestPlugin) Clone() inputs.Input { return &adminTestPlugin{} }
+func (p *adminTestPlugin) Name() string        { return adminTestInput }
+func (p *adminTestPlugin) Init() error {
+	if p.Value < 0 {
+		return errors.New("negative value")
+	}
+	return nil
+}
+func (p *adminTestPlugin) Gather(slist *types.SampleList) {
+	slist.PushSample(adminTestInput, "value", p.Value)
+}
+
+func init() {
+	inputs.Add(adminTestInput, func() inputs.Input { return &adminTestPlugin{} })
+}
+
+// memProvider serves configs from memory
+type memProvider struct {
+	sync.RWMutex
+	configs map[string]string
+}
+
+func (p *memProvider) Name() string              { return "mem" }
+func (p *memProvider) StartReloader()            {}
+func (p *memProvider) StopReloader()             {}
+func (p *memProvider) LoadConfig() (bool, error) { return false, nil }
+
+func (p *memProvider) GetInputs() ([]string, error) {
+	p.RLock()
+	defer p.RUnlock()
+	var names []string
+	for name := range p.configs {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (p *memProvider) GetInputConfig(inputKey string) ([]cfg.ConfigWithFormat, error) {
+	p.RLock()
+	defer p.RUnlock()
+	c, has := p.configs[inputKey]
+	if !has {
+		return nil, nil
+	}
+	return []cfg.ConfigWithFormat{{Config: c, Format: cfg.TomlFormat}}, nil
+}
+
+func (p *memProvider) LoadInputConfig(configs []cfg.ConfigWithFormat, input inputs.Input) (map[string]inputs.Input, error) {
+	if err := cfg.LoadConfigs(configs, input); err != nil {
+		return nil, err
+	}
+	return map[string]inputs.Input{configs[0].Config: input}, nil
+}
+
+func (p *memProvider) set(inputKey, c string) {
+	p.Lock()
+	p.configs[inputKey] = c
+	p.Unlock()
+}
+
+// readers of earlier tests may still read the config, so it is set once
+var adminTestConfig sync.Once
+
+func newAdminTestAgent(t *testing.T) (*Agent, *memProvider) {
+	adminTestConfig.Do(func() {
+		config.Config = &config.ConfigType{TestMode: true}
+		config.Config.Global.Interval = config.Duration(3600e9)
+		config.Config.Global.OmitHostname = true
+	})
+
+	p := &memProvider{configs: map[string]string{adminTestInput: "value = 1"}}
+	ma := &MetricsAgent{InputReaders: NewReaders(), InputProviders: []inputs.Provider{p}}
+	if err := ma.start(0); err != nil {
+		t.Fatal(err)
+	}
+	// later tests may replace config.Config, Stop waits for the readers
+	t.Cleanup(func() { ma.Stop() })
+	return &Agent{agents: []AgentModule{ma}}, p
+}
+
+func TestAdminInputs(t *testing.T) {
+	ag, _ := newAdminTestAgent(t)
+
+	list, err := ag.Inputs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Name != "mem."+adminTestInput || list[0].Provider != "mem" || list[0].Checksum != "value = 1" {
+		t.Fatalf("unexpected inputs: %+v", list)
+	}
+
+	if _, err = (&Agent{}).Inputs(); !errors.Is(err, ErrMetricsAgentDisabled) {
+		t.Fatalf("expected %v, got %v", ErrMetricsAgentDisabled, err)
+	}
+}
+
+func TestAdminReloadInput(t *testing.T) {
+	ag, p := newAdminTestAgent(t)
+
+	p.set(adminTestInput, "value = 2")
+	for _, name := range []string{adminTestInput, "mem." + adminTestInput} {
+		if err := ag.ReloadInput(name); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		list, _ := ag.Inputs()
+		if len(list) != 1 || list[0].Checksum != "value = 2" {
+			t.Fatalf("%s: expected the new config running, got %+v", name, list)
+		}
+	}
+
+	if err := ag.ReloadInput("mysql"); !errors.Is(err, ErrInputNotFound) {
+		t.Fatalf("expected %v, got %v", ErrInputNotFound, err)
+	}
+	if err := ag.ReloadInput("other." + adminTestInput); !errors.Is(err, ErrInputNotFound) {
+		t.Fatalf("expected %v of unknown provider, got %v", ErrInputNotFound, err)
+	}
+
+	// a removed config stops the input
+	p.Lock()
+	delete(p.configs, adminTestInput)
+	p.Unlock()
+	if err := ag.ReloadInput(adminTestInput); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := ag.Inputs(); len(list) != 0 {
+		t.Fatalf("expected the input stopped, got %+v", list)
+	}
+}
+
+func TestReplaceInput(t *testing.T) {
+	ag, p := newAdminTestAgent(t)
+	ma := ag.metricsAgent()
+	name := "mem." + adminTestInput
+
+	// decoded but failed to init, the running one is kept
+	p.set(adminTestInput, "value = -1")
+	configs, _ := p.GetInputConfig(adminTestInput)
+	if err := ma.ReplaceInput(name, configs); err == nil {
+		t.Fatal("expected an error of init")
+	}
+	if err := ag.ReloadInput(adminTestInput); err == nil {
+		t.Fatal("expected an error of init")
+	}
+	if list, _ := ag.Inputs(); len(list) != 1 || list[0].Checksum != "value = 1" {
+		t.Fatalf("expected the running input kept, got %+v", list)
+	}
+
+	p.set(adminTestInput, "value = 4")
+	configs, _ = p.GetInputConfig(adminTestInput)
+	if err := ma.ReplaceInput(name, configs); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := ag.Inputs(); len(list) != 1 || list[0].Checksum != "value = 4" {
+		t.Fatalf("expected the new input running, got %+v", list)
+	}
+}
+
+func TestAdminGatherInput(t *testing.T) {
+	ag, p := newAdminTestAgent(t)
+
+	p.set(adminTestInput, "value = 3")
+	samples, err := ag.GatherInput(adminTestInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 1 || samples[0].Metric != adminTestInput+"_value" || fmt.Sprint(samples[0].Value) != "3" {
+		t.Fatalf("unexpected samples: %+v", samples)
+	}
+	// the running input is not disturbed
+	if list, _ := ag.Inputs(); len(list) != 1 || list[0].Checksum != "value = 1" {
+		t.Fatalf("unexpected inputs: %+v", list)
+	}
+
+	if _, err = ag.GatherInput("nonexistent_input"); err == nil {
+		t.Fatal("expected an error of unsupported input")
+	}
+}
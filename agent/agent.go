@@ -3,10 +3,13 @@ package agent
 import (
 	"errors"
 	"log"
+	"sync"
 )
 
 type Agent struct {
 	agents []AgentModule
+	// serializes reloads of signals and admin apis
+	lock sync.Mutex
 }
 
 // AgentModule is the interface for agent modules
@@ -65,6 +68,8 @@ func (a *Agent) Stop() {
 }
 
 func (a *Agent) Reload() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
 	log.Println("I! agent reloading")
 	a.Stop()
 	a.Start()
@@ -0,0 +1,181 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/inputs"
+	"flashcat.cloud/categraf/pkg/cfg"
+)
+
+// CheckResult is the check report of a config file
+type CheckResult struct {
+	File     string   `json:"file"`
+	Input    string   `json:"input,omitempty"`
+	Errors   []string `json:"errors,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+func (r *CheckResult) errorf(format string, a ...interface{}) {
+	r.Errors = append(r.Errors, fmt.Sprintf(format, a...))
+}
+
+// CheckConfig loads config.toml and every input config without starting
+// anything or contacting the targets
+func CheckConfig(configDir string) []CheckResult {
+	results := []CheckResult{checkMainConfig(configDir)}
+
+	dirs, err := filepath.Glob(filepath.Join(configDir, "input.*"))
+	if err != nil {
+		return results
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		inputKey := strings.TrimPrefix(filepath.Base(dir), "input.")
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			results = append(results, CheckResult{File: dir, Input: inputKey, Errors: []string{err.Error()}})
+			continue
+		}
+		for _, f := range files {
+			if f.IsDir() || !isConfigFile(f.Name()) {
+				continue
+			}
+			results = append(results, checkInputConfig(filepath.Join(dir, f.Name()), inputKey))
+		}
+	}
+	return results
+}
+
+func isConfigFile(name string) bool {
+	switch filepath.Ext(name) {
+	case ".toml", ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+func checkMainConfig(configDir string) CheckResult {
+	file := filepath.Join(configDir, "config.toml")
+	ret := CheckResult{File: file}
+
+	err := config.InitConfig(configDir, 0, false, false, 0, "")
+	if err != nil {
+		ret.errorf("%v", err)
+		// inputs are checked with an empty config
+		config.Config = &config.ConfigType{ConfigDir: configDir}
+	}
+
+	bs, err := os.ReadFile(file)
+	if err != nil {
+		return ret
+	}
+	unknown, err := cfg.UnknownKeys(cfg.ConfigWithFormat{Config: string(bs), Format: cfg.TomlFormat}, &config.ConfigType{})
+	if err == nil {
+		for _, key := range unknown {
+			ret.errorf("unknown key %s", key)
+		}
+	}
+	return ret
+}
+
+func checkInputConfig(file, inputKey string) (ret CheckResult) {
+	ret = CheckResult{File: file, Input: inputKey}
+	defer func() {
+		if rc := recover(); rc != nil {
+			ret.errorf("panic: %v", rc)
+		}
+	}()
+
+	creator, has := inputs.InputCreators[inputKey]
+	if !has {
+		ret.Warnings = append(ret.Warnings, fmt.Sprintf("input %s is not supported by this build", inputKey))
+		return
+	}
+	bs, err := os.ReadFile(file)
+	if err != nil {
+		ret.errorf("%v", err)
+		return
+	}
+	c := cfg.ConfigWithFormat{Config: string(bs), Format: cfg.GuessFormat(file)}
+
+	unknown, err := cfg.UnknownKeys(c, creator())
+	if err != nil {
+		ret.errorf("%v", err)
+		return
+	}
+	for _, key := range unknown {
+		ret.errorf("unknown key %s", key)
+	}
+
+	input := creator()
+	if err = cfg.LoadConfigs([]cfg.ConfigWithFormat{c}, input); err != nil {
+		ret.errorf("%v", err)
+		return
+	}
+	if err = config.ResolveSecrets(input); err != nil {
+		ret.errorf("%v", err)
+	}
+	if err = input.InitInternalConfig(); err != nil {
+		ret.errorf("%v", err)
+	}
+	for i, ins := range inputs.MayGetInstances(input) {
+		if err = ins.InitInternalConfig(); err != nil {
+			ret.errorf("instances[%d]: %v", i, err)
+		}
+	}
+	return
+}
+
+// PrintCheckResults prints the report and returns the number of errors
+func PrintCheckResults(w io.Writer, results []CheckResult) int {
+	errs := 0
+	for _, r := range results {
+		name := r.File
+		if r.Input != "" {
+			name = fmt.Sprintf("%s [%s]", r.File, r.Input)
+		}
+		if len(r.Errors) == 0 && len(r.Warnings) == 0 {
+			fmt.Fprintln(w, "OK  ", name)
+			continue
+		}
+		if len(r.Errors) > 0 {
+			fmt.Fprintln(w, "FAIL", name)
+		} else {
+			fmt.Fprintln(w, "WARN", name)
+		}
+		for _, e := range r.Errors {
+			fmt.Fprintln(w, "    error:", e)
+		}
+		for _, e := range r.Warnings {
+			fmt.Fprintln(w, "    warning:", e)
+		}
+		errs += len(r.Errors)
+	}
+	fmt.Fprintf(w, "%d files checked, %d errors\n", len(results), errs)
+	return errs
+}
+
+// PrintCheckResultsJSON prints the report as json and returns the number of errors
+func PrintCheckResultsJSON(w io.Writer, results []CheckResult) int {
+	errs := 0
+	for _, r := range results {
+		errs += len(r.Errors)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(struct {
+		Results []CheckResult `json:"results"`
+		Errors  int           `json:"errors"`
+	}{results, errs})
+	return errs
+}
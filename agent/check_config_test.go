@@ -0,0 +1,64 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"flashcat.cloud/categraf/config"
+)
+
+func TestCheckConfig(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.toml":            "[global]\ninterval = 15\n",
+		"input.mem/mem.toml":     "collect_platform_fields = true\nunknown_option = 1\n",
+		"input.cpu/cpu.toml":     "[[relabel_configs]]\nsource_labels = [\"cpu\"]\nregex = \"([\"\ntarget_label = \"core\"\n",
+		"input.not_exist/a.toml": "value = 1\n",
+	}
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	old := config.Config
+	defer func() { config.Config = old }()
+	results := CheckConfig(dir)
+
+	var text bytes.Buffer
+	if errs := PrintCheckResults(&text, results); errs != 2 {
+		t.Fatalf("expected 2 errors, got %d:\n%s", errs, text.String())
+	}
+
+	var out bytes.Buffer
+	PrintCheckResultsJSON(&out, results)
+	var report struct {
+		Results []CheckResult `json:"results"`
+		Errors  int           `json:"errors"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Errors != 2 || len(report.Results) != 4 {
+		t.Fatalf("unexpected report: %s", out.String())
+	}
+	for _, r := range report.Results {
+		switch r.Input {
+		case "mem", "cpu":
+			if len(r.Errors) != 1 {
+				t.Fatalf("expected an error of %s, got %+v", r.Input, r)
+			}
+		case "not_exist":
+			if len(r.Errors) != 0 || len(r.Warnings) != 1 {
+				t.Fatalf("expected a warning of unsupported input, got %+v", r)
+			}
+		}
+	}
+}
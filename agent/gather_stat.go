@@ -0,0 +1,71 @@
+package agent
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"flashcat.cloud/categraf/inputs"
+	"flashcat.cloud/categraf/pkg/health"
+	"flashcat.cloud/categraf/types"
+)
+
+// initStats registers the gather health of the plugin, or of every instance
+// if the input has instances, the plugin level gathers nothing for them
+func (r *InputReader) initStats() {
+	r.statsLock.Lock()
+	defer r.statsLock.Unlock()
+
+	instances := inputs.MayGetInstances(r.input)
+	if len(instances) == 0 {
+		r.stats[r.input] = health.Register(r.inputName, "")
+		return
+	}
+	for i, ins := range instances {
+		if !ins.Initialized() {
+			continue
+		}
+		r.stats[ins] = health.Register(r.inputName, strconv.Itoa(i))
+	}
+}
+
+func (r *InputReader) stat(owner interface{}) *health.Stat {
+	r.statsLock.Lock()
+	defer r.statsLock.Unlock()
+	return r.stats[owner]
+}
+
+// gathered records a finished gather of the owner, samples of a gather which
+// returned an error are still forwarded
+func (r *InputReader) gathered(owner interface{}, start time.Time, slist *types.SampleList, err error) {
+	if err != nil {
+		log.Println("E!", r.inputName, ": gather error:", err)
+	}
+	s := r.stat(owner)
+	if s == nil {
+		return
+	}
+	if err != nil {
+		s.Failed(start, sampleCount(slist), err)
+		return
+	}
+	s.Gathered(start, sampleCount(slist))
+}
+
+// skip records skipped runs on every stat of the reader
+func (r *InputReader) skip(n uint64) {
+	r.statsLock.Lock()
+	defer r.statsLock.Unlock()
+	for _, s := range r.stats {
+		s.Skip(n)
+	}
+}
+
+func (r *InputReader) dropStats() {
+	r.statsLock.Lock()
+	defer r.statsLock.Unlock()
+	for owner, s := range r.stats {
+		health.Unregister(s)
+		delete(r.stats, owner)
+	}
+}
@@ -0,0 +1,86 @@
+package agent
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"flashcat.cloud/categraf/inputs"
+	"flashcat.cloud/categraf/types"
+)
+
+type gatherTimeouted interface {
+	GetGatherTimeout() time.Duration
+}
+
+// gatherTimeout returns gather_timeout of the owner, instances without one
+// use the timeout of the plugin
+func (r *InputReader) gatherTimeout(owner interface{}) time.Duration {
+	if gt, ok := owner.(gatherTimeouted); ok && gt.GetGatherTimeout() > 0 {
+		return gt.GetGatherTimeout()
+	}
+	if gt, ok := r.input.(gatherTimeouted); ok {
+		return gt.GetGatherTimeout()
+	}
+	return 0
+}
+
+type gatherResult struct {
+	slist *types.SampleList
+	err   error
+	panic interface{}
+}
+
+// gather gathers the plugin or an instance. with gather_timeout the gather is
+// abandoned after the timeout and its context is canceled, ok is false if the
+// gather timed out or the abandoned one of last run is still running, err is
+// the error returned by the gatherer
+func (r *InputReader) gather(owner interface{}, start time.Time) (slist *types.SampleList, ok bool, err error) {
+	timeout := r.gatherTimeout(owner)
+	_, gatherer := owner.(inputs.SampleGatherer)
+	_, ctxGatherer := owner.(inputs.ContextGatherer)
+	if timeout <= 0 || !(gatherer || ctxGatherer) {
+		slist = types.NewSampleList()
+		err = inputs.MayGather(owner, slist)
+		return slist, true, err
+	}
+
+	running, _ := r.running.LoadOrStore(owner, new(atomic.Bool))
+	if !running.(*atomic.Bool).CompareAndSwap(false, true) {
+		log.Println("W!", r.inputName, ": last gather is still running, skip this run")
+		if s := r.stat(owner); s != nil {
+			s.Skip(1)
+		}
+		return nil, false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	done := make(chan gatherResult, 1)
+	go func() {
+		ret := gatherResult{slist: types.NewSampleList()}
+		defer func() {
+			ret.panic = recover()
+			running.(*atomic.Bool).Store(false)
+			done <- ret
+		}()
+		ret.err = inputs.MayGatherContext(ctx, owner, ret.slist)
+	}()
+
+	select {
+	case ret := <-done:
+		if ret.panic != nil {
+			// recovered by the caller
+			panic(ret.panic)
+		}
+		return ret.slist, true, ret.err
+	case <-ctx.Done():
+		log.Println("W!", r.inputName, ": gather timeout after", timeout, ", samples of this run are dropped")
+		if s := r.stat(owner); s != nil {
+			s.TimedOut(start, timeout)
+		}
+		return nil, false, nil
+	}
+}
@@ -0,0 +1,94 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"flashcat.cloud/categraf/pkg/health"
+	"flashcat.cloud/categraf/types"
+)
+
+// blockingGatherer ignores ctx and blocks until released
+type blockingGatherer struct {
+	release chan struct{}
+	runs    atomic.Int32
+}
+
+func (g *blockingGatherer) GetGatherTimeout() time.Duration { return 50 * time.Millisecond }
+
+func (g *blockingGatherer) GatherContext(ctx context.Context, slist *types.SampleList) {
+	<-g.release
+	slist.PushSample("blocking", "run", float64(g.runs.Add(1)))
+}
+
+func TestGatherTimeout(t *testing.T) {
+	g := &blockingGatherer{release: make(chan struct{})}
+	stat := health.Register("blocking", "")
+	defer health.Unregister(stat)
+	r := &InputReader{inputName: "blocking", stats: map[interface{}]*health.Stat{g: stat}}
+
+	if slist, ok, _ := r.gather(g, time.Now()); ok || slist != nil {
+		t.Fatalf("expected gather timed out, got %v %v", ok, slist)
+	}
+	if s := stat.Snapshot(); s.Timeouts != 1 {
+		t.Fatalf("expected 1 timeout, got %d", s.Timeouts)
+	}
+
+	// the abandoned gather is still running
+	if slist, ok, _ := r.gather(g, time.Now()); ok || slist != nil {
+		t.Fatalf("expected gather skipped, got %v %v", ok, slist)
+	}
+	if s := stat.Snapshot(); s.Skipped != 1 || s.Timeouts != 1 {
+		t.Fatalf("expected 1 skip and 1 timeout, got %d %d", s.Skipped, s.Timeouts)
+	}
+
+	close(g.release)
+	for i := 0; g.runs.Load() == 0 || r.isRunning(g); i++ {
+		if i > 100 {
+			t.Fatal("abandoned gather not finished")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	slist, ok, _ := r.gather(g, time.Now())
+	if !ok {
+		t.Fatal("expected gather finished")
+	}
+	// samples of the late gather are not in this run
+	samples := slist.PopBackAll()
+	if len(samples) != 1 || samples[0].Value != 2.0 {
+		t.Fatalf("expected only the sample of run 2, got %v", samples)
+	}
+}
+
+func (r *InputReader) isRunning(owner interface{}) bool {
+	running, has := r.running.Load(owner)
+	return has && running.(*atomic.Bool).Load()
+}
+
+type errorGatherer struct{}
+
+func (errorGatherer) GatherWithError(slist *types.SampleList) error {
+	slist.PushSample("partial", "up", 0)
+	return errors.New("connection refused")
+}
+
+func TestGatherError(t *testing.T) {
+	g := errorGatherer{}
+	stat := health.Register("partial", "")
+	defer health.Unregister(stat)
+	r := &InputReader{inputName: "partial", stats: map[interface{}]*health.Stat{g: stat}}
+
+	start := time.Now()
+	slist, ok, err := r.gather(g, start)
+	if !ok || err == nil || slist.Len() != 1 {
+		t.Fatalf("expected the samples and error of gather, got %v %v", ok, err)
+	}
+	r.gathered(g, start, slist, err)
+	if s := stat.Snapshot(); s.Errors != 1 || s.Samples != 1 || s.LastError != "connection refused" || !s.LastSuccess.IsZero() {
+		t.Fatalf("unexpected stat of failed gather: %+v", s)
+	}
+}
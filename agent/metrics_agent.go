@@ -2,12 +2,14 @@ package agent
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"strings"
 	"sync"
 
 	"flashcat.cloud/categraf/config"
 	"flashcat.cloud/categraf/inputs"
+	"flashcat.cloud/categraf/pkg/cardinality"
 	"flashcat.cloud/categraf/pkg/cfg"
 	"flashcat.cloud/categraf/types"
 
@@ -37,6 +39,7 @@ import (
 	_ "flashcat.cloud/categraf/inputs/filecount"
 	_ "flashcat.cloud/categraf/inputs/gnmi"
 	_ "flashcat.cloud/categraf/inputs/googlecloud"
+	_ "flashcat.cloud/categraf/inputs/graphite"
 	_ "flashcat.cloud/categraf/inputs/greenplum"
 	_ "flashcat.cloud/categraf/inputs/hadoop"
 	_ "flashcat.cloud/categraf/inputs/haproxy"
@@ -94,6 +97,7 @@ import (
 	_ "flashcat.cloud/categraf/inputs/snmp_zabbix"
 	_ "flashcat.cloud/categraf/inputs/sockstat"
 	_ "flashcat.cloud/categraf/inputs/sqlserver"
+	_ "flashcat.cloud/categraf/inputs/statsd"
 	_ "flashcat.cloud/categraf/inputs/supervisor"
 	_ "flashcat.cloud/categraf/inputs/switch_legacy"
 	_ "flashcat.cloud/categraf/inputs/system"
@@ -112,6 +116,9 @@ type MetricsAgent struct {
 	InputFilters   map[string]struct{}
 	InputReaders   *Readers
 	InputProviders []inputs.Provider
+
+	// running loops of readers, including the stopped ones not returned yet
+	loops sync.WaitGroup
 }
 
 type Readers struct {
@@ -162,6 +169,8 @@ func (r *Readers) Iter() map[string]map[string]*InputReader {
 
 func NewMetricsAgent() AgentModule {
 	c := config.Config
+	cardinality.SetGlobal(c.Global.MaxSeries, globalSeriesExpire)
+
 	agent := &MetricsAgent{
 		InputFilters: parseFilter(c.InputFilters),
 		InputReaders: NewReaders(),
@@ -197,6 +206,10 @@ func (ma *MetricsAgent) Start() error {
 }
 
 func (ma *MetricsAgent) start(idx int) error {
+	lock := inputs.ReloadLock(ma.InputProviders[idx].Name())
+	lock.Lock()
+	defer lock.Unlock()
+
 	if _, err := ma.InputProviders[idx].LoadConfig(); err != nil {
 		log.Println("E! input provider load config get err: ", err)
 	}
@@ -240,19 +253,64 @@ func (ma *MetricsAgent) Stop() error {
 			ma.InputReaders.Del(name, sum)
 		}
 	}
+	// readers may still be returning from their loops, including the replaced ones
+	ma.loops.Wait()
 	return nil
 }
 
 func (ma *MetricsAgent) RegisterInput(name string, configs []cfg.ConfigWithFormat) {
+	newInputs, err := ma.loadInput(name, configs)
+	if err != nil {
+		log.Println("E!", err)
+		return
+	}
+
+	for sum, nInput := range newInputs {
+		ma.inputGo(name, sum, nInput)
+	}
+}
+
+// ReplaceInput starts the input with new configs in place of the running one,
+// which keeps running if the new configs fail to load or init
+func (ma *MetricsAgent) ReplaceInput(name string, configs []cfg.ConfigWithFormat) error {
+	newInputs, err := ma.loadInput(name, configs)
+	if err != nil {
+		return err
+	}
+
+	started := make(map[string]inputs.Input, len(newInputs))
+	for sum, nInput := range newInputs {
+		ok, err := ma.initInput(name, nInput)
+		if err != nil {
+			for _, in := range newInputs {
+				inputs.MayDrop(in)
+			}
+			return fmt.Errorf("failed to init input: %s error: %v", name, err)
+		}
+		if ok {
+			started[sum] = nInput
+		}
+	}
+
+	if _, has := ma.InputReaders.GetInput(name); has {
+		ma.DeregisterInput(name, "")
+	}
+	for sum, nInput := range started {
+		ma.startReader(name, sum, nInput)
+	}
+	return nil
+}
+
+// loadInput decodes configs of the input, nil if the input is filtered out
+func (ma *MetricsAgent) loadInput(name string, configs []cfg.ConfigWithFormat) (map[string]inputs.Input, error) {
 	typ, inputKey := inputs.ParseInputName(name)
 	if !ma.FilterPass(inputKey) {
-		return
+		return nil, nil
 	}
 
 	creator, has := inputs.InputCreators[inputKey]
 	if !has {
-		log.Println("E! input:", name, "not supported")
-		return
+		return nil, fmt.Errorf("input: %s not supported", name)
 	}
 
 	idx := -1
@@ -262,69 +320,81 @@ func (ma *MetricsAgent) RegisterInput(name string, configs []cfg.ConfigWithForma
 		}
 	}
 	if idx == -1 {
-		log.Println("E! input provider:", typ, "not found")
-		// hint and panic next line
+		return nil, fmt.Errorf("input provider: %s not found", typ)
 	}
 	newInputs, err := ma.InputProviders[idx].LoadInputConfig(configs, creator())
 	if err != nil {
-		log.Println("E! failed to load configuration of plugin:", name, "error:", err)
-		return
+		return nil, fmt.Errorf("failed to load configuration of plugin: %s error: %v", name, err)
 	}
+	return newInputs, nil
+}
 
-	for sum, nInput := range newInputs {
-		ma.inputGo(name, sum, nInput)
+func (ma *MetricsAgent) inputGo(name string, sum string, input inputs.Input) {
+	ok, err := ma.initInput(name, input)
+	if err != nil {
+		log.Println("E! failed to init input:", name, "error:", err)
+	}
+	if ok {
+		ma.startReader(name, sum, input)
 	}
 }
 
-func (ma *MetricsAgent) inputGo(name string, sum string, input inputs.Input) {
-	var err error
+// initInput inits the input and its instances, ok is false if nothing is left
+// to gather. err is the failure of the input or of the failed instances
+func (ma *MetricsAgent) initInput(name string, input inputs.Input) (ok bool, err error) {
 	if err = input.InitInternalConfig(); err != nil {
-		log.Println("E! failed to init input:", name, "error:", err)
-		return
+		return false, err
 	}
 
 	if err = inputs.MayInit(input); err != nil {
 		if !errors.Is(err, types.ErrInstancesEmpty) {
-			log.Println("E! failed to init input:", name, "error:", err)
-		} else {
-			if config.Config.DebugMode {
-				_, inputKey := inputs.ParseInputName(name)
-				log.Println("W! no instances for input: ", inputKey)
-			}
+			return false, err
 		}
-		return
+		if config.Config.DebugMode {
+			_, inputKey := inputs.ParseInputName(name)
+			log.Println("W! no instances for input: ", inputKey)
+		}
+		return false, nil
 	}
 
 	instances := inputs.MayGetInstances(input)
-	if instances != nil {
-		empty := true
-		for i := 0; i < len(instances); i++ {
-			if err := instances[i].InitInternalConfig(); err != nil {
-				log.Println("E! failed to init input:", name, "error:", err)
-				continue
-			}
+	if instances == nil {
+		return true, nil
+	}
+	empty := true
+	for i := 0; i < len(instances); i++ {
+		if ierr := instances[i].InitInternalConfig(); ierr != nil {
+			err = errors.Join(err, ierr)
+			continue
+		}
 
-			if err := inputs.MayInit(instances[i]); err != nil {
-				if !errors.Is(err, types.ErrInstancesEmpty) {
-					log.Println("E! failed to init input:", name, "error:", err)
-				}
-				continue
+		if ierr := inputs.MayInit(instances[i]); ierr != nil {
+			if !errors.Is(ierr, types.ErrInstancesEmpty) {
+				err = errors.Join(err, ierr)
 			}
-			empty = false
-			instances[i].SetInitialized()
+			continue
 		}
+		empty = false
+		instances[i].SetInitialized()
+	}
 
-		if empty {
-			if config.Config.DebugMode {
-				_, inputKey := inputs.ParseInputName(name)
-				log.Printf("W! no instances for input:%s", inputKey)
-			}
-			return
+	if empty {
+		if config.Config.DebugMode {
+			_, inputKey := inputs.ParseInputName(name)
+			log.Printf("W! no instances for input:%s", inputKey)
 		}
+		return false, err
 	}
+	return true, err
+}
 
-	reader := newInputReader(name, input)
-	go reader.startInput()
+func (ma *MetricsAgent) startReader(name string, sum string, input inputs.Input) {
+	reader := newInputReader(name, sum, input)
+	ma.loops.Add(1)
+	go func() {
+		defer ma.loops.Done()
+		reader.startInput()
+	}()
 	ma.InputReaders.Add(name, sum, reader)
 	log.Println("I! input:", name, "started")
 }
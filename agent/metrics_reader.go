@@ -8,6 +8,8 @@ import (
 
 	"flashcat.cloud/categraf/config"
 	"flashcat.cloud/categraf/inputs"
+	"flashcat.cloud/categraf/pkg/cardinality"
+	"flashcat.cloud/categraf/pkg/health"
 	"flashcat.cloud/categraf/pkg/runtimex"
 	"flashcat.cloud/categraf/types"
 	"flashcat.cloud/categraf/writer"
@@ -15,30 +17,59 @@ import (
 
 type InputReader struct {
 	inputName  string
+	checksum   string
 	input      inputs.Input
 	quitChan   chan struct{}
 	runCounter uint64
 	waitGroup  sync.WaitGroup
+
+	// series limiters of the plugin and instances with max_series
+	limiters     map[interface{}]*cardinality.Limiter
+	limitersLock sync.Mutex
+
+	// gather health of the plugin or instances
+	stats     map[interface{}]*health.Stat
+	statsLock sync.Mutex
+
+	// gathers of the plugin or instances still running after gather_timeout
+	running sync.Map
+
+	// writes delayed by flush_jitter, canceled on Stop
+	flushes   map[*time.Timer]struct{}
+	flushLock sync.Mutex
+	stopped   bool
 }
 
-func newInputReader(inputName string, in inputs.Input) *InputReader {
-	return &InputReader{
+func newInputReader(inputName, checksum string, in inputs.Input) *InputReader {
+	r := &InputReader{
 		inputName: inputName,
+		checksum:  checksum,
 		input:     in,
 		quitChan:  make(chan struct{}, 1),
+		limiters:  make(map[interface{}]*cardinality.Limiter),
+		stats:     make(map[interface{}]*health.Stat),
+		flushes:   make(map[*time.Timer]struct{}),
 	}
+	r.initStats()
+	return r
 }
 
 func (r *InputReader) Stop() {
 	r.quitChan <- struct{}{}
+	r.cancelFlushes()
 	inputs.MayDrop(r.input)
+	r.dropStats()
 }
 
-func (r *InputReader) startInput() {
+func (r *InputReader) interval() time.Duration {
 	interval := config.GetInterval()
 	if r.input.GetInterval() > 0 {
 		interval = time.Duration(r.input.GetInterval())
 	}
+	return interval
+}
+
+func (r *InputReader) startInput() {
 	if si, ok := r.input.(inputs.ServiceInput); ok {
 		slist := types.NewSampleList()
 		err := si.Start(slist)
@@ -47,7 +78,8 @@ func (r *InputReader) startInput() {
 			return
 		}
 	}
-	timer := time.NewTimer(0 * time.Second)
+	sched := r.newSchedule()
+	timer := time.NewTimer(sched.first(time.Now()))
 	defer timer.Stop()
 	var start time.Time
 
@@ -62,32 +94,42 @@ func (r *InputReader) startInput() {
 				log.Println("D!", r.inputName, ": before gather once")
 			}
 
-			r.gatherOnce()
+			r.gatherOnce(sched.timestamp())
 
 			if config.Config.DebugMode {
 				log.Println("D!", r.inputName, ": after gather once,", "duration:", time.Since(start))
 			}
 
-			next := interval - time.Since(start)
-			if next < 0 {
-				next = 0
+			// ticks passed during the gather are skipped
+			next, missed := sched.next(time.Now())
+			if missed > 0 {
+				r.skip(missed)
 			}
 			timer.Reset(next)
 		}
 	}
 }
 
-func (r *InputReader) gatherOnce() {
+// gatherOnce gathers the plugin and instances, samples without timestamp are
+// set to ts if it is not zero
+func (r *InputReader) gatherOnce(ts time.Time) {
+	start := time.Now()
 	defer func() {
 		if rc := recover(); rc != nil {
 			log.Println("E!", r.inputName, ": gather metrics panic:", r, string(runtimex.Stack(3)))
+			if s := r.stat(r.input); s != nil {
+				s.Panicked(start, rc)
+			}
 		}
 	}()
 
 	// plugin level, for system plugins
-	slist := types.NewSampleList()
-	inputs.MayGather(r.input, slist)
-	r.forward(r.input.Process(slist))
+	if slist, ok, err := r.gather(r.input, start); ok {
+		stampZero(slist, ts)
+		slist = r.input.Process(slist)
+		r.gathered(r.input, start, slist, err)
+		r.forward(slist, r.input)
+	}
 
 	instances := inputs.MayGetInstances(r.input)
 	if len(instances) == 0 {
@@ -119,19 +161,95 @@ func (r *InputReader) gatherOnce() {
 				}
 			}
 
-			insList := types.NewSampleList()
-			inputs.MayGather(ins, insList)
-			r.forward(ins.Process(insList))
+			start := time.Now()
+			defer func() {
+				if rc := recover(); rc != nil {
+					log.Println("E!", r.inputName, ": gather metrics panic:", rc, string(runtimex.Stack(3)))
+					if s := r.stat(ins); s != nil {
+						s.Panicked(start, rc)
+					}
+				}
+			}()
+
+			insList, ok, err := r.gather(ins, start)
+			if !ok {
+				return
+			}
+			stampZero(insList, ts)
+			insList = ins.Process(insList)
+			r.gathered(ins, start, insList, err)
+			r.forward(insList, ins)
 		}(instances[i])
 	}
 
 	r.waitGroup.Wait()
 }
 
-func (r *InputReader) forward(slist *types.SampleList) {
+func sampleCount(slist *types.SampleList) int {
+	if slist == nil {
+		return 0
+	}
+	return slist.Len()
+}
+
+// stampZero sets timestamps of samples to ts, samples timestamped by the input
+// keep their own
+func stampZero(slist *types.SampleList, ts time.Time) {
+	if ts.IsZero() {
+		return
+	}
+	slist.Lock()
+	defer slist.Unlock()
+	for e := slist.L.Front(); e != nil; e = e.Next() {
+		if s, ok := e.Value.(*types.Sample); ok && s != nil && s.Timestamp.IsZero() {
+			s.Timestamp = ts
+		}
+	}
+}
+
+func (r *InputReader) forward(slist *types.SampleList, owner interface{}) {
 	if slist == nil {
 		return
 	}
 	arr := slist.PopBackAll()
-	writer.WriteSamples(arr)
+	arr = r.limit(arr, r.limiter(owner))
+
+	interval := r.interval()
+	if ins, ok := owner.(inputs.Instance); ok && ins.GetIntervalTimes() > 1 {
+		interval *= time.Duration(ins.GetIntervalTimes())
+	}
+
+	jitter := randDuration(r.flushJitter())
+	if jitter == 0 {
+		writer.WriteSamplesWithInterval(arr, interval)
+		return
+	}
+
+	r.flushLock.Lock()
+	defer r.flushLock.Unlock()
+	if r.stopped {
+		return
+	}
+	var t *time.Timer
+	t = time.AfterFunc(jitter, func() {
+		// hold the lock while writing, so nothing is written after Stop returns
+		r.flushLock.Lock()
+		defer r.flushLock.Unlock()
+		delete(r.flushes, t)
+		if !r.stopped {
+			writer.WriteSamplesWithInterval(arr, interval)
+		}
+	})
+	r.flushes[t] = struct{}{}
+}
+
+// cancelFlushes drops the writes still waiting for flush_jitter
+func (r *InputReader) cancelFlushes() {
+	r.flushLock.Lock()
+	defer r.flushLock.Unlock()
+	r.stopped = true
+	for t := range r.flushes {
+		t.Stop()
+		delete(r.flushes, t)
+	}
 }
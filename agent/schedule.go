@@ -0,0 +1,94 @@
+package agent
+
+import (
+	"math/rand"
+	"time"
+
+	"flashcat.cloud/categraf/config"
+)
+
+type scheduled interface {
+	GetCollectionJitter() time.Duration
+	GetFlushJitter() time.Duration
+	GetRoundInterval() bool
+}
+
+// schedule computes the ticks of an input, a tick is start + n * interval, or a
+// multiple of interval with round_interval, and the gather fires at a random
+// delay within collection_jitter after the tick
+type schedule struct {
+	interval time.Duration
+	jitter   time.Duration
+	round    bool
+
+	// the tick waiting for
+	tick time.Time
+}
+
+func (r *InputReader) newSchedule() *schedule {
+	s := &schedule{interval: r.interval()}
+	if sc, ok := r.input.(scheduled); ok {
+		s.jitter = sc.GetCollectionJitter()
+		s.round = sc.GetRoundInterval()
+	} else {
+		s.jitter = time.Duration(config.Config.Global.CollectionJitter)
+		s.round = config.Config.Global.RoundInterval
+	}
+	return s
+}
+
+// flushJitter returns the max random delay of writing the samples of the input
+func (r *InputReader) flushJitter() time.Duration {
+	if sc, ok := r.input.(scheduled); ok {
+		return sc.GetFlushJitter()
+	}
+	return time.Duration(config.Config.Global.FlushJitter)
+}
+
+// first returns the wait of the first gather
+func (s *schedule) first(now time.Time) time.Duration {
+	s.tick = now
+	if s.round {
+		s.tick = now.Truncate(s.interval)
+		if s.tick.Before(now) {
+			s.tick = s.tick.Add(s.interval)
+		}
+	}
+	return s.wait(now)
+}
+
+// next moves to the next tick after now, returns the wait and the number of
+// ticks missed because the last gather overran
+func (s *schedule) next(now time.Time) (time.Duration, uint64) {
+	s.tick = s.tick.Add(s.interval)
+	var missed uint64
+	if now.After(s.tick) {
+		n := now.Sub(s.tick)/s.interval + 1
+		s.tick = s.tick.Add(n * s.interval)
+		missed = uint64(n)
+	}
+	return s.wait(now), missed
+}
+
+func (s *schedule) wait(now time.Time) time.Duration {
+	wait := s.tick.Sub(now) + randDuration(s.jitter)
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+// timestamp returns the tick to snap timestamps of samples to, zero if not round_interval
+func (s *schedule) timestamp() time.Time {
+	if !s.round {
+		return time.Time{}
+	}
+	return s.tick
+}
+
+func randDuration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
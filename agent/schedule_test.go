@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"flashcat.cloud/categraf/types"
+)
+
+func TestSchedule(t *testing.T) {
+	base := time.Date(2024, 1, 1, 10, 0, 7, 0, time.UTC)
+	tests := []struct {
+		name   string
+		round  bool
+		jitter time.Duration
+		start  time.Time
+		// the time next is called, after the first gather
+		end        time.Time
+		wantFirst  time.Duration
+		wantNext   time.Duration
+		wantMissed uint64
+	}{
+		{
+			name:      "plain",
+			start:     base,
+			end:       base.Add(2 * time.Second),
+			wantFirst: 0,
+			wantNext:  13 * time.Second,
+		},
+		{
+			name:      "round",
+			round:     true,
+			start:     base,
+			end:       base.Add(9 * time.Second),
+			wantFirst: 8 * time.Second,
+			wantNext:  14 * time.Second,
+		},
+		{
+			name:      "round on tick",
+			round:     true,
+			start:     base.Add(8 * time.Second),
+			end:       base.Add(9 * time.Second),
+			wantFirst: 0,
+			wantNext:  14 * time.Second,
+		},
+		{
+			name:       "missed ticks",
+			start:      base,
+			end:        base.Add(40 * time.Second),
+			wantFirst:  0,
+			wantNext:   5 * time.Second,
+			wantMissed: 2,
+		},
+		{
+			name:       "round missed ticks",
+			round:      true,
+			start:      base,
+			end:        base.Add(33 * time.Second),
+			wantFirst:  8 * time.Second,
+			wantNext:   5 * time.Second,
+			wantMissed: 1,
+		},
+		{
+			name:      "jitter",
+			jitter:    3 * time.Second,
+			start:     base,
+			end:       base.Add(2 * time.Second),
+			wantFirst: 0,
+			wantNext:  13 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &schedule{interval: 15 * time.Second, jitter: tt.jitter, round: tt.round}
+
+			first := s.first(tt.start)
+			if first < tt.wantFirst || first > tt.wantFirst+tt.jitter {
+				t.Fatalf("expected first wait %v within jitter %v, got %v", tt.wantFirst, tt.jitter, first)
+			}
+			if tt.round && s.timestamp().Truncate(15*time.Second) != s.timestamp() {
+				t.Fatalf("expected rounded tick, got %v", s.timestamp())
+			}
+			if !tt.round && !s.timestamp().IsZero() {
+				t.Fatalf("expected no timestamp without round_interval, got %v", s.timestamp())
+			}
+
+			next, missed := s.next(tt.end)
+			if next < tt.wantNext || next > tt.wantNext+tt.jitter {
+				t.Fatalf("expected next wait %v within jitter %v, got %v", tt.wantNext, tt.jitter, next)
+			}
+			if missed != tt.wantMissed {
+				t.Fatalf("expected %d missed ticks, got %d", tt.wantMissed, missed)
+			}
+		})
+	}
+}
+
+func TestStampZero(t *testing.T) {
+	tick := time.Date(2024, 1, 1, 10, 0, 15, 0, time.UTC)
+	source := tick.Add(-time.Hour)
+
+	slist := types.NewSampleList()
+	slist.PushSample("", "gathered", 1)
+	slist.PushFront(&types.Sample{Metric: "timestamped", Value: 2, Timestamp: source})
+	stampZero(slist, tick)
+
+	for _, s := range slist.PopBackAll() {
+		want := tick
+		if s.Metric == "timestamped" {
+			want = source
+		}
+		if !s.Timestamp.Equal(want) {
+			t.Fatalf("expected %s at %v, got %v", s.Metric, want, s.Timestamp)
+		}
+	}
+}
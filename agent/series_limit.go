@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"log"
+	"time"
+
+	"flashcat.cloud/categraf/inputs"
+	"flashcat.cloud/categraf/pkg/cardinality"
+	"flashcat.cloud/categraf/types"
+)
+
+// series not seen for this long release their slots in the global limiter
+const globalSeriesExpire = 10 * time.Minute
+
+type seriesLimited interface {
+	GetMaxSeries() int
+}
+
+// limiter returns the series limiter of the plugin or instance, nil if max_series is not set
+func (r *InputReader) limiter(owner interface{}) *cardinality.Limiter {
+	sl, ok := owner.(seriesLimited)
+	if !ok || sl.GetMaxSeries() <= 0 {
+		return nil
+	}
+
+	r.limitersLock.Lock()
+	defer r.limitersLock.Unlock()
+	l, has := r.limiters[owner]
+	if !has {
+		// keep series of slow inputs for at least a few intervals
+		expire := 3 * r.interval()
+		if expire < globalSeriesExpire {
+			expire = globalSeriesExpire
+		}
+		l = cardinality.NewLimiter(sl.GetMaxSeries(), expire)
+		r.limiters[owner] = l
+	}
+	return l
+}
+
+// limit drops new series beyond max_series of the instance or the global limit,
+// existing series keep flowing
+func (r *InputReader) limit(arr []*types.Sample, limiter *cardinality.Limiter) []*types.Sample {
+	global := cardinality.Global()
+	if limiter == nil && global == nil {
+		return arr
+	}
+
+	_, inputKey := inputs.ParseInputName(r.inputName)
+	now := time.Now()
+	ret := arr[:0]
+	dropped := 0
+	for _, s := range arr {
+		if s == nil {
+			continue
+		}
+		h := types.SeriesHash(s.Metric, s.Labels)
+		// the instance slot is taken only if the global limit admits the series
+		if limiter != nil && !limiter.Allow(h, now) {
+			cardinality.RecordDropped(inputKey, cardinality.ScopeInstance, s.Metric, 1)
+			dropped++
+			continue
+		}
+		if global != nil && !global.Admit(h, now) {
+			cardinality.RecordDropped(inputKey, cardinality.ScopeGlobal, s.Metric, 1)
+			dropped++
+			continue
+		}
+		if limiter != nil {
+			limiter.Admit(h, now)
+		}
+		ret = append(ret, s)
+	}
+	if dropped > 0 {
+		log.Println("W!", r.inputName, ": dropped", dropped, "new series beyond the series limit")
+	}
+	return ret
+}
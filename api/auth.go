@@ -0,0 +1,365 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/limiter"
+	"flashcat.cloud/categraf/types"
+	"flashcat.cloud/categraf/writer"
+)
+
+// reasons of rejected push requests
+const (
+	rejectIPNotAllowed = "ip_not_allowed"
+	rejectUnauthorized = "unauthorized"
+	rejectRequestRate  = "request_rate_limited"
+	rejectSampleRate   = "sample_rate_limited"
+)
+
+var pushRejectedTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "push_rejected_total",
+		Help: "Total number of rejected push api requests.",
+	},
+	[]string{"reason"},
+)
+
+func init() {
+	prometheus.MustRegister(pushRejectedTotal)
+}
+
+const (
+	ctxPushClient  = "push_client"
+	ctxPushTenants = "push_tenant_labels"
+)
+
+// pushGuard checks source ip, credentials and rate limits of push clients
+type pushGuard struct {
+	allowed   []*net.IPNet
+	basicUser string
+	basicPass string
+	tokens    []config.BearerToken
+	requests  *limiter.KeyedBuckets
+	samples   *limiter.KeyedBuckets
+}
+
+var guard *pushGuard
+
+func newPushGuard(conf *config.HTTP) (*pushGuard, error) {
+	g := &pushGuard{
+		basicUser: conf.BasicAuthUser,
+		basicPass: conf.BasicAuthPass,
+		tokens:    conf.BearerTokens,
+	}
+	for _, s := range conf.AllowedIPs {
+		if !strings.Contains(s, "/") {
+			if strings.Contains(s, ":") {
+				s += "/128"
+			} else {
+				s += "/32"
+			}
+		}
+		_, ipnet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed_ips %s: %v", s, err)
+		}
+		g.allowed = append(g.allowed, ipnet)
+	}
+	for i, t := range g.tokens {
+		if t.Token == "" {
+			return nil, fmt.Errorf("token of bearer_tokens[%d] is empty", i)
+		}
+	}
+	if conf.RateLimitRequests > 0 {
+		g.requests = limiter.NewKeyedBuckets(conf.RateLimitRequests, conf.RateLimitRequests)
+	}
+	if conf.RateLimitSamples > 0 {
+		g.samples = limiter.NewKeyedBuckets(conf.RateLimitSamples, conf.RateLimitSamples)
+	}
+	return g, nil
+}
+
+func (g *pushGuard) authRequired() bool {
+	return g.basicUser != "" || len(g.tokens) > 0
+}
+
+// check returns the client identity and tenant labels of a request,
+// reason is not empty if the request is rejected
+func (g *pushGuard) check(ip net.IP, authorization string, now time.Time) (client string, labels map[string]string, reason string) {
+	if g == nil {
+		return "", nil, ""
+	}
+
+	if !g.ipAllowed(ip) {
+		return "", nil, rejectIPNotAllowed
+	}
+
+	client = ip.String()
+	if g.authRequired() {
+		scheme, credential, _ := strings.Cut(authorization, " ")
+		authorized := false
+		switch strings.ToLower(scheme) {
+		case "basic":
+			if g.basicUser == "" {
+				break
+			}
+			decoded, err := base64.StdEncoding.DecodeString(credential)
+			if err != nil {
+				break
+			}
+			user, pass, _ := strings.Cut(string(decoded), ":")
+			if secureEqual(user, g.basicUser) && secureEqual(pass, g.basicPass) {
+				authorized = true
+				client = "basic:" + user
+			}
+		case "bearer", "token":
+			// Token is the scheme of influxdb clients
+			for i, t := range g.tokens {
+				if secureEqual(credential, t.Token) {
+					authorized = true
+					client = "token:" + strconv.Itoa(i)
+					labels = t.Labels
+					break
+				}
+			}
+		}
+		if !authorized {
+			return "", nil, rejectUnauthorized
+		}
+	}
+
+	if g.requests != nil && !g.requests.AllowN(client, now, 1) {
+		return "", nil, rejectRequestRate
+	}
+	return client, labels, ""
+}
+
+// samples rarely take more bytes than this in push payloads, so the
+// content length divided by it underestimates the samples of a request
+const maxBytesPerSample = 512
+
+// hasSampleBudget rejects clients out of sample budget before the body is
+// decoded, the samples of a request are estimated by its content length
+func (g *pushGuard) hasSampleBudget(client string, contentLength int64, now time.Time) bool {
+	if g == nil || g.samples == nil {
+		return true
+	}
+	n := contentLength / maxBytesPerSample
+	if n < 1 {
+		n = 1
+	}
+	return g.samples.HasN(client, now, float64(n))
+}
+
+func (g *pushGuard) ipAllowed(ip net.IP) bool {
+	if g == nil || len(g.allowed) == 0 {
+		return true
+	}
+	for _, ipnet := range g.allowed {
+		if ip != nil && ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// admitSamples reports whether the client is within the sample rate limit
+func (g *pushGuard) admitSamples(client string, n int, now time.Time) bool {
+	if g == nil || g.samples == nil || n == 0 {
+		return true
+	}
+	return g.samples.AllowN(client, now, float64(n))
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+func remoteIP(addr string) net.IP {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	return net.ParseIP(host)
+}
+
+func rejectStatus(reason string) int {
+	switch reason {
+	case rejectIPNotAllowed:
+		return http.StatusForbidden
+	case rejectUnauthorized:
+		return http.StatusUnauthorized
+	default:
+		return http.StatusTooManyRequests
+	}
+}
+
+func reject(c *gin.Context, reason string) {
+	pushRejectedTotal.WithLabelValues(reason).Inc()
+	if reason == rejectUnauthorized && guard != nil && guard.basicUser != "" {
+		c.Header("WWW-Authenticate", `Basic realm="categraf"`)
+	}
+	c.AbortWithStatusJSON(rejectStatus(reason), gin.H{"error": reason})
+}
+
+// pushAuth is the middleware of push apis, the source ip of the connection
+// is used rather than X-Forwarded-For which can be forged
+func pushAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		now := time.Now()
+		ip := remoteIP(c.Request.RemoteAddr)
+		client, labels, reason := guard.check(ip, c.GetHeader("Authorization"), now)
+		if reason == rejectUnauthorized && c.GetHeader("Authorization") == "" && c.Query("p") != "" {
+			// influxdb v1 clients pass credentials by u and p, p is a token if u does not match
+			basic := "Basic " + base64.StdEncoding.EncodeToString([]byte(c.Query("u")+":"+c.Query("p")))
+			client, labels, reason = guard.check(ip, basic, now)
+			if reason == rejectUnauthorized {
+				client, labels, reason = guard.check(ip, "Token "+c.Query("p"), now)
+			}
+		}
+		if reason != "" {
+			reject(c, reason)
+			return
+		}
+		if !guard.hasSampleBudget(client, c.Request.ContentLength, now) {
+			reject(c, rejectSampleRate)
+			return
+		}
+		c.Set(ctxPushClient, client)
+		c.Set(ctxPushTenants, labels)
+		c.Next()
+	}
+}
+
+// adminAuth is the middleware of admin apis, only the admin token is accepted,
+// credentials of push clients do not authorize admin calls
+func adminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !guard.ipAllowed(remoteIP(c.Request.RemoteAddr)) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": rejectIPNotAllowed})
+			return
+		}
+		scheme, credential, _ := strings.Cut(c.GetHeader("Authorization"), " ")
+		if !strings.EqualFold(scheme, "bearer") || !secureEqual(credential, token) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": rejectUnauthorized})
+			return
+		}
+		c.Next()
+	}
+}
+
+func pushClient(c *gin.Context) (string, map[string]string) {
+	client := c.GetString(ctxPushClient)
+	labels, _ := c.Value(ctxPushTenants).(map[string]string)
+	return client, labels
+}
+
+// writeTimeSeries is replaced in tests
+var writeTimeSeries = writer.WriteTimeSeries
+
+// pushTimeSeries adds tenant labels and writes the series if the client is
+// within the sample rate limit, otherwise the request is rejected
+func pushTimeSeries(c *gin.Context, series []prompb.TimeSeries) bool {
+	client, labels := pushClient(c)
+	if !guard.admitSamples(client, len(series), time.Now()) {
+		reject(c, rejectSampleRate)
+		return false
+	}
+	for i := range series {
+		series[i].Labels = setTenantLabels(series[i].Labels, labels)
+	}
+	writeTimeSeries(series)
+	return true
+}
+
+// pushSamples is pushTimeSeries for samples
+func pushSamples(c *gin.Context, samples []*types.Sample) bool {
+	client, labels := pushClient(c)
+	if !guard.admitSamples(client, len(samples), time.Now()) {
+		reject(c, rejectSampleRate)
+		return false
+	}
+	addTenantLabels(samples, labels)
+	writer.WriteSamples(samples)
+	return true
+}
+
+// tenant labels override the pushed ones so that a tenant can not write as another
+func setTenantLabels(labels []prompb.Label, tenants map[string]string) []prompb.Label {
+	for k, v := range tenants {
+		found := false
+		for i := range labels {
+			if labels[i].Name == k {
+				labels[i].Value = v
+				found = true
+				break
+			}
+		}
+		if !found {
+			labels = append(labels, prompb.Label{Name: k, Value: v})
+		}
+	}
+	return labels
+}
+
+func addTenantLabels(samples []*types.Sample, tenants map[string]string) {
+	if len(tenants) == 0 {
+		return
+	}
+	for _, s := range samples {
+		for k, v := range tenants {
+			s.Labels[k] = v
+		}
+	}
+}
+
+// serverTLSConfig verifies client certificates if client_ca_file is set
+func serverTLSConfig(conf *config.HTTP) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if conf.ClientCAFile == "" {
+		return tlsConfig, nil
+	}
+	pem, err := os.ReadFile(conf.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client_ca_file: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in client_ca_file %s", conf.ClientCAFile)
+	}
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	return tlsConfig, nil
+}
+
+type grpcPushClient struct {
+	client string
+	labels map[string]string
+}
+
+type grpcPushClientKey struct{}
+
+func withPushClient(ctx context.Context, client string, labels map[string]string) context.Context {
+	return context.WithValue(ctx, grpcPushClientKey{}, grpcPushClient{client: client, labels: labels})
+}
+
+func pushClientFromContext(ctx context.Context) (string, map[string]string) {
+	pc, _ := ctx.Value(grpcPushClientKey{}).(grpcPushClient)
+	return pc.client, pc.labels
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/config"
+)
+
+func TestPushGuard(t *testing.T) {
+	g, err := newPushGuard(&config.HTTP{
+		BasicAuthUser: "user",
+		BasicAuthPass: "pass",
+		BearerTokens: []config.BearerToken{
+			{Token: "t1", Labels: map[string]string{"tenant": "a"}},
+		},
+		AllowedIPs:        []string{"10.0.0.0/8", "127.0.0.1"},
+		RateLimitRequests: 2,
+		RateLimitSamples:  100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	local := net.ParseIP("127.0.0.1")
+	basic := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass"))
+
+	if _, _, reason := g.check(net.ParseIP("192.168.1.1"), basic, now); reason != rejectIPNotAllowed {
+		t.Fatalf("expected %s, got %q", rejectIPNotAllowed, reason)
+	}
+	if _, _, reason := g.check(local, "Bearer wrong", now); reason != rejectUnauthorized {
+		t.Fatalf("expected %s, got %q", rejectUnauthorized, reason)
+	}
+
+	client, labels, reason := g.check(local, "Bearer t1", now)
+	if reason != "" || client != "token:0" || labels["tenant"] != "a" {
+		t.Fatalf("unexpected result: %s %v %s", client, labels, reason)
+	}
+
+	if _, _, reason = g.check(local, basic, now); reason != "" {
+		t.Fatalf("unexpected reason: %s", reason)
+	}
+	g.check(local, basic, now)
+	if _, _, reason = g.check(local, basic, now); reason != rejectRequestRate {
+		t.Fatalf("expected %s, got %q", rejectRequestRate, reason)
+	}
+	if _, _, reason = g.check(local, basic, now.Add(time.Second)); reason != "" {
+		t.Fatalf("expected refilled, got %q", reason)
+	}
+
+	if !g.admitSamples("basic:user", 150, now) {
+		t.Fatal("expected a batch larger than burst admitted with a full bucket")
+	}
+	if g.admitSamples("basic:user", 1, now.Add(100*time.Millisecond)) {
+		t.Fatal("expected rejected before the debt is paid")
+	}
+	if g.hasSampleBudget("basic:user", 512, now.Add(100*time.Millisecond)) {
+		t.Fatal("expected no budget before the debt is paid")
+	}
+	g.admitSamples("token:0", 60, now)
+	if !g.hasSampleBudget("token:0", 40*512, now) || g.hasSampleBudget("token:0", 41*512, now) {
+		t.Fatal("expected the budget estimated by content length")
+	}
+
+	if client, _, reason := g.check(local, "Token t1", now.Add(2*time.Second)); reason != "" || client != "token:0" {
+		t.Fatalf("expected Token scheme accepted, got %s %q", client, reason)
+	}
+}
+
+func TestPushAuthQueryCredentials(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	var err error
+	guard, err = newPushGuard(&config.HTTP{
+		BasicAuthUser: "user",
+		BasicAuthPass: "pass",
+		BearerTokens:  []config.BearerToken{{Token: "t1"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { guard = nil }()
+
+	r := gin.New()
+	r.POST("/write", pushAuth(), func(c *gin.Context) {
+		client, _ := pushClient(c)
+		c.String(http.StatusOK, client)
+	})
+
+	tests := []struct {
+		query  string
+		status int
+		client string
+	}{
+		{"u=user&p=pass", http.StatusOK, "basic:user"},
+		{"u=any&p=t1", http.StatusOK, "token:0"},
+		{"p=t1", http.StatusOK, "token:0"},
+		{"u=user&p=wrong", http.StatusUnauthorized, ""},
+		{"", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/write?"+tt.query, nil)
+		req.RemoteAddr = "127.0.0.1:1234"
+		r.ServeHTTP(w, req)
+		if w.Code != tt.status || (tt.client != "" && w.Body.String() != tt.client) {
+			t.Fatalf("%s: unexpected response %d %s", tt.query, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestSetTenantLabels(t *testing.T) {
+	labels := []prompb.Label{{Name: "__name__", Value: "up"}, {Name: "tenant", Value: "b"}}
+	labels = setTenantLabels(labels, map[string]string{"tenant": "a", "team": "infra"})
+	got := make(map[string]string)
+	for _, l := range labels {
+		got[l.Name] = l.Value
+	}
+	if len(labels) != 3 || got["tenant"] != "a" || got["team"] != "infra" {
+		t.Fatalf("unexpected labels: %v", labels)
+	}
+}
+
+func TestAdminAuth(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	config.Config = &config.ConfigType{HTTP: &config.HTTP{}}
+	var err error
+	guard, err = newPushGuard(&config.HTTP{BearerTokens: []config.BearerToken{{Token: "push"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { guard = nil }()
+
+	request := func(r *gin.Engine, authorization string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/admin/schema", nil)
+		req.Header.Set("Authorization", authorization)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// admin apis are not served without admin_token
+	r := gin.New()
+	configRoutes(r)
+	if code := request(r, "Bearer push"); code != http.StatusNotFound {
+		t.Fatalf("expected admin apis disabled, got %d", code)
+	}
+
+	config.Config.HTTP.AdminToken = "admin"
+	r = gin.New()
+	configRoutes(r)
+	if code := request(r, "Bearer push"); code != http.StatusUnauthorized {
+		t.Fatalf("expected push token rejected, got %d", code)
+	}
+	if code := request(r, "Bearer admin"); code != http.StatusOK {
+		t.Fatalf("expected admin token accepted, got %d", code)
+	}
+}
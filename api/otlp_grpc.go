@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"net"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	// register gzip decompressor for clients sending compressed requests
+	_ "google.golang.org/grpc/encoding/gzip"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/writer"
+)
+
+// otlpGrpcServer accepts otlp/grpc ExportMetricsServiceRequest
+type otlpGrpcServer struct {
+	pmetricotlp.UnimplementedGRPCServer
+}
+
+func (s *otlpGrpcServer) Export(ctx context.Context, req pmetricotlp.ExportRequest) (pmetricotlp.ExportResponse, error) {
+	opts := otlpOptions{
+		ignoreHostname:     config.Config.HTTP.IgnoreHostname,
+		ignoreGlobalLabels: config.Config.HTTP.IgnoreGlobalLabels,
+	}
+	samples := otlpToSamples(req.Metrics(), opts)
+
+	client, labels := pushClientFromContext(ctx)
+	if !guard.admitSamples(client, len(samples), time.Now()) {
+		pushRejectedTotal.WithLabelValues(rejectSampleRate).Inc()
+		return pmetricotlp.NewExportResponse(), status.Error(codes.ResourceExhausted, rejectSampleRate)
+	}
+	addTenantLabels(samples, labels)
+	writer.WriteSamples(samples)
+	return pmetricotlp.NewExportResponse(), nil
+}
+
+// otlpGrpcAuth applies the checks of push apis to otlp/grpc requests
+func otlpGrpcAuth(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	var ip net.IP
+	if p, ok := peer.FromContext(ctx); ok {
+		ip = remoteIP(p.Addr.String())
+	}
+	var authorization string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if vs := md.Get("authorization"); len(vs) > 0 {
+			authorization = vs[0]
+		}
+	}
+
+	client, labels, reason := guard.check(ip, authorization, time.Now())
+	if reason != "" {
+		pushRejectedTotal.WithLabelValues(reason).Inc()
+		code := codes.ResourceExhausted
+		switch reason {
+		case rejectIPNotAllowed:
+			code = codes.PermissionDenied
+		case rejectUnauthorized:
+			code = codes.Unauthenticated
+		}
+		return nil, status.Error(code, reason)
+	}
+	return handler(withPushClient(ctx, client, labels), req)
+}
+
+func startOtlpGrpc(conf *config.HTTP) {
+	addr := config.Expand(conf.OtlpGrpcAddress)
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Println("E! failed to listen otlp grpc address:", addr, "error:", err)
+		return
+	}
+
+	opts := []grpc.ServerOption{grpc.UnaryInterceptor(otlpGrpcAuth)}
+	if conf.CertFile != "" && conf.KeyFile != "" {
+		tlsConfig, err := serverTLSConfig(conf)
+		if err != nil {
+			log.Println("E! failed to init otlp grpc tls:", err)
+			return
+		}
+		cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			log.Println("E! failed to load otlp grpc certificate:", err)
+			return
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	srv := grpc.NewServer(opts...)
+	pmetricotlp.RegisterGRPCServer(srv, &otlpGrpcServer{})
+
+	log.Println("I! otlp grpc server listening on:", addr)
+	if err := srv.Serve(lis); err != nil {
+		log.Println("E! otlp grpc server stopped:", err)
+	}
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"flashcat.cloud/categraf/agent"
+	"flashcat.cloud/categraf/inputs"
+	"flashcat.cloud/categraf/pkg/conv"
+)
+
+var (
+	adminAgent *agent.Agent
+	adminLock  sync.RWMutex
+)
+
+// SetAgent makes the agent manageable by admin apis
+func SetAgent(ag *agent.Agent) {
+	adminLock.Lock()
+	defer adminLock.Unlock()
+	adminAgent = ag
+}
+
+func getAgent(c *gin.Context) *agent.Agent {
+	adminLock.RLock()
+	defer adminLock.RUnlock()
+	if adminAgent == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "agent is not running"})
+	}
+	return adminAgent
+}
+
+func adminError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, agent.ErrInputNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, agent.ErrMetricsAgentDisabled):
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
+
+// adminInputs lists running inputs and instances with their last gather
+func adminInputs(c *gin.Context) {
+	ag := getAgent(c)
+	if ag == nil {
+		return
+	}
+	list, err := ag.Inputs()
+	if err != nil {
+		adminError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// adminReload reloads the whole agent like SIGHUP
+func adminReload(c *gin.Context) {
+	ag := getAgent(c)
+	if ag == nil {
+		return
+	}
+	ag.Reload()
+	c.JSON(http.StatusOK, gin.H{"message": "reloaded"})
+}
+
+// adminReloadInput reloads the configuration of an input
+func adminReloadInput(c *gin.Context) {
+	ag := getAgent(c)
+	if ag == nil {
+		return
+	}
+	name := c.Param("name")
+	if err := ag.ReloadInput(name); err != nil {
+		adminError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": name + " reloaded"})
+}
+
+// adminGather gathers an input once and returns the samples without writing them
+func adminGather(c *gin.Context) {
+	ag := getAgent(c)
+	if ag == nil {
+		return
+	}
+	samples, err := ag.GatherInput(c.Param("name"))
+	if err != nil {
+		adminError(c, err)
+		return
+	}
+	// NaN and Inf can not be encoded by json
+	for _, s := range samples {
+		if v, err := conv.ToFloat64(s.Value); err == nil && (math.IsNaN(v) || math.IsInf(v, 0)) {
+			s.Value = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	}
+	c.JSON(http.StatusOK, samples)
+}
+
+// adminSchema returns the json schema of the options of every input
+func adminSchema(c *gin.Context) {
+	c.JSON(http.StatusOK, inputs.Schema())
+}
@@ -14,7 +14,6 @@ import (
 	"github.com/prometheus/prometheus/prompb"
 
 	"flashcat.cloud/categraf/config"
-	"flashcat.cloud/categraf/writer"
 )
 
 type FalconMetric struct {
@@ -210,6 +209,8 @@ func openFalcon(c *gin.Context) {
 		log.Println("falcon forwarder error, message:", string(bytes))
 	}
 
-	writer.WriteTimeSeries(series)
+	if !pushTimeSeries(c, series) {
+		return
+	}
 	c.String(200, "succ:%d fail:%d message:%s", succ, fail, msg)
 }
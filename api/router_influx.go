@@ -0,0 +1,96 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/parser/influx"
+	"flashcat.cloud/categraf/types"
+)
+
+// influxWrite accepts influxdb line protocol, it is compatible with
+// influxdb v1 /write and v2 /api/v2/write
+func influxWrite(c *gin.Context) {
+	precision, err := influx.ParsePrecision(c.Query("precision"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	bytes, err := readerGzipBody(c.GetHeader("Content-Encoding"), c.Request)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	slist := types.NewSampleList()
+	bad, parseErr := influx.NewTimedParser(precision).ParseLines(bytes, slist)
+	if bad > 0 {
+		client, _ := pushClient(c)
+		log.Printf("W! %d invalid influx lines from %s, first error: %v", bad, client, parseErr)
+	}
+	samples := slist.PopBackAll()
+	if len(samples) == 0 {
+		if bad > 0 {
+			c.String(http.StatusBadRequest, fmt.Sprintf("%d lines are invalid, first error: %v", bad, parseErr))
+			return
+		}
+		c.String(http.StatusBadRequest, "payload empty")
+		return
+	}
+
+	// database of v1 and bucket of v2 are kept as labels
+	extra := make(map[string]string)
+	if db := c.Query("db"); db != "" {
+		extra["db"] = db
+	}
+	if bucket := c.Query("bucket"); bucket != "" {
+		extra["bucket"] = bucket
+	}
+
+	ignoreHostname := config.Config.HTTP.IgnoreHostname || QueryBoolWithValues("ignore_hostname")(c)
+	ignoreGlobalLabels := config.Config.HTTP.IgnoreGlobalLabels || QueryBoolWithValues("ignore_global_labels")(c)
+	series := make([]prompb.TimeSeries, 0, len(samples))
+	for _, s := range samples {
+		for k, v := range extra {
+			if _, has := s.Labels[k]; !has {
+				s.Labels[k] = v
+			}
+		}
+		// add global labels
+		if !ignoreGlobalLabels {
+			for k, v := range config.GlobalLabels() {
+				if _, has := s.Labels[k]; has {
+					continue
+				}
+				s.Labels[k] = v
+			}
+		}
+		// add label: agent_hostname
+		if _, has := s.Labels[agentHostnameLabelKey]; !has && !ignoreHostname {
+			s.Labels[agentHostnameLabelKey] = config.Config.GetHostname()
+		}
+
+		pt := s.ConvertTimeSeries(config.Config.Global.Precision)
+		if pt == nil {
+			// string fields can not be converted to samples
+			continue
+		}
+		series = append(series, *pt)
+	}
+
+	if !pushTimeSeries(c, series) {
+		return
+	}
+	// valid lines are written like influxdb does on a partial write
+	if bad > 0 {
+		c.String(http.StatusBadRequest, fmt.Sprintf("partial write: %d lines are invalid, first error: %v", bad, parseErr))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
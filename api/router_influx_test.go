@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/config"
+)
+
+func TestInfluxWrite(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	config.Config = &config.ConfigType{
+		Global: config.Global{Precision: "ms"},
+		HTTP:   &config.HTTP{IgnoreHostname: true},
+	}
+	guard = nil
+
+	var written []prompb.TimeSeries
+	orig := writeTimeSeries
+	writeTimeSeries = func(series []prompb.TimeSeries) { written = append(written, series...) }
+	defer func() { writeTimeSeries = orig }()
+
+	r := gin.New()
+	configRoutes(r)
+
+	tests := []struct {
+		name   string
+		url    string
+		body   string
+		status int
+		label  string
+		ts     int64
+		n      int
+	}{
+		{"v1 minutes", "/write?db=telegraf&precision=m", "cpu,host=a usage=1 2\n", http.StatusNoContent, "db", 120000, 1},
+		{"v1 hours", "/write?db=telegraf&precision=h", "cpu,host=a usage=1 1\n", http.StatusNoContent, "db", 3600000, 1},
+		{"v2 seconds", "/api/v2/write?bucket=b&precision=s", "cpu,host=a usage=1 3\n", http.StatusNoContent, "bucket", 3000, 1},
+		{"partial", "/write?db=telegraf&precision=s", "cpu,host=a usage=1 3\ncpu,host=a\ncpu usage=\n", http.StatusBadRequest, "db", 3000, 1},
+		{"all invalid", "/api/v2/write?bucket=b", "cpu,host=a\n", http.StatusBadRequest, "", 0, 0},
+		{"overflow", "/write?db=telegraf&precision=h", "cpu,host=a usage=1 1\ncpu,host=a usage=1 9223372036854775\n", http.StatusBadRequest, "db", 3600000, 1},
+		{"bad precision", "/write?precision=d", "cpu,host=a usage=1 3\n", http.StatusBadRequest, "", 0, 0},
+	}
+	for _, tt := range tests {
+		written = nil
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.url, strings.NewReader(tt.body)))
+		if w.Code != tt.status {
+			t.Fatalf("%s: expected status %d, got %d %s", tt.name, tt.status, w.Code, w.Body.String())
+		}
+		if len(written) != tt.n {
+			t.Fatalf("%s: expected %d series, got %d", tt.name, tt.n, len(written))
+		}
+		if tt.name == "partial" && !strings.Contains(w.Body.String(), "2 lines are invalid") {
+			t.Fatalf("%s: unexpected body %s", tt.name, w.Body.String())
+		}
+		if tt.n == 0 {
+			continue
+		}
+		if ts := written[0].Samples[0].Timestamp; ts != tt.ts {
+			t.Fatalf("%s: expected timestamp %d, got %d", tt.name, tt.ts, ts)
+		}
+		found := false
+		for _, l := range written[0].Labels {
+			if l.Name == tt.label {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("%s: expected label %s in %v", tt.name, tt.label, written[0].Labels)
+		}
+	}
+}
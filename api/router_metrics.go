@@ -0,0 +1,140 @@
+package api
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/prometheus/prompb"
+	"google.golang.org/protobuf/proto"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/stringx"
+	"flashcat.cloud/categraf/writer"
+)
+
+// exposeMetrics serves the latest value of every series collected by inputs
+// and received by push apis, in prometheus text or openmetrics format
+func exposeMetrics(c *gin.Context) {
+	suffixes := config.Config.HTTP.ExposeCounterSuffixes
+	if suffixes == nil {
+		suffixes = []string{"_total"}
+	}
+	families := toMetricFamilies(writer.ExposedSeries(), suffixes)
+
+	format := expfmt.NegotiateIncludingOpenMetrics(c.Request.Header)
+	c.Header("Content-Type", string(format))
+	enc := expfmt.NewEncoder(c.Writer, format)
+	for _, mf := range families {
+		if err := enc.Encode(mf); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+	if closer, ok := enc.(expfmt.Closer); ok {
+		closer.Close()
+	}
+}
+
+// toMetricFamilies groups series by metric name, timestamps are not exposed
+// so that prometheus handles staleness by itself. names with counterSuffixes
+// are counters and other floats are gauges
+func toMetricFamilies(series []prompb.TimeSeries, counterSuffixes []string) []*dto.MetricFamily {
+	families := make(map[string]*dto.MetricFamily)
+	for i := range series {
+		ts := &series[i]
+		var name string
+		labels := make([]*dto.LabelPair, 0, len(ts.Labels))
+		for _, l := range ts.Labels {
+			if l.Name == "__name__" {
+				name = l.Value
+				continue
+			}
+			labels = append(labels, &dto.LabelPair{Name: proto.String(l.Name), Value: proto.String(l.Value)})
+		}
+		if name == "" {
+			continue
+		}
+		sort.Slice(labels, func(i, j int) bool { return labels[i].GetName() < labels[j].GetName() })
+
+		var typ dto.MetricType
+		m := &dto.Metric{Label: labels}
+		switch {
+		case len(ts.Histograms) > 0:
+			typ = dto.MetricType_HISTOGRAM
+			m.Histogram = toDtoHistogram(&ts.Histograms[0])
+		case stringx.HasAnySuffix(name, counterSuffixes):
+			typ = dto.MetricType_COUNTER
+			m.Counter = &dto.Counter{Value: proto.Float64(ts.Samples[0].Value)}
+		default:
+			typ = dto.MetricType_GAUGE
+			m.Gauge = &dto.Gauge{Value: proto.Float64(ts.Samples[0].Value)}
+		}
+
+		mf, has := families[name]
+		if !has {
+			mf = &dto.MetricFamily{Name: proto.String(name), Type: typ.Enum()}
+			families[name] = mf
+		}
+		if mf.GetType() != typ {
+			// a name is either a float or a native histogram
+			continue
+		}
+		mf.Metric = append(mf.Metric, m)
+	}
+
+	ret := make([]*dto.MetricFamily, 0, len(families))
+	for _, mf := range families {
+		sort.Slice(mf.Metric, func(i, j int) bool {
+			return labelsString(mf.Metric[i].Label) < labelsString(mf.Metric[j].Label)
+		})
+		ret = append(ret, mf)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].GetName() < ret[j].GetName() })
+	return ret
+}
+
+func labelsString(labels []*dto.LabelPair) string {
+	var b strings.Builder
+	for _, l := range labels {
+		b.WriteString(l.GetName())
+		b.WriteByte('=')
+		b.WriteString(l.GetValue())
+		b.WriteByte(',')
+	}
+	return b.String()
+}
+
+func toDtoHistogram(h *prompb.Histogram) *dto.Histogram {
+	ret := &dto.Histogram{
+		SampleSum:     proto.Float64(h.Sum),
+		Schema:        proto.Int32(h.Schema),
+		ZeroThreshold: proto.Float64(h.ZeroThreshold),
+		PositiveSpan:  toDtoSpans(h.PositiveSpans),
+		NegativeSpan:  toDtoSpans(h.NegativeSpans),
+		PositiveDelta: h.PositiveDeltas,
+		NegativeDelta: h.NegativeDeltas,
+		PositiveCount: h.PositiveCounts,
+		NegativeCount: h.NegativeCounts,
+	}
+	if _, ok := h.Count.(*prompb.Histogram_CountFloat); ok {
+		ret.SampleCountFloat = proto.Float64(h.GetCountFloat())
+		ret.ZeroCountFloat = proto.Float64(h.GetZeroCountFloat())
+		ret.SampleCount = proto.Uint64(uint64(math.Round(h.GetCountFloat())))
+	} else {
+		ret.SampleCount = proto.Uint64(h.GetCountInt())
+		ret.ZeroCount = proto.Uint64(h.GetZeroCountInt())
+	}
+	return ret
+}
+
+func toDtoSpans(spans []prompb.BucketSpan) []*dto.BucketSpan {
+	ret := make([]*dto.BucketSpan, 0, len(spans))
+	for _, s := range spans {
+		ret = append(ret, &dto.BucketSpan{Offset: proto.Int32(s.Offset), Length: proto.Uint32(s.Length)})
+	}
+	return ret
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+func TestToMetricFamilies(t *testing.T) {
+	series := []prompb.TimeSeries{
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "http_requests_total"}, {Name: "code", Value: "500"}},
+			Samples: []prompb.Sample{{Value: 3}},
+		},
+		{
+			Labels:  []prompb.Label{{Name: "code", Value: "200"}, {Name: "__name__", Value: "http_requests_total"}},
+			Samples: []prompb.Sample{{Value: 10}},
+		},
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "cpu_usage_idle"}},
+			Samples: []prompb.Sample{{Value: 90}},
+		},
+		{
+			Labels: []prompb.Label{{Name: "__name__", Value: "latency"}},
+			Histograms: []prompb.Histogram{{
+				Count:          &prompb.Histogram_CountInt{CountInt: 2},
+				ZeroCount:      &prompb.Histogram_ZeroCountInt{ZeroCountInt: 0},
+				Sum:            3,
+				PositiveSpans:  []prompb.BucketSpan{{Offset: 0, Length: 1}},
+				PositiveDeltas: []int64{2},
+			}},
+		},
+		{
+			// series without a name are skipped
+			Labels:  []prompb.Label{{Name: "host", Value: "a"}},
+			Samples: []prompb.Sample{{Value: 1}},
+		},
+	}
+
+	families := toMetricFamilies(series, []string{"_total"})
+	if len(families) != 3 {
+		t.Fatalf("expected 3 families, got %d", len(families))
+	}
+	types := map[string]dto.MetricType{
+		"cpu_usage_idle":      dto.MetricType_GAUGE,
+		"http_requests_total": dto.MetricType_COUNTER,
+		"latency":             dto.MetricType_HISTOGRAM,
+	}
+	for _, mf := range families {
+		if mf.GetType() != types[mf.GetName()] {
+			t.Fatalf("unexpected type of %s: %v", mf.GetName(), mf.GetType())
+		}
+	}
+	requests := families[1]
+	if len(requests.Metric) != 2 || requests.Metric[0].Label[0].GetValue() != "200" || requests.Metric[0].Counter.GetValue() != 10 {
+		t.Fatalf("unexpected metrics of http_requests_total: %v", requests.Metric)
+	}
+
+	var buf bytes.Buffer
+	enc := expfmt.NewEncoder(&buf, expfmt.NewFormat(expfmt.TypeTextPlain))
+	for _, mf := range families[:2] {
+		if err := enc.Encode(mf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, line := range []string{
+		"# TYPE cpu_usage_idle gauge",
+		"# TYPE http_requests_total counter",
+		`http_requests_total{code="200"} 10`,
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Fatalf("expected %q in:\n%s", line, buf.String())
+		}
+	}
+}
@@ -14,7 +14,6 @@ import (
 	"github.com/prometheus/prometheus/prompb"
 
 	"flashcat.cloud/categraf/config"
-	"flashcat.cloud/categraf/writer"
 )
 
 type Metric struct {
@@ -195,6 +194,8 @@ func openTSDB(c *gin.Context) {
 		log.Println("opentsdb forwarder error, message:", string(bytes))
 	}
 
-	writer.WriteTimeSeries(series)
+	if !pushTimeSeries(c, series) {
+		return
+	}
 	c.String(200, "succ:%d fail:%d message:%s", succ, fail, msg)
 }
@@ -0,0 +1,554 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/prometheus/prompb"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/types"
+)
+
+const (
+	otlpContentTypeProtobuf = "application/x-protobuf"
+	otlpContentTypeJSON     = "application/json"
+
+	// native histogram supports schema -4 to 8
+	nativeHistogramMaxSchema = 8
+	nativeHistogramMinSchema = -4
+	// otlp supports scale -10 to 20
+	otlpMaxScale = 20
+
+	// delta exponential histograms are scaled down to keep the buckets of the
+	// cumulative one within this index span
+	otlpMaxBucketSpan = 160
+)
+
+// otlpWrite accepts otlp/http ExportMetricsServiceRequest in protobuf or json
+func otlpWrite(c *gin.Context) {
+	bytes, err := readerGzipBody(c.GetHeader("Content-Encoding"), c.Request)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	contentType := c.ContentType()
+	req := pmetricotlp.NewExportRequest()
+	switch contentType {
+	case otlpContentTypeJSON:
+		err = req.UnmarshalJSON(bytes)
+	default:
+		contentType = otlpContentTypeProtobuf
+		err = req.UnmarshalProto(bytes)
+	}
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	opts := otlpOptions{
+		ignoreHostname:     config.Config.HTTP.IgnoreHostname || QueryBoolWithValues("ignore_hostname")(c),
+		ignoreGlobalLabels: config.Config.HTTP.IgnoreGlobalLabels || QueryBoolWithValues("ignore_global_labels")(c),
+	}
+	if !pushSamples(c, otlpToSamples(req.Metrics(), opts)) {
+		return
+	}
+
+	resp := pmetricotlp.NewExportResponse()
+	var body []byte
+	if contentType == otlpContentTypeJSON {
+		body, err = resp.MarshalJSON()
+	} else {
+		body, err = resp.MarshalProto()
+	}
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.Data(http.StatusOK, contentType, body)
+}
+
+type otlpOptions struct {
+	ignoreHostname     bool
+	ignoreGlobalLabels bool
+}
+
+// otlpToSamples converts otlp metrics into samples, resource attributes and data point
+// attributes become labels, delta sums and histograms are accumulated into cumulative ones
+func otlpToSamples(md pmetric.Metrics, opts otlpOptions) []*types.Sample {
+	var (
+		ret []*types.Sample
+		now = time.Now()
+	)
+
+	rms := md.ResourceMetrics()
+	for i := 0; i < rms.Len(); i++ {
+		resource := attributesToLabels(rms.At(i).Resource().Attributes(), nil)
+		sms := rms.At(i).ScopeMetrics()
+		for j := 0; j < sms.Len(); j++ {
+			ms := sms.At(j).Metrics()
+			for k := 0; k < ms.Len(); k++ {
+				ret = append(ret, otlpMetricToSamples(ms.At(k), resource, now)...)
+			}
+		}
+	}
+
+	for _, s := range ret {
+		// add global labels
+		if !opts.ignoreGlobalLabels {
+			for k, v := range config.GlobalLabels() {
+				if _, has := s.Labels[k]; has {
+					continue
+				}
+				s.Labels[k] = v
+			}
+		}
+		// add label: agent_hostname
+		if _, has := s.Labels[agentHostnameLabelKey]; !has && !opts.ignoreHostname {
+			s.Labels[agentHostnameLabelKey] = config.Config.GetHostname()
+		}
+	}
+	return ret
+}
+
+func otlpMetricToSamples(m pmetric.Metric, resource map[string]string, now time.Time) []*types.Sample {
+	var ret []*types.Sample
+	name := m.Name()
+
+	switch m.Type() {
+	case pmetric.MetricTypeGauge:
+		points := m.Gauge().DataPoints()
+		for i := 0; i < points.Len(); i++ {
+			if s := numberSample(name, points.At(i), resource, now); s != nil {
+				ret = append(ret, s)
+			}
+		}
+	case pmetric.MetricTypeSum:
+		delta := m.Sum().AggregationTemporality() == pmetric.AggregationTemporalityDelta
+		points := m.Sum().DataPoints()
+		for i := 0; i < points.Len(); i++ {
+			s := numberSample(name, points.At(i), resource, now)
+			if s == nil {
+				continue
+			}
+			if delta {
+				s.Value = otlpDeltas.add(s, s.Value.(float64))
+			}
+			ret = append(ret, s)
+		}
+	case pmetric.MetricTypeHistogram:
+		delta := m.Histogram().AggregationTemporality() == pmetric.AggregationTemporalityDelta
+		points := m.Histogram().DataPoints()
+		for i := 0; i < points.Len(); i++ {
+			ss := histogramSamples(name, points.At(i), resource, now)
+			if delta {
+				for _, s := range ss {
+					s.Value = otlpDeltas.add(s, s.Value.(float64))
+				}
+			}
+			ret = append(ret, ss...)
+		}
+	case pmetric.MetricTypeExponentialHistogram:
+		delta := m.ExponentialHistogram().AggregationTemporality() == pmetric.AggregationTemporalityDelta
+		points := m.ExponentialHistogram().DataPoints()
+		for i := 0; i < points.Len(); i++ {
+			dp := points.At(i)
+			if delta {
+				if dp.Flags().NoRecordedValue() || dp.Scale() < nativeHistogramMinSchema || dp.Scale() > otlpMaxScale {
+					continue
+				}
+				var ok bool
+				if dp, ok = otlpDeltas.addHistogram(name, attributesToLabels(dp.Attributes(), resource), dp); !ok {
+					continue
+				}
+			}
+			if s := exponentialHistogramSample(name, dp, resource, now); s != nil {
+				ret = append(ret, s)
+			}
+		}
+	case pmetric.MetricTypeSummary:
+		points := m.Summary().DataPoints()
+		for i := 0; i < points.Len(); i++ {
+			ret = append(ret, summarySamples(name, points.At(i), resource, now)...)
+		}
+	}
+	return ret
+}
+
+func numberSample(name string, dp pmetric.NumberDataPoint, resource map[string]string, now time.Time) *types.Sample {
+	if dp.Flags().NoRecordedValue() {
+		return nil
+	}
+	var value float64
+	switch dp.ValueType() {
+	case pmetric.NumberDataPointValueTypeDouble:
+		value = dp.DoubleValue()
+	case pmetric.NumberDataPointValueTypeInt:
+		value = float64(dp.IntValue())
+	default:
+		return nil
+	}
+	s := types.NewSample("", name, value, attributesToLabels(dp.Attributes(), resource)).SetTime(otlpTime(dp.Timestamp(), now))
+	s.Exemplars = otlpExemplars(dp.Exemplars())
+	return s
+}
+
+func histogramSamples(name string, dp pmetric.HistogramDataPoint, resource map[string]string, now time.Time) []*types.Sample {
+	if dp.Flags().NoRecordedValue() {
+		return nil
+	}
+	var (
+		labels = attributesToLabels(dp.Attributes(), resource)
+		ts     = otlpTime(dp.Timestamp(), now)
+		ret    = make([]*types.Sample, 0, dp.BucketCounts().Len()+3)
+	)
+
+	ret = append(ret, types.NewSample("", name+"_count", float64(dp.Count()), labels).SetTime(ts))
+	if dp.HasSum() {
+		ret = append(ret, types.NewSample("", name+"_sum", dp.Sum(), labels).SetTime(ts))
+	}
+
+	var cumulative uint64
+	bounds := dp.ExplicitBounds()
+	for i := 0; i < dp.BucketCounts().Len() && i < bounds.Len(); i++ {
+		cumulative += dp.BucketCounts().At(i)
+		le := strconv.FormatFloat(bounds.At(i), 'g', -1, 64)
+		ret = append(ret, types.NewSample("", name+"_bucket", float64(cumulative), labels, map[string]string{"le": le}).SetTime(ts))
+	}
+	ret = append(ret, types.NewSample("", name+"_bucket", float64(dp.Count()), labels, map[string]string{"le": "+Inf"}).SetTime(ts))
+	return ret
+}
+
+func summarySamples(name string, dp pmetric.SummaryDataPoint, resource map[string]string, now time.Time) []*types.Sample {
+	if dp.Flags().NoRecordedValue() {
+		return nil
+	}
+	var (
+		labels = attributesToLabels(dp.Attributes(), resource)
+		ts     = otlpTime(dp.Timestamp(), now)
+		ret    = make([]*types.Sample, 0, dp.QuantileValues().Len()+2)
+	)
+
+	ret = append(ret, types.NewSample("", name+"_count", float64(dp.Count()), labels).SetTime(ts))
+	ret = append(ret, types.NewSample("", name+"_sum", dp.Sum(), labels).SetTime(ts))
+	for i := 0; i < dp.QuantileValues().Len(); i++ {
+		q := dp.QuantileValues().At(i)
+		quantile := strconv.FormatFloat(q.Quantile(), 'g', -1, 64)
+		ret = append(ret, types.NewSample("", name, q.Value(), labels, map[string]string{"quantile": quantile}).SetTime(ts))
+	}
+	return ret
+}
+
+// exponentialHistogramSample converts an exponential histogram to a native histogram,
+// the bucket index of otlp is one less than the index of prometheus
+func exponentialHistogramSample(name string, dp pmetric.ExponentialHistogramDataPoint, resource map[string]string, now time.Time) *types.Sample {
+	if dp.Flags().NoRecordedValue() {
+		return nil
+	}
+	scale := dp.Scale()
+	if scale < nativeHistogramMinSchema {
+		return nil
+	}
+	var scaleDown int32
+	if scale > nativeHistogramMaxSchema {
+		scaleDown = scale - nativeHistogramMaxSchema
+		scale = nativeHistogramMaxSchema
+	}
+
+	h := &prompb.Histogram{
+		Count:         &prompb.Histogram_CountInt{CountInt: dp.Count()},
+		Sum:           dp.Sum(),
+		Schema:        scale,
+		ZeroThreshold: dp.ZeroThreshold(),
+		ZeroCount:     &prompb.Histogram_ZeroCountInt{ZeroCountInt: dp.ZeroCount()},
+		ResetHint:     prompb.Histogram_UNKNOWN,
+	}
+	h.PositiveSpans, h.PositiveDeltas = nativeBuckets(dp.Positive(), scaleDown)
+	h.NegativeSpans, h.NegativeDeltas = nativeBuckets(dp.Negative(), scaleDown)
+
+	s := types.NewSample("", name, nil, attributesToLabels(dp.Attributes(), resource)).SetTime(otlpTime(dp.Timestamp(), now))
+	s.Histogram = h
+	s.Exemplars = otlpExemplars(dp.Exemplars())
+	return s
+}
+
+// nativeBuckets merges buckets by scaleDown and encodes them as spans and deltas
+func nativeBuckets(buckets pmetric.ExponentialHistogramDataPointBuckets, scaleDown int32) ([]prompb.BucketSpan, []int64) {
+	type bucket struct {
+		index int32
+		count uint64
+	}
+
+	counts := buckets.BucketCounts()
+	merged := make([]bucket, 0, counts.Len())
+	for i := 0; i < counts.Len(); i++ {
+		index := (buckets.Offset()+int32(i))>>scaleDown + 1
+		if n := len(merged); n > 0 && merged[n-1].index == index {
+			merged[n-1].count += counts.At(i)
+			continue
+		}
+		merged = append(merged, bucket{index: index, count: counts.At(i)})
+	}
+
+	var (
+		spans  []prompb.BucketSpan
+		deltas []int64
+		prev   int64
+		// index of the bucket following the current span
+		next int32
+	)
+	for _, b := range merged {
+		if b.count == 0 {
+			continue
+		}
+		if len(spans) == 0 {
+			spans = append(spans, prompb.BucketSpan{Offset: b.index})
+		} else if b.index != next {
+			spans = append(spans, prompb.BucketSpan{Offset: b.index - next})
+		}
+		spans[len(spans)-1].Length++
+		deltas = append(deltas, int64(b.count)-prev)
+		prev = int64(b.count)
+		next = b.index + 1
+	}
+	return spans, deltas
+}
+
+func otlpExemplars(es pmetric.ExemplarSlice) []prompb.Exemplar {
+	if es.Len() == 0 {
+		return nil
+	}
+	ret := make([]prompb.Exemplar, 0, es.Len())
+	for i := 0; i < es.Len(); i++ {
+		e := es.At(i)
+		ex := prompb.Exemplar{Timestamp: e.Timestamp().AsTime().UnixMilli()}
+		switch e.ValueType() {
+		case pmetric.ExemplarValueTypeDouble:
+			ex.Value = e.DoubleValue()
+		case pmetric.ExemplarValueTypeInt:
+			ex.Value = float64(e.IntValue())
+		}
+		if traceID := e.TraceID(); !traceID.IsEmpty() {
+			ex.Labels = append(ex.Labels, prompb.Label{Name: "trace_id", Value: traceID.String()})
+		}
+		if spanID := e.SpanID(); !spanID.IsEmpty() {
+			ex.Labels = append(ex.Labels, prompb.Label{Name: "span_id", Value: spanID.String()})
+		}
+		ret = append(ret, ex)
+	}
+	return ret
+}
+
+func attributesToLabels(attrs pcommon.Map, base map[string]string) map[string]string {
+	labels := make(map[string]string, len(base)+attrs.Len())
+	for k, v := range base {
+		labels[k] = v
+	}
+	attrs.Range(func(k string, v pcommon.Value) bool {
+		labels[k] = v.AsString()
+		return true
+	})
+	return labels
+}
+
+func otlpTime(ts pcommon.Timestamp, now time.Time) time.Time {
+	if ts == 0 {
+		return now
+	}
+	return ts.AsTime()
+}
+
+// series not updated for this long are dropped from the delta state
+const otlpDeltaExpire = 10 * time.Minute
+
+// deltaCumulator sums up delta points of a series into a cumulative value
+type deltaCumulator struct {
+	lock       sync.Mutex
+	series     map[string]*deltaState
+	lastExpire time.Time
+}
+
+type deltaState struct {
+	value    float64
+	hist     *expHistogram
+	lastSeen time.Time
+}
+
+// expHistogram is the cumulative exponential histogram of delta points,
+// buckets are kept at the lowest scale seen so far
+type expHistogram struct {
+	scale         int32
+	count         uint64
+	sum           float64
+	zeroCount     uint64
+	zeroThreshold float64
+	positive      map[int32]uint64
+	negative      map[int32]uint64
+}
+
+var otlpDeltas = &deltaCumulator{series: make(map[string]*deltaState)}
+
+func (d *deltaCumulator) add(s *types.Sample, delta float64) float64 {
+	key := types.SeriesKey(s.Metric, s.Labels)
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	st := d.state(key, time.Now())
+	if !math.IsNaN(delta) {
+		st.value += delta
+	}
+	return st.value
+}
+
+// addHistogram accumulates a delta exponential histogram point, the returned
+// point is cumulative and keeps timestamps, attributes and exemplars of dp.
+// it returns false if the buckets span too wide even at the lowest schema.
+func (d *deltaCumulator) addHistogram(name string, labels map[string]string, dp pmetric.ExponentialHistogramDataPoint) (pmetric.ExponentialHistogramDataPoint, bool) {
+	key := types.SeriesKey(name, labels)
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	st := d.state(key, time.Now())
+	h := st.hist
+	if h == nil {
+		h = &expHistogram{
+			scale:    min(dp.Scale(), nativeHistogramMaxSchema),
+			positive: make(map[int32]uint64),
+			negative: make(map[int32]uint64),
+		}
+	}
+	scale, ok := fitScale(h, dp)
+	if !ok {
+		return dp, false
+	}
+	st.hist = h
+	if scale < h.scale {
+		h.positive = scaleDownBuckets(h.positive, h.scale-scale)
+		h.negative = scaleDownBuckets(h.negative, h.scale-scale)
+		h.scale = scale
+	}
+	scaleDown := dp.Scale() - h.scale
+
+	h.count += dp.Count()
+	h.sum += dp.Sum()
+	h.zeroCount += dp.ZeroCount()
+	if dp.ZeroThreshold() > h.zeroThreshold {
+		h.zeroThreshold = dp.ZeroThreshold()
+	}
+	addBuckets(h.positive, dp.Positive(), scaleDown)
+	addBuckets(h.negative, dp.Negative(), scaleDown)
+
+	ret := pmetric.NewExponentialHistogramDataPoint()
+	dp.CopyTo(ret)
+	ret.SetScale(h.scale)
+	ret.SetCount(h.count)
+	ret.SetSum(h.sum)
+	ret.SetZeroCount(h.zeroCount)
+	ret.SetZeroThreshold(h.zeroThreshold)
+	setBuckets(ret.Positive(), h.positive)
+	setBuckets(ret.Negative(), h.negative)
+	return ret, true
+}
+
+// fitScale returns the highest scale not above the one of h, at which the buckets
+// of h and dp together span at most otlpMaxBucketSpan indexes
+func fitScale(h *expHistogram, dp pmetric.ExponentialHistogramDataPoint) (int32, bool) {
+	for scale := min(h.scale, dp.Scale()); scale >= nativeHistogramMinSchema; scale-- {
+		if bucketSpan(h.positive, h.scale, dp.Positive(), dp.Scale(), scale) <= otlpMaxBucketSpan &&
+			bucketSpan(h.negative, h.scale, dp.Negative(), dp.Scale(), scale) <= otlpMaxBucketSpan {
+			return scale, true
+		}
+	}
+	return 0, false
+}
+
+// bucketSpan returns the index span of the buckets of the state and the point at
+// the given scale, indexes are int64 as offsets of the point are not trusted
+func bucketSpan(state map[int32]uint64, stateScale int32, buckets pmetric.ExponentialHistogramDataPointBuckets, pointScale, scale int32) int64 {
+	lo, hi := int64(math.MaxInt64), int64(math.MinInt64)
+	for index := range state {
+		lo = min(lo, int64(index)>>(stateScale-scale))
+		hi = max(hi, int64(index)>>(stateScale-scale))
+	}
+	counts := buckets.BucketCounts()
+	for i := 0; i < counts.Len(); i++ {
+		if counts.At(i) > 0 {
+			index := (int64(buckets.Offset()) + int64(i)) >> (pointScale - scale)
+			lo = min(lo, index)
+			hi = max(hi, index)
+		}
+	}
+	if lo > hi {
+		return 0
+	}
+	if hi > math.MaxInt32 {
+		return math.MaxInt64
+	}
+	return hi - lo + 1
+}
+
+func scaleDownBuckets(buckets map[int32]uint64, scaleDown int32) map[int32]uint64 {
+	ret := make(map[int32]uint64, len(buckets))
+	for index, count := range buckets {
+		ret[index>>scaleDown] += count
+	}
+	return ret
+}
+
+func addBuckets(dst map[int32]uint64, buckets pmetric.ExponentialHistogramDataPointBuckets, scaleDown int32) {
+	counts := buckets.BucketCounts()
+	for i := 0; i < counts.Len(); i++ {
+		if counts.At(i) > 0 {
+			dst[int32((int64(buckets.Offset())+int64(i))>>scaleDown)] += counts.At(i)
+		}
+	}
+}
+
+func setBuckets(dst pmetric.ExponentialHistogramDataPointBuckets, buckets map[int32]uint64) {
+	if len(buckets) == 0 {
+		dst.SetOffset(0)
+		dst.BucketCounts().FromRaw(nil)
+		return
+	}
+	lo, hi := int32(math.MaxInt32), int32(math.MinInt32)
+	for index := range buckets {
+		lo = min(lo, index)
+		hi = max(hi, index)
+	}
+	counts := make([]uint64, hi-lo+1)
+	for index, count := range buckets {
+		counts[index-lo] = count
+	}
+	dst.SetOffset(lo)
+	dst.BucketCounts().FromRaw(counts)
+}
+
+// state returns the state of the series, the caller holds the lock
+func (d *deltaCumulator) state(key string, now time.Time) *deltaState {
+	if now.Sub(d.lastExpire) > otlpDeltaExpire {
+		for k, st := range d.series {
+			if now.Sub(st.lastSeen) > otlpDeltaExpire {
+				delete(d.series, k)
+			}
+		}
+		d.lastExpire = now
+	}
+
+	st, has := d.series[key]
+	if !has {
+		st = &deltaState{}
+		d.series[key] = st
+	}
+	st.lastSeen = now
+	return st
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"math"
+	"testing"
+
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+func TestOtlpToSamples(t *testing.T) {
+	md := pmetric.NewMetrics()
+	rm := md.ResourceMetrics().AppendEmpty()
+	rm.Resource().Attributes().PutStr("service.name", "api")
+	ms := rm.ScopeMetrics().AppendEmpty().Metrics()
+
+	sum := ms.AppendEmpty()
+	sum.SetName("http.requests")
+	sum.SetEmptySum().SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+	dp := sum.Sum().DataPoints().AppendEmpty()
+	dp.SetIntValue(3)
+	dp.Attributes().PutStr("code", "200")
+
+	hist := ms.AppendEmpty()
+	hist.SetName("latency")
+	hist.SetEmptyHistogram().SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+	hdp := hist.Histogram().DataPoints().AppendEmpty()
+	hdp.SetCount(3)
+	hdp.SetSum(1.5)
+	hdp.ExplicitBounds().FromRaw([]float64{0.1, 1})
+	hdp.BucketCounts().FromRaw([]uint64{1, 1, 1})
+
+	opts := otlpOptions{ignoreHostname: true, ignoreGlobalLabels: true}
+	samples := otlpToSamples(md, opts)
+	if len(samples) != 6 {
+		t.Fatalf("expected 6 samples, got %d", len(samples))
+	}
+	if samples[0].Metric != "http_requests" || samples[0].Value != 3.0 ||
+		samples[0].Labels["service.name"] != "api" || samples[0].Labels["code"] != "200" {
+		t.Fatalf("unexpected sum sample: %v", samples[0])
+	}
+
+	// delta points are accumulated
+	samples = otlpToSamples(md, opts)
+	if samples[0].Value != 6.0 {
+		t.Fatalf("expected accumulated value 6, got %v", samples[0].Value)
+	}
+
+	buckets := map[string]float64{}
+	for _, s := range samples {
+		if s.Metric == "latency_bucket" {
+			buckets[s.Labels["le"]] = s.Value.(float64)
+		}
+	}
+	if buckets["0.1"] != 1 || buckets["1"] != 2 || buckets["+Inf"] != 3 {
+		t.Fatalf("unexpected buckets: %v", buckets)
+	}
+}
+
+func TestNativeBuckets(t *testing.T) {
+	dp := pmetric.NewExponentialHistogramDataPoint()
+	dp.Positive().SetOffset(-1)
+	dp.Positive().BucketCounts().FromRaw([]uint64{1, 2, 0, 0, 4})
+
+	spans, deltas := nativeBuckets(dp.Positive(), 0)
+	if len(spans) != 2 || spans[0].Offset != 0 || spans[0].Length != 2 || spans[1].Offset != 2 || spans[1].Length != 1 {
+		t.Fatalf("unexpected spans: %v", spans)
+	}
+	if len(deltas) != 3 || deltas[0] != 1 || deltas[1] != 1 || deltas[2] != 2 {
+		t.Fatalf("unexpected deltas: %v", deltas)
+	}
+
+	// scale down by 1 merges pairs of buckets
+	spans, deltas = nativeBuckets(dp.Positive(), 1)
+	if len(spans) != 1 || spans[0].Offset != 0 || spans[0].Length != 3 || deltas[0] != 1 || deltas[1] != 1 || deltas[2] != 2 {
+		t.Fatalf("unexpected scaled spans: %v %v", spans, deltas)
+	}
+}
+
+func TestDeltaExponentialHistogram(t *testing.T) {
+	md := pmetric.NewMetrics()
+	m := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	m.SetName("delta_latency")
+	eh := m.SetEmptyExponentialHistogram()
+	eh.SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+	dp := eh.DataPoints().AppendEmpty()
+	dp.SetScale(1)
+	dp.SetCount(3)
+	dp.SetSum(6)
+	dp.Positive().SetOffset(0)
+	dp.Positive().BucketCounts().FromRaw([]uint64{1, 2})
+
+	opts := otlpOptions{ignoreHostname: true, ignoreGlobalLabels: true}
+	otlpToSamples(md, opts)
+
+	// the second point has a lower scale, the state is scaled down to it
+	dp.SetScale(0)
+	dp.SetCount(1)
+	dp.SetSum(1)
+	dp.Positive().BucketCounts().FromRaw([]uint64{1})
+	samples := otlpToSamples(md, opts)
+	if len(samples) != 1 || samples[0].Histogram == nil {
+		t.Fatalf("expected one native histogram, got %v", samples)
+	}
+	h := samples[0].Histogram
+	if h.GetCountInt() != 4 || h.Sum != 7 || h.Schema != 0 {
+		t.Fatalf("unexpected histogram: %v", h)
+	}
+	// buckets 0 and 1 of scale 1 merge into bucket 0 of scale 0
+	if len(h.PositiveSpans) != 1 || h.PositiveSpans[0].Offset != 1 || h.PositiveSpans[0].Length != 1 || h.PositiveDeltas[0] != 4 {
+		t.Fatalf("unexpected buckets: %v %v", h.PositiveSpans, h.PositiveDeltas)
+	}
+}
+
+func TestDeltaExponentialHistogramSpan(t *testing.T) {
+	md := pmetric.NewMetrics()
+	m := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	m.SetName("delta_span")
+	eh := m.SetEmptyExponentialHistogram()
+	eh.SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+	dp := eh.DataPoints().AppendEmpty()
+	dp.SetScale(0)
+	dp.SetCount(2)
+	counts := make([]uint64, 301)
+	counts[0], counts[300] = 1, 1
+	dp.Positive().BucketCounts().FromRaw(counts)
+
+	// buckets 0 and 300 span too wide at scale 0, they are 0 and 150 at scale -1
+	opts := otlpOptions{ignoreHostname: true, ignoreGlobalLabels: true}
+	samples := otlpToSamples(md, opts)
+	if len(samples) != 1 || samples[0].Histogram.Schema != -1 {
+		t.Fatalf("expected a histogram of schema -1, got %v", samples)
+	}
+
+	// extreme offsets span too wide even at the lowest schema
+	dp.SetCount(1)
+	dp.Positive().SetOffset(math.MaxInt32)
+	dp.Positive().BucketCounts().FromRaw([]uint64{1})
+	dp.Negative().SetOffset(math.MinInt32)
+	dp.Negative().BucketCounts().FromRaw([]uint64{1})
+	if samples := otlpToSamples(md, opts); len(samples) != 0 {
+		t.Fatalf("expected the point rejected, got %v", samples)
+	}
+	dp.Negative().BucketCounts().FromRaw(nil)
+	if samples := otlpToSamples(md, opts); len(samples) != 0 {
+		t.Fatalf("expected the point rejected, got %v", samples)
+	}
+
+	// the state is kept after rejected points
+	dp.Positive().SetOffset(2)
+	samples = otlpToSamples(md, opts)
+	if len(samples) != 1 || samples[0].Histogram.GetCountInt() != 3 || samples[0].Histogram.Schema != -1 {
+		t.Fatalf("unexpected histogram: %v", samples)
+	}
+}
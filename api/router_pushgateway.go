@@ -13,7 +13,6 @@ import (
 	"flashcat.cloud/categraf/config"
 	"flashcat.cloud/categraf/parser/prometheus"
 	"flashcat.cloud/categraf/types"
-	"flashcat.cloud/categraf/writer"
 )
 
 const (
@@ -114,7 +113,9 @@ func pushgateway(c *gin.Context) {
 			}
 		}
 	}
-	writer.WriteSamples(samples)
+	if !pushSamples(c, samples) {
+		return
+	}
 	c.String(http.StatusOK, "forwarding...")
 }
 
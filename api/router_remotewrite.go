@@ -7,7 +7,6 @@ import (
 	"github.com/prometheus/prometheus/prompb"
 
 	"flashcat.cloud/categraf/config"
-	"flashcat.cloud/categraf/writer"
 )
 
 func remoteWrite(c *gin.Context) {
@@ -50,7 +49,9 @@ func remoteWrite(c *gin.Context) {
 		}
 	}
 
-	writer.WriteTimeSeries(req.Timeseries)
+	if !pushTimeSeries(c, req.Timeseries) {
+		return
+	}
 	c.String(200, "forwarding...")
 }
 
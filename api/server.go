@@ -1,7 +1,6 @@
 package api
 
 import (
-	"crypto/tls"
 	"log"
 	"net/http"
 	"strings"
@@ -39,8 +38,18 @@ func Start() {
 		r.Use(aop.Logger())
 	}
 
+	var err error
+	if guard, err = newPushGuard(conf); err != nil {
+		log.Println("E! failed to init http server:", err)
+		return
+	}
+
 	configRoutes(r)
 
+	if conf.OtlpGrpcAddress != "" {
+		go startOtlpGrpc(conf)
+	}
+
 	addr := config.Expand(conf.Address)
 	srv := &http.Server{
 		Addr:         addr,
@@ -52,9 +61,11 @@ func Start() {
 
 	log.Println("I! http server listening on:", addr)
 
-	var err error
 	if conf.CertFile != "" && conf.KeyFile != "" {
-		srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		if srv.TLSConfig, err = serverTLSConfig(conf); err != nil {
+			log.Println("E! failed to init http server:", err)
+			return
+		}
 		err = srv.ListenAndServeTLS(conf.CertFile, conf.KeyFile)
 	} else {
 		err = srv.ListenAndServe()
@@ -70,10 +81,11 @@ func configRoutes(r *gin.Engine) {
 		c.String(200, "pong")
 	})
 
-	g := r.Group("/api/push")
+	g := r.Group("/api/push", pushAuth())
 	g.POST("/opentsdb", openTSDB)
 	g.POST("/openfalcon", openFalcon)
 	g.POST("/remotewrite", remoteWrite)
+	g.POST("/influx", influxWrite)
 
 	// pushgateway
 	g.POST("/pushgateway", pushgateway)
@@ -81,4 +93,27 @@ func configRoutes(r *gin.Engine) {
 	g.POST("/pushgateway/metrics/:jobtype/:job", pushgateway)
 	g.PUT("/pushgateway/metrics/:jobtype/:job/*labels", pushgateway)
 	g.POST("/pushgateway/metrics/:jobtype/:job/*labels", pushgateway)
+
+	// otlp/http
+	g.POST("/otlp", otlpWrite)
+	r.POST("/v1/metrics", pushAuth(), otlpWrite)
+
+	// influxdb v1 and v2 compatible write api
+	r.POST("/write", pushAuth(), influxWrite)
+	r.POST("/api/v2/write", pushAuth(), influxWrite)
+
+	// agent management, only registered with admin_token set
+	if token := config.Config.HTTP.AdminToken; token != "" {
+		admin := r.Group("/api/admin", adminAuth(token))
+		admin.GET("/inputs", adminInputs)
+		admin.POST("/reload", adminReload)
+		admin.POST("/inputs/:name/reload", adminReloadInput)
+		admin.POST("/inputs/:name/gather", adminGather)
+		admin.GET("/schema", adminSchema)
+	}
+
+	// prometheus exposition of the latest collected values
+	if config.Config.HTTP.ExposeMetrics {
+		r.GET("/metrics", pushAuth(), exposeMetrics)
+	}
 }
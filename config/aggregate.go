@@ -0,0 +1,211 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"flashcat.cloud/categraf/pkg/conv"
+	"flashcat.cloud/categraf/pkg/filter"
+	"flashcat.cloud/categraf/pkg/metrics"
+	"flashcat.cloud/categraf/types"
+)
+
+// aggregation stats
+const (
+	AggregateMin   = "min"
+	AggregateMax   = "max"
+	AggregateMean  = "mean"
+	AggregateSum   = "sum"
+	AggregateCount = "count"
+)
+
+const defaultAggregateWindow = Duration(time.Minute)
+
+// ProcessorAggregate buffers samples over a window, groups them by labels and
+// emits <metric>_<stat> and <metric>_p<percentile> samples when the window ends
+type ProcessorAggregate struct {
+	Metrics       []string `toml:"metrics"` // support glob
+	MetricsFilter filter.Filter
+	Window        Duration `toml:"window"`
+	// labels kept on the aggregated samples, the others are dropped
+	GroupBy     []string  `toml:"group_by"`
+	Stats       []string  `toml:"stats"`
+	Percentiles []float64 `toml:"percentiles"`
+	// also emit the original samples
+	KeepOriginal bool `toml:"keep_original"`
+
+	lock   sync.Mutex
+	start  time.Time
+	groups map[string]*aggregateGroup
+}
+
+type aggregateGroup struct {
+	metric string
+	labels map[string]string
+	count  int
+	sum    float64
+	min    float64
+	max    float64
+	values []float64
+}
+
+func (pa *ProcessorAggregate) init() error {
+	var err error
+	if pa.MetricsFilter, err = filter.Compile(pa.Metrics); err != nil {
+		return err
+	}
+	if pa.MetricsFilter == nil {
+		return fmt.Errorf("processor_aggregate: metrics is required")
+	}
+
+	if pa.Window <= 0 {
+		pa.Window = defaultAggregateWindow
+	}
+	if len(pa.Stats) == 0 && len(pa.Percentiles) == 0 {
+		pa.Stats = []string{AggregateMin, AggregateMax, AggregateMean, AggregateSum, AggregateCount}
+	}
+	for _, stat := range pa.Stats {
+		switch stat {
+		case AggregateMin, AggregateMax, AggregateMean, AggregateSum, AggregateCount:
+		default:
+			return fmt.Errorf("processor_aggregate: unsupported stat: %s", stat)
+		}
+	}
+	for _, p := range pa.Percentiles {
+		if p <= 0 || p > 100 {
+			return fmt.Errorf("processor_aggregate: percentile %v out of range (0, 100]", p)
+		}
+	}
+
+	pa.groups = make(map[string]*aggregateGroup)
+	return nil
+}
+
+// add puts a sample into the group of its metric and group_by labels
+func (pa *ProcessorAggregate) add(s *types.Sample, now time.Time) bool {
+	if !pa.MetricsFilter.Match(s.Metric) {
+		return false
+	}
+	value, err := conv.ToFloat64(s.Value)
+	if err != nil || math.IsNaN(value) {
+		return false
+	}
+
+	var key strings.Builder
+	key.WriteString(s.Metric)
+	labels := make(map[string]string, len(pa.GroupBy))
+	for _, name := range pa.GroupBy {
+		v, has := s.Labels[name]
+		if !has {
+			continue
+		}
+		labels[name] = v
+		key.WriteByte(0xff)
+		key.WriteString(name)
+		key.WriteByte('=')
+		key.WriteString(v)
+	}
+
+	pa.lock.Lock()
+	defer pa.lock.Unlock()
+
+	if pa.start.IsZero() {
+		pa.start = now
+	}
+	g, has := pa.groups[key.String()]
+	if !has {
+		g = &aggregateGroup{metric: s.Metric, labels: labels, min: value, max: value}
+		pa.groups[key.String()] = g
+	}
+	g.count++
+	g.sum += value
+	if value < g.min {
+		g.min = value
+	}
+	if value > g.max {
+		g.max = value
+	}
+	if len(pa.Percentiles) > 0 {
+		g.values = append(g.values, value)
+	}
+	return true
+}
+
+// flush returns the aggregated samples if the window ends
+func (pa *ProcessorAggregate) flush(now time.Time) []*types.Sample {
+	pa.lock.Lock()
+	defer pa.lock.Unlock()
+
+	if pa.start.IsZero() || now.Sub(pa.start) < time.Duration(pa.Window) {
+		return nil
+	}
+
+	ret := make([]*types.Sample, 0, len(pa.groups)*(len(pa.Stats)+len(pa.Percentiles)))
+	for _, g := range pa.groups {
+		for _, stat := range pa.Stats {
+			var value float64
+			switch stat {
+			case AggregateMin:
+				value = g.min
+			case AggregateMax:
+				value = g.max
+			case AggregateMean:
+				value = g.sum / float64(g.count)
+			case AggregateSum:
+				value = g.sum
+			case AggregateCount:
+				value = float64(g.count)
+			}
+			ret = append(ret, g.sample(g.metric+"_"+stat, value, now))
+		}
+
+		if len(pa.Percentiles) > 0 {
+			sort.Float64s(g.values)
+			for _, p := range pa.Percentiles {
+				name := g.metric + "_p" + strings.ReplaceAll(strconv.FormatFloat(p, 'f', -1, 64), ".", "_")
+				ret = append(ret, g.sample(name, metrics.Percentile(g.values, p), now))
+			}
+		}
+	}
+
+	pa.start = time.Time{}
+	pa.groups = make(map[string]*aggregateGroup)
+	return ret
+}
+
+func (g *aggregateGroup) sample(metric string, value float64, ts time.Time) *types.Sample {
+	labels := make(map[string]string, len(g.labels))
+	for k, v := range g.labels {
+		labels[k] = v
+	}
+	return &types.Sample{
+		Metric:    metric,
+		Timestamp: ts,
+		Value:     value,
+		Labels:    labels,
+	}
+}
+
+// aggregate returns true if the sample is consumed by aggregators
+func (ic *InternalConfig) aggregate(s *types.Sample, now time.Time) bool {
+	consumed := false
+	for _, pa := range ic.ProcessorAggregate {
+		if pa.add(s, now) && !pa.KeepOriginal {
+			consumed = true
+		}
+	}
+	return consumed
+}
+
+func (ic *InternalConfig) flushAggregates(now time.Time) []*types.Sample {
+	var ret []*types.Sample
+	for _, pa := range ic.ProcessorAggregate {
+		ret = append(ret, pa.flush(now)...)
+	}
+	return ret
+}
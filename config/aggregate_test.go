@@ -0,0 +1,55 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"flashcat.cloud/categraf/types"
+)
+
+func TestProcessorAggregate(t *testing.T) {
+	pa := &ProcessorAggregate{
+		Metrics:     []string{"procstat_cpu_usage"},
+		Window:      Duration(time.Minute),
+		GroupBy:     []string{"process_name"},
+		Stats:       []string{AggregateMax, AggregateSum, AggregateCount},
+		Percentiles: []float64{50},
+	}
+	if err := pa.init(); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for i, v := range []float64{1, 2, 3, 4} {
+		s := types.NewSample("", "procstat_cpu_usage", v, map[string]string{"process_name": "nginx", "pid": string(rune('0' + i))})
+		if !pa.add(s, now) {
+			t.Fatal("expected sample to be aggregated")
+		}
+	}
+	if pa.add(types.NewSample("", "mem_used", 1), now) {
+		t.Fatal("unexpected aggregation of mem_used")
+	}
+
+	if ret := pa.flush(now.Add(time.Second)); ret != nil {
+		t.Fatalf("expected no samples before window ends, got %d", len(ret))
+	}
+
+	want := map[string]float64{
+		"procstat_cpu_usage_max":   4,
+		"procstat_cpu_usage_sum":   10,
+		"procstat_cpu_usage_count": 4,
+		"procstat_cpu_usage_p50":   2,
+	}
+	ret := pa.flush(now.Add(time.Minute))
+	if len(ret) != len(want) {
+		t.Fatalf("expected %d samples, got %d", len(want), len(ret))
+	}
+	for _, s := range ret {
+		if s.Value != want[s.Metric] {
+			t.Fatalf("expected %s = %v, got %v", s.Metric, want[s.Metric], s.Value)
+		}
+		if len(s.Labels) != 1 || s.Labels["process_name"] != "nginx" {
+			t.Fatalf("unexpected labels: %v", s.Labels)
+		}
+	}
+}
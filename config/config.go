@@ -37,6 +37,15 @@ type Global struct {
 	Interval     Duration          `toml:"interval"`
 	Providers    []string          `toml:"providers"`
 	Concurrency  int               `toml:"concurrency"`
+	// max distinct series of all inputs, new series beyond the limit are dropped
+	MaxSeries int `toml:"max_series"`
+	// random delay of every collection and every flush, spreads the load of many hosts
+	CollectionJitter Duration `toml:"collection_jitter"`
+	FlushJitter      Duration `toml:"flush_jitter"`
+	// collect on multiples of interval and snap timestamps to them
+	RoundInterval bool `toml:"round_interval"`
+	// fail loading input configs with unknown keys rather than logging them
+	StrictConfig bool `toml:"strict_config"`
 }
 
 type Log struct {
@@ -51,9 +60,31 @@ type Log struct {
 type WriterOpt struct {
 	Batch    int `toml:"batch"`
 	ChanSize int `toml:"chan_size"`
+
+	// how series are routed to multiple writers: broadcast, round_robin, failover, hash
+	Mode string `toml:"mode"`
+	// labels to compute the hash of a series in hash mode, all labels are used if empty
+	HashLabels []string `toml:"hash_labels"`
+
+	DiskBuffer DiskBuffer `toml:"disk_buffer"`
+}
+
+// DiskBuffer is the on-disk spill buffer of the writer queue
+type DiskBuffer struct {
+	Enable bool   `toml:"enable"`
+	Path   string `toml:"path"`
+	// max total size of all segments, unit: MB
+	MaxSize int64 `toml:"max_size"`
+	// max size of a single segment file, unit: MB
+	SegmentSize int64 `toml:"segment_size"`
+	// segments older than max_age are dropped
+	MaxAge Duration `toml:"max_age"`
 }
 
 type WriterOption struct {
+	// remote_write(default), kafka or otlp
+	Type string `toml:"type"`
+
 	Url           string   `toml:"url"`
 	BasicAuthUser string   `toml:"basic_auth_user"`
 	BasicAuthPass string   `toml:"basic_auth_pass"`
@@ -63,9 +94,48 @@ type WriterOption struct {
 	DialTimeout         int64 `toml:"dial_timeout"`
 	MaxIdleConnsPerHost int   `toml:"max_idle_conns_per_host"`
 
+	// max batches buffered in memory for this writer
+	QueueSize int `toml:"queue_size"`
+
+	// retry with exponential backoff on network errors, 429 and 5xx
+	MaxRetries       int      `toml:"max_retries"`
+	RetryBackoffBase Duration `toml:"retry_backoff_base"`
+	RetryBackoffMax  Duration `toml:"retry_backoff_max"`
+
+	// stop sending after consecutive failed batches, and probe again after cooldown
+	CircuitBreakerThreshold int      `toml:"circuit_breaker_threshold"`
+	CircuitBreakerCooldown  Duration `toml:"circuit_breaker_cooldown"`
+
+	// series filters applied only to this writer
+	MetricsPass    []string         `toml:"metrics_pass"`
+	MetricsDrop    []string         `toml:"metrics_drop"`
+	LabelsAllow    []string         `toml:"labels_allow"`
+	LabelsDeny     []string         `toml:"labels_deny"`
+	RelabelConfigs []*RelabelConfig `toml:"relabel_configs"`
+
+	// kafka writer settings
+	Kafka *KafkaConfig `toml:"kafka"`
+	// payload format of kafka messages: protobuf, json, influx
+	Format string `toml:"format"`
+	// key of kafka messages: metric, ident, series, or empty for no key
+	PartitionKey string `toml:"partition_key"`
+
+	// otlp writer settings
+	Otlp OtlpConfig `toml:"otlp"`
+
 	tls.ClientConfig
 }
 
+type OtlpConfig struct {
+	// http(default) or grpc
+	Protocol string `toml:"protocol"`
+	// gzip or none(default)
+	Compression string `toml:"compression"`
+	// series named with these suffixes are counters and exported as cumulative
+	// sums, the others are gauges as remote write carries no metric type
+	CounterSuffixes []string `toml:"counter_suffixes"`
+}
+
 type HTTP struct {
 	Enable         bool   `toml:"enable"`
 	Address        string `toml:"address"`
@@ -80,6 +150,34 @@ type HTTP struct {
 	ReadTimeout        int    `toml:"read_timeout"`
 	WriteTimeout       int    `toml:"write_timeout"`
 	IdleTimeout        int    `toml:"idle_timeout"`
+	// listen address of otlp grpc receiver, disabled if empty
+	OtlpGrpcAddress string `toml:"otlp_grpc_address"`
+	// expose the latest point of every series on /metrics
+	ExposeMetrics bool `toml:"expose_metrics"`
+	// series not written for expose_stale_intervals*interval are removed from /metrics
+	ExposeStaleIntervals int `toml:"expose_stale_intervals"`
+	// series with these suffixes are exposed as counters, others as gauges
+	ExposeCounterSuffixes []string `toml:"expose_counter_suffixes"`
+
+	// authentication of push apis, basic auth or any of the bearer tokens
+	BasicAuthUser string        `toml:"basic_auth_user"`
+	BasicAuthPass string        `toml:"basic_auth_pass"`
+	BearerTokens  []BearerToken `toml:"bearer_tokens"`
+	// verify client certificates with the ca, requires cert_file and key_file
+	ClientCAFile string `toml:"client_ca_file"`
+	// source ips or cidrs allowed to push, empty means all
+	AllowedIPs []string `toml:"allowed_ips"`
+	// requests and samples per second of every client, 0 means no limit
+	RateLimitRequests float64 `toml:"rate_limit_requests"`
+	RateLimitSamples  float64 `toml:"rate_limit_samples"`
+	// bearer token of admin apis, they are disabled if empty
+	AdminToken string `toml:"admin_token"`
+}
+
+// BearerToken is a token of push apis, labels are added to the pushed series
+type BearerToken struct {
+	Token  string            `toml:"token"`
+	Labels map[string]string `toml:"labels"`
 }
 
 type IbexConfig struct {
@@ -123,7 +221,10 @@ type ConfigType struct {
 	Heartbeat  *HeartbeatConfig `toml:"heartbeat"`
 	Log        Log              `toml:"log"`
 
-	HTTPProviderConfig *HTTPProviderConfig `toml:"http_provider"`
+	HTTPProviderConfig  *HTTPProviderConfig  `toml:"http_provider"`
+	LocalProviderConfig *LocalProviderConfig `toml:"local_provider"`
+
+	SecretStores []SecretStoreConfig `toml:"secretstores"`
 }
 
 var Config *ConfigType
@@ -146,6 +247,14 @@ func InitConfig(configDir string, debugLevel int, debugMode, testMode bool, inte
 		return fmt.Errorf("failed to load configs of dir: %s err:%s", configDir, err)
 	}
 
+	if err := InitSecretStores(Config.SecretStores); err != nil {
+		return err
+	}
+
+	if err := ResolveSecrets(Config); err != nil {
+		return err
+	}
+
 	if interval > 0 {
 		Config.Global.Interval = Duration(time.Duration(interval) * time.Second)
 	}
@@ -162,6 +271,26 @@ func InitConfig(configDir string, debugLevel int, debugMode, testMode bool, inte
 		Config.WriterOpt.Batch = 1000
 	}
 
+	if Config.WriterOpt.Mode == "" {
+		Config.WriterOpt.Mode = "broadcast"
+	}
+
+	if Config.WriterOpt.DiskBuffer.Path == "" {
+		Config.WriterOpt.DiskBuffer.Path = "./data-buffer"
+	}
+
+	if Config.WriterOpt.DiskBuffer.MaxSize <= 0 {
+		Config.WriterOpt.DiskBuffer.MaxSize = 1024
+	}
+
+	if Config.WriterOpt.DiskBuffer.SegmentSize <= 0 {
+		Config.WriterOpt.DiskBuffer.SegmentSize = 64
+	}
+
+	if Config.WriterOpt.DiskBuffer.MaxAge <= 0 {
+		Config.WriterOpt.DiskBuffer.MaxAge = Duration(24 * time.Hour)
+	}
+
 	Config.Global.Hostname = strings.TrimSpace(Config.Global.Hostname)
 
 	if err := InitHostInfo(); err != nil {
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"flashcat.cloud/categraf/pkg/conv"
+	"flashcat.cloud/categraf/pkg/filter"
+	"flashcat.cloud/categraf/types"
+)
+
+// state of series not seen for this long is dropped
+const deriveStateExpire = 10 * time.Minute
+
+// deriver keeps the last value of counters to emit <metric>_rate and <metric>_delta
+type deriver struct {
+	rateFilter  filter.Filter
+	deltaFilter filter.Filter
+
+	lock  sync.Mutex
+	state map[string]deriveState
+}
+
+type deriveState struct {
+	value     float64
+	timestamp time.Time
+}
+
+func newDeriver(rate, delta []string) (*deriver, error) {
+	if len(rate) == 0 && len(delta) == 0 {
+		return nil, nil
+	}
+
+	var (
+		d   = &deriver{state: make(map[string]deriveState)}
+		err error
+	)
+	if d.rateFilter, err = filter.Compile(rate); err != nil {
+		return nil, err
+	}
+	if d.deltaFilter, err = filter.Compile(delta); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *deriver) match(metric string) (rate, delta bool) {
+	rate = d.rateFilter != nil && d.rateFilter.Match(metric)
+	delta = d.deltaFilter != nil && d.deltaFilter.Match(metric)
+	return
+}
+
+// derive returns the rate and delta samples of a counter sample, nothing is
+// returned for the first sample of a series since there is no previous value
+func (d *deriver) derive(s *types.Sample, rate, delta bool) []*types.Sample {
+	value, err := conv.ToFloat64(s.Value)
+	if err != nil || math.IsNaN(value) {
+		return nil
+	}
+
+	key := types.SeriesKey(s.Metric, s.Labels)
+
+	d.lock.Lock()
+	last, has := d.state[key]
+	d.state[key] = deriveState{value: value, timestamp: s.Timestamp}
+	d.lock.Unlock()
+
+	if !has {
+		return nil
+	}
+	elapsed := s.Timestamp.Sub(last.timestamp).Seconds()
+	if elapsed <= 0 {
+		return nil
+	}
+
+	diff := value - last.value
+	if diff < 0 {
+		// counter reset, count from zero
+		diff = value
+	}
+
+	ret := make([]*types.Sample, 0, 2)
+	if rate {
+		ret = append(ret, derivedSample(s, s.Metric+"_rate", diff/elapsed))
+	}
+	if delta {
+		ret = append(ret, derivedSample(s, s.Metric+"_delta", diff))
+	}
+	return ret
+}
+
+// expire drops the state of series which disappear
+func (d *deriver) expire(now time.Time) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for key, st := range d.state {
+		if now.Sub(st.timestamp) > deriveStateExpire {
+			delete(d.state, key)
+		}
+	}
+}
+
+func derivedSample(s *types.Sample, metric string, value float64) *types.Sample {
+	labels := make(map[string]string, len(s.Labels))
+	for k, v := range s.Labels {
+		labels[k] = v
+	}
+	return &types.Sample{
+		Metric:    metric,
+		Timestamp: s.Timestamp,
+		Value:     value,
+		Labels:    labels,
+	}
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/types"
+)
+
+func TestDeriver(t *testing.T) {
+	d, err := newDeriver([]string{"net_bytes_*"}, []string{"net_bytes_recv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	sample := func(v float64, ts time.Time) *types.Sample {
+		s := types.NewSample("", "net_bytes_recv", v, map[string]string{"interface": "eth0"})
+		s.Timestamp = ts
+		return s
+	}
+
+	rate, delta := d.match("net_bytes_recv")
+	if !rate || !delta {
+		t.Fatal("expected net_bytes_recv to match rate and delta")
+	}
+	if ret := d.derive(sample(100, now), rate, delta); len(ret) != 0 {
+		t.Fatalf("expected first sample dropped, got %d", len(ret))
+	}
+
+	ret := d.derive(sample(300, now.Add(10*time.Second)), rate, delta)
+	if len(ret) != 2 || ret[0].Metric != "net_bytes_recv_rate" || ret[0].Value != 20.0 || ret[1].Value != 200.0 {
+		t.Fatalf("unexpected derived samples: %v %v", ret[0], ret[1])
+	}
+	if ret[0].Labels["interface"] != "eth0" {
+		t.Fatalf("unexpected labels: %v", ret[0].Labels)
+	}
+
+	// counter reset counts from zero
+	ret = d.derive(sample(50, now.Add(20*time.Second)), rate, delta)
+	if len(ret) != 2 || ret[1].Value != 50.0 {
+		t.Fatalf("unexpected delta after reset: %v", ret)
+	}
+
+	d.expire(now.Add(time.Hour))
+	if len(d.state) != 0 {
+		t.Fatalf("expected state expired, got %d", len(d.state))
+	}
+}
+
+func TestDeriveKeepsNativeHistograms(t *testing.T) {
+	old := Config
+	Config = &ConfigType{Global: Global{OmitHostname: true}}
+	defer func() { Config = old }()
+
+	ic := &InternalConfig{DeriveRate: []string{"rpc_latency_seconds"}}
+	if err := ic.InitInternalConfig(); err != nil {
+		t.Fatal(err)
+	}
+	s := types.NewSample("", "rpc_latency_seconds", nil)
+	s.Histogram = &prompb.Histogram{Count: &prompb.Histogram_CountInt{CountInt: 1}}
+
+	slist := types.NewSampleList()
+	slist.PushFront(s)
+	ret := ic.Process(slist).PopBackAll()
+	if len(ret) != 1 || ret[0].Histogram == nil {
+		t.Fatalf("expected native histogram passed through, got %v", ret)
+	}
+}
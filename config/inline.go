@@ -12,7 +12,8 @@ import (
 	"flashcat.cloud/categraf/types"
 )
 
-const agentHostnameLabelKey = "agent_hostname"
+// AgentHostnameLabelKey is the label of the agent hostname attached to samples
+const AgentHostnameLabelKey = "agent_hostname"
 
 type ProcessorEnum struct {
 	Metrics       []string `toml:"metrics"` // support glob
@@ -30,12 +31,27 @@ type InternalConfig struct {
 	MetricsDropFilter filter.Filter
 	MetricsPassFilter filter.Filter
 
+	// emit <metric>_rate and <metric>_delta of counters, support glob
+	DeriveRate         []string `toml:"derive_rate"`
+	DeriveDelta        []string `toml:"derive_delta"`
+	DeriveKeepOriginal bool     `toml:"derive_keep_original"`
+	deriver            *deriver `toml:"-"`
+
 	// metric name prefix
 	MetricsNamePrefix string `toml:"metrics_name_prefix"`
 
+	// max distinct series, new series beyond the limit are dropped
+	MaxSeries int `toml:"max_series"`
+
+	// a gather exceeding the timeout is abandoned, 0 means no timeout
+	GatherTimeout Duration `toml:"gather_timeout"`
+
 	// mapping value
 	ProcessorEnum []*ProcessorEnum `toml:"processor_enum"`
 
+	// roll up samples over a window
+	ProcessorAggregate []*ProcessorAggregate `toml:"processor_aggregate"`
+
 	// whether instance initial success
 	inited bool `toml:"-"`
 
@@ -64,6 +80,41 @@ type RelabelConfig struct {
 	Action relabel.Action `toml:"action,omitempty"`
 }
 
+// CompileRelabelConfigs fills defaults of relabel configs and compiles them
+func CompileRelabelConfigs(rcs []*RelabelConfig) ([]*relabel.Config, error) {
+	ret := make([]*relabel.Config, 0, len(rcs))
+	for _, rc := range rcs {
+		if len(rc.Regex) == 0 {
+			rc.Regex = "(.*)"
+		}
+		if len(rc.Action) == 0 {
+			rc.Action = relabel.Replace
+		}
+		if len(rc.Replacement) == 0 {
+			rc.Replacement = "$1"
+		}
+		if rc.Separator == "" {
+			rc.Separator = ";"
+		}
+		reg, err := relabel.NewRegexp(rc.Regex)
+		if err != nil {
+			msg := fmt.Errorf("relabel_configs regex:%s compile error:%s", rc.Regex, err)
+			return nil, msg
+		}
+		r := &relabel.Config{
+			SourceLabels: rc.SourceLabels,
+			Separator:    rc.Separator,
+			Regex:        reg,
+			Modulus:      rc.Modulus,
+			TargetLabel:  rc.TargetLabel,
+			Replacement:  rc.Replacement,
+			Action:       rc.Action,
+		}
+		ret = append(ret, r)
+	}
+	return ret, nil
+}
+
 func (ic *InternalConfig) GetLabels() map[string]string {
 	if ic.Labels != nil {
 		return ic.Labels
@@ -99,36 +150,26 @@ func (ic *InternalConfig) InitInternalConfig() error {
 			}
 		}
 	}
+	if ic.deriver == nil {
+		var err error
+		ic.deriver, err = newDeriver(ic.DeriveRate, ic.DeriveDelta)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < len(ic.ProcessorAggregate); i++ {
+		if err := ic.ProcessorAggregate[i].init(); err != nil {
+			return err
+		}
+	}
+
 	if len(ic.RelabelConfigs) != 0 {
-		for _, rc := range ic.RelabelConfigs {
-			if len(rc.Regex) == 0 {
-				rc.Regex = "(.*)"
-			}
-			if len(rc.Action) == 0 {
-				rc.Action = relabel.Replace
-			}
-			if len(rc.Replacement) == 0 {
-				rc.Replacement = "$1"
-			}
-			if rc.Separator == "" {
-				rc.Separator = ";"
-			}
-			reg, err := relabel.NewRegexp(rc.Regex)
-			if err != nil {
-				msg := fmt.Errorf("relabel_configs regex:%s compile error:%s", rc.Regex, err)
-				return msg
-			}
-			r := &relabel.Config{
-				SourceLabels: rc.SourceLabels,
-				Separator:    rc.Separator,
-				Regex:        reg,
-				Modulus:      rc.Modulus,
-				TargetLabel:  rc.TargetLabel,
-				Replacement:  rc.Replacement,
-				Action:       rc.Action,
-			}
-			ic.relabelConfigs = append(ic.relabelConfigs, r)
+		rcs, err := CompileRelabelConfigs(ic.RelabelConfigs)
+		if err != nil {
+			return err
 		}
+		ic.relabelConfigs = append(ic.relabelConfigs, rcs...)
 	}
 
 	return nil
@@ -136,7 +177,7 @@ func (ic *InternalConfig) InitInternalConfig() error {
 
 func (ic *InternalConfig) Process(slist *types.SampleList) *types.SampleList {
 	nlst := types.NewSampleList()
-	if slist.Len() == 0 {
+	if slist.Len() == 0 && len(ic.ProcessorAggregate) == 0 {
 		return nlst
 	}
 
@@ -176,64 +217,112 @@ func (ic *InternalConfig) Process(slist *types.SampleList) *types.SampleList {
 			ss[i].Timestamp = now
 		}
 
-		// name prefix
-		if len(ic.MetricsNamePrefix) > 0 {
-			ss[i].Metric = ic.MetricsNamePrefix + ss[i].Metric
+		// derive rate and delta of counters, native histograms carry no value
+		// to derive from and pass through unchanged
+		if ic.deriver != nil && ss[i].Histogram == nil {
+			if rate, delta := ic.deriver.match(ss[i].Metric); rate || delta {
+				for _, d := range ic.deriver.derive(ss[i], rate, delta) {
+					ic.emit(nlst, d, now)
+				}
+				if !ic.DeriveKeepOriginal {
+					continue
+				}
+			}
 		}
 
-		// add instance labels
-		labels := ic.GetLabels()
-		for k, v := range labels {
-			if v == "-" {
-				delete(ss[i].Labels, k)
-				continue
-			}
-			ss[i].Labels[k] = Expand(v)
+		ic.emit(nlst, ss[i], now)
+	}
+
+	if ic.deriver != nil {
+		ic.deriver.expire(now)
+	}
+
+	for _, s := range ic.flushAggregates(now) {
+		if ic.decorate(s) {
+			nlst.PushFront(s)
 		}
+	}
 
-		// add global labels
-		for k, v := range GlobalLabels() {
-			if _, has := ss[i].Labels[k]; !has {
-				ss[i].Labels[k] = v
-			}
+	return nlst
+}
+
+func (ic *InternalConfig) emit(nlst *types.SampleList, s *types.Sample, now time.Time) {
+	// aggregate metrics, the rolled up samples are emitted when the window ends
+	if ic.aggregate(s, now) {
+		return
+	}
+
+	if ic.decorate(s) {
+		nlst.PushFront(s)
+	}
+}
+
+// decorate adds name prefix and labels to a sample and relabels it,
+// returns false if the sample is dropped by relabel
+func (ic *InternalConfig) decorate(s *types.Sample) bool {
+	// name prefix
+	if len(ic.MetricsNamePrefix) > 0 {
+		s.Metric = ic.MetricsNamePrefix + s.Metric
+	}
+
+	// add instance labels
+	labels := ic.GetLabels()
+	for k, v := range labels {
+		if v == "-" {
+			delete(s.Labels, k)
+			continue
 		}
+		s.Labels[k] = Expand(v)
+	}
 
-		// add label: agent_hostname
-		if _, has := ss[i].Labels[agentHostnameLabelKey]; !has {
-			if !Config.Global.OmitHostname {
-				ss[i].Labels[agentHostnameLabelKey] = Config.GetHostname()
-			}
+	// add global labels
+	for k, v := range GlobalLabels() {
+		if _, has := s.Labels[k]; !has {
+			s.Labels[k] = v
 		}
-		// relabel
-		if len(ic.relabelConfigs) != 0 {
-			newName := ss[i].Metric
-			all := make(modelLabel.Labels, 0, len(ss[i].Labels)+1)
-			all = append(all, modelLabel.Label{Name: modelLabel.MetricName, Value: newName})
-			for k, v := range ss[i].Labels {
-				all = append(all, modelLabel.Label{Name: k, Value: v})
-			}
-			newAll, keep := relabel.Process(all, ic.relabelConfigs...)
-			if !keep {
+	}
+
+	// add label: agent_hostname
+	if _, has := s.Labels[AgentHostnameLabelKey]; !has {
+		if !Config.Global.OmitHostname {
+			s.Labels[AgentHostnameLabelKey] = Config.GetHostname()
+		}
+	}
+	// relabel
+	if len(ic.relabelConfigs) != 0 {
+		newName := s.Metric
+		all := make(modelLabel.Labels, 0, len(s.Labels)+1)
+		all = append(all, modelLabel.Label{Name: modelLabel.MetricName, Value: newName})
+		for k, v := range s.Labels {
+			all = append(all, modelLabel.Label{Name: k, Value: v})
+		}
+		newAll, keep := relabel.Process(all, ic.relabelConfigs...)
+		if !keep {
+			return false
+		}
+		newLabel := make(map[string]string, len(newAll))
+		for _, l := range newAll {
+			if l.Name == modelLabel.MetricName {
+				newName = l.Value
 				continue
 			}
-			newLabel := make(map[string]string, len(newAll))
-			for _, l := range newAll {
-				if l.Name == modelLabel.MetricName {
-					newName = l.Value
-					continue
-				}
-				newLabel[l.Name] = l.Value
-			}
-			if newName != "" && newName != ss[i].Metric {
-				ss[i].Metric = newName
-			}
-			ss[i].Labels = newLabel
+			newLabel[l.Name] = l.Value
 		}
-
-		nlst.PushFront(ss[i])
+		if newName != "" && newName != s.Metric {
+			s.Metric = newName
+		}
+		s.Labels = newLabel
 	}
 
-	return nlst
+	return true
+}
+
+func (ic *InternalConfig) GetMaxSeries() int {
+	return ic.MaxSeries
+}
+
+func (ic *InternalConfig) GetGatherTimeout() time.Duration {
+	return time.Duration(ic.GatherTimeout)
 }
 
 func (ic *InternalConfig) Initialized() bool {
@@ -247,12 +336,38 @@ func (ic *InternalConfig) SetInitialized() {
 type PluginConfig struct {
 	InternalConfig
 	Interval Duration `toml:"interval"`
+
+	// override collection_jitter, flush_jitter and round_interval of global
+	CollectionJitter Duration `toml:"collection_jitter"`
+	FlushJitter      Duration `toml:"flush_jitter"`
+	RoundInterval    *bool    `toml:"round_interval"`
 }
 
 func (pc *PluginConfig) GetInterval() Duration {
 	return pc.Interval
 }
 
+func (pc *PluginConfig) GetCollectionJitter() time.Duration {
+	if pc.CollectionJitter > 0 || Config == nil {
+		return time.Duration(pc.CollectionJitter)
+	}
+	return time.Duration(Config.Global.CollectionJitter)
+}
+
+func (pc *PluginConfig) GetFlushJitter() time.Duration {
+	if pc.FlushJitter > 0 || Config == nil {
+		return time.Duration(pc.FlushJitter)
+	}
+	return time.Duration(Config.Global.FlushJitter)
+}
+
+func (pc *PluginConfig) GetRoundInterval() bool {
+	if pc.RoundInterval != nil {
+		return *pc.RoundInterval
+	}
+	return Config != nil && Config.Global.RoundInterval
+}
+
 type InstanceConfig struct {
 	InternalConfig
 	IntervalTimes int64 `toml:"interval_times"`
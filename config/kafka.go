@@ -0,0 +1,76 @@
+package config
+
+import (
+	"github.com/IBM/sarama"
+
+	"flashcat.cloud/categraf/pkg/kafka"
+	"flashcat.cloud/categraf/pkg/tls"
+)
+
+type KafkaConfig struct {
+	Topic   string   `json:"topic" toml:"topic"`
+	Brokers []string `json:"brokers" toml:"brokers"`
+	*sarama.Config
+
+	CompressionCodec string `json:"compression_codec" toml:"compression_codec"`
+
+	KafkaVersion     string `toml:"kafka_version"`
+	SaslEnable       bool   `toml:"sasl_enable"`
+	SaslMechanism    string `toml:"sasl_mechanism"`
+	SaslVersion      int16  `toml:"sasl_version"`
+	SaslHandshake    bool   `toml:"sasl_handshake"`
+	SaslUser         string `toml:"sasl_user"`
+	SaslPassword     string `toml:"sasl_password"`
+	SaslAuthIdentity string `toml:"sasl_auth_identity"`
+
+	CertificateAuth []string `toml:"certificate_authorities"`
+	tls.ClientConfig
+	PartitionStrategy string `toml:"partition_strategy"`
+}
+
+// SetupSarama applies the SASL and kafka version settings to the sarama config
+func (kc *KafkaConfig) SetupSarama(c *sarama.Config) {
+	if kc.SaslEnable {
+		c.Net.SASL.Enable = true
+		c.Net.SASL.User = kc.SaslUser
+		c.Net.SASL.Password = kc.SaslPassword
+		c.Net.SASL.Mechanism = sarama.SASLMechanism(kc.SaslMechanism)
+		c.Net.SASL.Version = kc.SaslVersion
+		c.Net.SASL.Handshake = kc.SaslHandshake
+		c.Net.SASL.AuthIdentity = kc.SaslAuthIdentity
+
+		if c.Net.SASL.Mechanism == sarama.SASLTypeSCRAMSHA256 {
+			c.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+				return &kafka.XDGSCRAMClient{HashGeneratorFcn: kafka.SHA256}
+			}
+		}
+		if c.Net.SASL.Mechanism == sarama.SASLTypeSCRAMSHA512 {
+			c.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &kafka.XDGSCRAMClient{HashGeneratorFcn: kafka.SHA512} }
+		}
+	}
+
+	if len(kc.KafkaVersion) != 0 {
+		for _, v := range sarama.SupportedVersions {
+			if v.String() == kc.KafkaVersion {
+				c.Version = v
+				break
+			}
+		}
+	}
+}
+
+// SetupCompression applies the compression codec to the sarama config
+func (kc *KafkaConfig) SetupCompression(c *sarama.Config) {
+	switch kc.CompressionCodec {
+	case "gzip":
+		c.Producer.Compression = sarama.CompressionGZIP
+	case "snappy":
+		c.Producer.Compression = sarama.CompressionSnappy
+	case "lz4":
+		c.Producer.Compression = sarama.CompressionLZ4
+	case "zstd":
+		c.Producer.Compression = sarama.CompressionZSTD
+	default:
+		c.Producer.Compression = sarama.CompressionNone
+	}
+}
@@ -3,10 +3,7 @@
 package config
 
 import (
-	"github.com/IBM/sarama"
-
 	logsconfig "flashcat.cloud/categraf/config/logs"
-	"flashcat.cloud/categraf/pkg/tls"
 )
 
 const (
@@ -48,26 +45,6 @@ type (
 
 		EnableCollectContainer bool `json:"enable_collect_container" toml:"enable_collect_container"`
 	}
-	KafkaConfig struct {
-		Topic   string   `json:"topic" toml:"topic"`
-		Brokers []string `json:"brokers" toml:"brokers"`
-		*sarama.Config
-
-		CompressionCodec string `json:"compression_codec" toml:"compression_codec"`
-
-		KafkaVersion     string `toml:"kafka_version"`
-		SaslEnable       bool   `toml:"sasl_enable"`
-		SaslMechanism    string `toml:"sasl_mechanism"`
-		SaslVersion      int16  `toml:"sasl_version"`
-		SaslHandshake    bool   `toml:"sasl_handshake"`
-		SaslUser         string `toml:"sasl_user"`
-		SaslPassword     string `toml:"sasl_password"`
-		SaslAuthIdentity string `toml:"sasl_auth_identity"`
-
-		CertificateAuth []string `toml:"certificate_authorities"`
-		tls.ClientConfig
-		PartitionStrategy string `toml:"partition_strategy"`
-	}
 	KubeConfig struct {
 		KubeletHTTPPort  int    `json:"kubernetes_http_kubelet_port" toml:"kubernetes_http_kubelet_port"`
 		KubeletHTTPSPort int    `json:"kubernetes_https_kubelet_port" toml:"kubernetes_https_kubelet_port"`
@@ -11,4 +11,17 @@ type HTTPProviderConfig struct {
 	AuthPassword   string   `toml:"basic_auth_pass"`
 	Timeout        int      `toml:"timeout"`
 	ReloadInterval int      `toml:"reload_interval"`
+
+	// seconds the server may hold a request until configs change, 0 disables long polling
+	LongPollTimeout int `toml:"long_poll_timeout"`
+	// last known good remote configs, loaded at startup if the server is down
+	CacheFile    string `toml:"cache_file"`
+	DisableCache bool   `toml:"disable_cache"`
+}
+
+type LocalProviderConfig struct {
+	// watch the input config dirs and reload changed inputs without SIGHUP
+	Watch bool `toml:"watch"`
+	// changes within the window are reloaded together
+	Debounce Duration `toml:"debounce"`
 }
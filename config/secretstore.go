@@ -0,0 +1,322 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+
+	"flashcat.cloud/categraf/pkg/tls"
+)
+
+// SecretStoreConfig is the config of [[secretstores]], referenced by @{id:key}
+type SecretStoreConfig struct {
+	ID string `toml:"id"`
+	// file, env, encrypted_file or vault
+	Type string `toml:"type"`
+
+	// file: a directory with a file per key, or a file of key=value lines
+	// encrypted_file: the file encrypted by --encrypt-secrets
+	Path string `toml:"path"`
+	// encrypted_file: file of the base64 encoded 32 bytes aes key
+	KeyFile string `toml:"key_file"`
+	// env: prefix of the environment variables
+	Prefix string `toml:"prefix"`
+
+	// vault: the key is a field of the secret at path
+	Address   string   `toml:"address"`
+	Token     string   `toml:"token"`
+	TokenFile string   `toml:"token_file"`
+	Namespace string   `toml:"namespace"`
+	Mount     string   `toml:"mount"`
+	KVVersion int      `toml:"kv_version"`
+	Timeout   Duration `toml:"timeout"`
+	tls.ClientConfig
+}
+
+// SecretStore returns the secret of a key
+type SecretStore interface {
+	Get(key string) ([]byte, error)
+}
+
+// secretFetcher is a store whose secrets are fetched together, e.g. fields of
+// a vault secret, ResolveSecrets fetches them once per pass
+type secretFetcher interface {
+	Fetch() (map[string][]byte, error)
+}
+
+var (
+	secretStores     = make(map[string]SecretStore)
+	secretStoresLock sync.RWMutex
+)
+
+// InitSecretStores replaces the secret stores with the configured ones
+func InitSecretStores(configs []SecretStoreConfig) error {
+	stores := make(map[string]SecretStore, len(configs))
+	for i := range configs {
+		c := &configs[i]
+		if !secretStorePattern.MatchString(c.ID) {
+			return fmt.Errorf("invalid id %q of secretstores, only letters, digits and _ are allowed", c.ID)
+		}
+		if _, has := stores[c.ID]; has {
+			return fmt.Errorf("duplicate id %q of secretstores", c.ID)
+		}
+		store, err := newSecretStore(c)
+		if err != nil {
+			return fmt.Errorf("secretstore %s: %v", c.ID, err)
+		}
+		stores[c.ID] = store
+	}
+
+	secretStoresLock.Lock()
+	secretStores = stores
+	secretStoresLock.Unlock()
+	return nil
+}
+
+func newSecretStore(c *SecretStoreConfig) (SecretStore, error) {
+	switch c.Type {
+	case "file":
+		if c.Path == "" {
+			return nil, fmt.Errorf("path is required")
+		}
+		return &fileStore{path: c.Path}, nil
+	case "env":
+		return &envStore{prefix: c.Prefix}, nil
+	case "encrypted_file":
+		return newEncryptedFileStore(c.Path, c.KeyFile)
+	case "vault":
+		return newVaultStore(c)
+	default:
+		return nil, fmt.Errorf("unknown type %q", c.Type)
+	}
+}
+
+func getSecretStore(id string) (SecretStore, bool) {
+	secretStoresLock.RLock()
+	defer secretStoresLock.RUnlock()
+	store, has := secretStores[id]
+	return store, has
+}
+
+func hasSecretStores() bool {
+	secretStoresLock.RLock()
+	defer secretStoresLock.RUnlock()
+	return len(secretStores) > 0
+}
+
+// resolveSecretRef returns the secret of a reference @{id:key}
+func resolveSecretRef(ref string) ([]byte, error) {
+	id, key := splitLink(ref)
+	store, has := getSecretStore(id)
+	if !has {
+		return nil, fmt.Errorf("secretstore %s not found", id)
+	}
+	return store.Get(key)
+}
+
+type fetchedSecrets struct {
+	secrets map[string][]byte
+	err     error
+}
+
+// resolve is resolveSecretRef with the secrets of fetchers cached in the pass
+func (r *secretResolver) resolve(ref string) ([]byte, error) {
+	id, key := splitLink(ref)
+	store, has := getSecretStore(id)
+	if !has {
+		return nil, fmt.Errorf("secretstore %s not found", id)
+	}
+	fetcher, ok := store.(secretFetcher)
+	if !ok {
+		return store.Get(key)
+	}
+	fetched, has := r.fetched[id]
+	if !has {
+		fetched = &fetchedSecrets{}
+		fetched.secrets, fetched.err = fetcher.Fetch()
+		r.fetched[id] = fetched
+	}
+	if fetched.err != nil {
+		return nil, fetched.err
+	}
+	secret, has := fetched.secrets[key]
+	if !has {
+		return nil, fmt.Errorf("key %s not found in secretstore %s", key, id)
+	}
+	return secret, nil
+}
+
+// ResolveSecrets replaces references @{id:key} in the string fields of v with
+// the secrets, and links the Secret fields to the secret stores
+func ResolveSecrets(v interface{}) error {
+	if !hasSecretStores() {
+		return nil
+	}
+	r := &secretResolver{seen: make(map[uintptr]struct{}), fetched: make(map[string]*fetchedSecrets)}
+	r.walk(reflect.ValueOf(v))
+	if len(r.errs) > 0 {
+		return fmt.Errorf("resolving secrets failed: %s", strings.Join(r.errs, ";"))
+	}
+	return nil
+}
+
+type secretResolver struct {
+	seen map[uintptr]struct{}
+	errs []string
+	// secrets of fetchers by store id
+	fetched map[string]*fetchedSecrets
+}
+
+var secretType = reflect.TypeOf(Secret{})
+
+func (r *secretResolver) walk(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+		if _, has := r.seen[v.Pointer()]; has {
+			return
+		}
+		r.seen[v.Pointer()] = struct{}{}
+		r.walk(v.Elem())
+	case reflect.Interface:
+		if !v.IsNil() {
+			r.walk(v.Elem())
+		}
+	case reflect.Struct:
+		if v.Type() == secretType {
+			r.link(v)
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				r.walk(v.Field(i))
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			r.walk(v.Index(i))
+		}
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.String {
+			iter := v.MapRange()
+			for iter.Next() {
+				r.walk(iter.Value())
+			}
+			return
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			s := iter.Value().String()
+			if ns, ok := r.replace(s); ok {
+				v.SetMapIndex(iter.Key(), reflect.ValueOf(ns).Convert(v.Type().Elem()))
+			}
+		}
+	case reflect.String:
+		if !v.CanSet() {
+			return
+		}
+		if ns, ok := r.replace(v.String()); ok {
+			v.SetString(ns)
+		}
+	}
+}
+
+// replace returns the string with references replaced, ok is false if there is no reference
+func (r *secretResolver) replace(s string) (string, bool) {
+	if !strings.Contains(s, "@{") {
+		return s, false
+	}
+	replaced := false
+	ns := secretPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		secret, err := r.resolve(ref)
+		if err != nil {
+			r.errs = append(r.errs, fmt.Sprintf("resolving %q failed: %v", ref, err))
+			return ref
+		}
+		replaced = true
+		return string(secret)
+	})
+	return ns, replaced
+}
+
+func (r *secretResolver) link(v reflect.Value) {
+	if !v.CanAddr() {
+		return
+	}
+	s := v.Addr().Interface().(*Secret)
+	unlinked := s.GetUnlinked()
+	if len(unlinked) == 0 {
+		return
+	}
+	resolvers := make(map[string]ResolveFunc, len(unlinked))
+	for _, ref := range unlinked {
+		ref := ref
+		resolvers[ref] = func() ([]byte, bool, error) {
+			secret, err := resolveSecretRef(ref)
+			return secret, false, err
+		}
+	}
+	if err := s.Link(resolvers); err != nil {
+		r.errs = append(r.errs, err.Error())
+	}
+}
+
+// fileStore reads a file per key under a directory, or key=value lines of a file
+type fileStore struct {
+	path string
+}
+
+func (s *fileStore) Get(key string) ([]byte, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		bs, err := os.ReadFile(filepath.Join(s.path, key))
+		if err != nil {
+			return nil, err
+		}
+		return bytes.TrimRight(bs, "\r\n"), nil
+	}
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, v, found := strings.Cut(line, "=")
+		if found && strings.TrimSpace(k) == key {
+			return []byte(strings.TrimSpace(v)), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("key %s not found in %s", key, s.path)
+}
+
+// envStore reads the environment variable <prefix><key>
+type envStore struct {
+	prefix string
+}
+
+func (s *envStore) Get(key string) ([]byte, error) {
+	v, has := os.LookupEnv(s.prefix + key)
+	if !has {
+		return nil, fmt.Errorf("environment variable %s not set", s.prefix+key)
+	}
+	return []byte(v), nil
+}
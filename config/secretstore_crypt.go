@@ -0,0 +1,113 @@
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// encryptedFileStore reads secrets from a json object encrypted by aes-256-gcm,
+// the file content is base64(nonce + ciphertext)
+type encryptedFileStore struct {
+	path string
+	aead cipher.AEAD
+}
+
+func newEncryptedFileStore(path, keyFile string) (*encryptedFileStore, error) {
+	if path == "" || keyFile == "" {
+		return nil, fmt.Errorf("path and key_file are required")
+	}
+	aead, err := loadSecretKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedFileStore{path: path, aead: aead}, nil
+}
+
+func loadSecretKey(keyFile string) (cipher.AEAD, error) {
+	bs, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(bs)))
+	if err != nil {
+		return nil, fmt.Errorf("key_file is not base64 encoded: %v", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key of key_file must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (s *encryptedFileStore) Get(key string) ([]byte, error) {
+	secrets, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	v, has := secrets[key]
+	if !has {
+		return nil, fmt.Errorf("key %s not found in %s", key, s.path)
+	}
+	return []byte(v), nil
+}
+
+func (s *encryptedFileStore) load() (map[string]string, error) {
+	bs, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(bs)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %v", s.path, err)
+	}
+	size := s.aead.NonceSize()
+	if len(data) < size {
+		return nil, fmt.Errorf("%s is too short", s.path)
+	}
+	plain, err := s.aead.Open(nil, data[:size], data[size:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %v", s.path, err)
+	}
+	secrets := make(map[string]string)
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s: %v", s.path, err)
+	}
+	return secrets, nil
+}
+
+// EncryptSecrets encrypts a json object of secrets to the path of the
+// encrypted_file secret store
+func EncryptSecrets(id string, plain []byte) error {
+	for _, c := range Config.SecretStores {
+		if c.ID != id {
+			continue
+		}
+		if c.Type != "encrypted_file" {
+			return fmt.Errorf("type of secretstore %s is not encrypted_file", id)
+		}
+		secrets := make(map[string]string)
+		if err := json.Unmarshal(plain, &secrets); err != nil {
+			return fmt.Errorf("secrets must be a json object of strings: %v", err)
+		}
+		aead, err := loadSecretKey(c.KeyFile)
+		if err != nil {
+			return err
+		}
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return err
+		}
+		data := aead.Seal(nonce, nonce, plain, nil)
+		return os.WriteFile(c.Path, []byte(base64.StdEncoding.EncodeToString(data)), 0600)
+	}
+	return fmt.Errorf("secretstore %s not found", id)
+}
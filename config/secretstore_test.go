@@ -0,0 +1,97 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+type secretTestConfig struct {
+	Password string            `toml:"password"`
+	Headers  []string          `toml:"headers"`
+	Labels   map[string]string `toml:"labels"`
+	Secret   Secret            `toml:"secret"`
+	Nested   *struct {
+		Token string `toml:"token"`
+	} `toml:"nested"`
+}
+
+func TestResolveSecrets(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "mysql_pass"), []byte("p@ss\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CATEGRAF_TOKEN", "t0ken")
+
+	var vaultRequests atomic.Int32
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vaultRequests.Add(1)
+		if r.URL.Path != "/v1/secret/data/categraf" || r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"data":{"data":{"api_key":"k3y","user":"bob"},"metadata":{"version":1}}}`))
+	}))
+	defer vault.Close()
+
+	key := make([]byte, 32)
+	rand.Read(key)
+	keyFile := filepath.Join(dir, "key")
+	if err := os.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString(key)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	stores := []SecretStoreConfig{
+		{ID: "files", Type: "file", Path: dir},
+		{ID: "env", Type: "env", Prefix: "CATEGRAF_"},
+		{ID: "vault", Type: "vault", Address: vault.URL, Path: "categraf", Token: "root"},
+		{ID: "enc", Type: "encrypted_file", Path: filepath.Join(dir, "secrets.enc"), KeyFile: keyFile},
+	}
+	old := Config
+	Config = &ConfigType{SecretStores: stores}
+	defer func() {
+		Config = old
+		InitSecretStores(nil)
+	}()
+	if err := EncryptSecrets("enc", []byte(`{"user":"admin"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitSecretStores(stores); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &secretTestConfig{
+		Password: "@{files:mysql_pass}",
+		Headers:  []string{"Authorization", "Bearer @{env:TOKEN}"},
+		Labels:   map[string]string{"key": "@{vault:api_key}", "user": "@{vault:user}"},
+		Secret:   NewSecret([]byte("@{enc:user}")),
+	}
+	c.Nested = &struct {
+		Token string `toml:"token"`
+	}{Token: "@{env:TOKEN}"}
+	if err := ResolveSecrets(c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Password != "p@ss" || c.Headers[1] != "Bearer t0ken" || c.Labels["key"] != "k3y" || c.Labels["user"] != "bob" || c.Nested.Token != "t0ken" {
+		t.Fatalf("unexpected resolved config: %+v", c)
+	}
+	if n := vaultRequests.Load(); n != 1 {
+		t.Fatalf("expected the vault secret fetched once, got %d requests", n)
+	}
+	buf, err := c.Secret.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "admin" {
+		t.Fatalf("expected admin, got %s", buf.String())
+	}
+	buf.Destroy()
+
+	if err := ResolveSecrets(&secretTestConfig{Password: "@{missing:key}"}); err == nil {
+		t.Fatal("expected error of unknown secret store")
+	}
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// vaultStore reads fields of a secret of hashicorp vault kv engine
+type vaultStore struct {
+	url       string
+	kvVersion int
+	token     string
+	tokenFile string
+	namespace string
+	client    *http.Client
+}
+
+func newVaultStore(c *SecretStoreConfig) (*vaultStore, error) {
+	if c.Address == "" || c.Path == "" {
+		return nil, fmt.Errorf("address and path are required")
+	}
+	if c.Mount == "" {
+		c.Mount = "secret"
+	}
+	if c.KVVersion == 0 {
+		c.KVVersion = 2
+	}
+	if c.KVVersion != 1 && c.KVVersion != 2 {
+		return nil, fmt.Errorf("kv_version must be 1 or 2")
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = Duration(5 * time.Second)
+	}
+	tlsConfig, err := c.ClientConfig.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &vaultStore{
+		kvVersion: c.KVVersion,
+		token:     c.Token,
+		tokenFile: c.TokenFile,
+		namespace: c.Namespace,
+		client: &http.Client{
+			Timeout:   time.Duration(c.Timeout),
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig},
+		},
+	}
+	mount := strings.Trim(c.Mount, "/")
+	path := strings.Trim(c.Path, "/")
+	if c.KVVersion == 2 {
+		s.url = fmt.Sprintf("%s/v1/%s/data/%s", strings.TrimRight(c.Address, "/"), mount, path)
+	} else {
+		s.url = fmt.Sprintf("%s/v1/%s/%s", strings.TrimRight(c.Address, "/"), mount, path)
+	}
+	return s, nil
+}
+
+// getToken reads the token every time so that a rotated token_file is used
+func (s *vaultStore) getToken() (string, error) {
+	if s.token != "" {
+		return s.token, nil
+	}
+	if s.tokenFile != "" {
+		bs, err := os.ReadFile(s.tokenFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(bs)), nil
+	}
+	return os.Getenv("VAULT_TOKEN"), nil
+}
+
+// Fetch reads all fields of the secret
+func (s *vaultStore) Fetch() (map[string][]byte, error) {
+	token, err := s.getToken()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if s.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", s.namespace)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var ret struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &ret); err != nil {
+		return nil, err
+	}
+	data := ret.Data
+	if s.kvVersion == 2 {
+		var v2 struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(data, &v2); err != nil {
+			return nil, err
+		}
+		data = v2.Data
+	}
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	secrets := make(map[string][]byte, len(fields))
+	for k, v := range fields {
+		if str, ok := v.(string); ok {
+			secrets[k] = []byte(str)
+		} else {
+			secrets[k] = []byte(fmt.Sprint(v))
+		}
+	}
+	return secrets, nil
+}
+
+func (s *vaultStore) Get(key string) ([]byte, error) {
+	secrets, err := s.Fetch()
+	if err != nil {
+		return nil, err
+	}
+	secret, has := secrets[key]
+	if !has {
+		return nil, fmt.Errorf("key %s not found in vault", key)
+	}
+	return secret, nil
+}
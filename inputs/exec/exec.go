@@ -2,6 +2,7 @@ package exec
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"log"
@@ -102,6 +103,11 @@ func (ins *Instance) Init() error {
 }
 
 func (ins *Instance) Gather(slist *types.SampleList) {
+	ins.GatherContext(context.Background(), slist)
+}
+
+// GatherContext kills the running commands when ctx is canceled by gather_timeout
+func (ins *Instance) GatherContext(ctx context.Context, slist *types.SampleList) {
 	var commands []string
 	for _, pattern := range ins.Commands {
 		cmdAndArgs := strings.SplitN(pattern, " ", 2)
@@ -141,16 +147,16 @@ func (ins *Instance) Gather(slist *types.SampleList) {
 	var waitCommands sync.WaitGroup
 	waitCommands.Add(len(commands))
 	for _, command := range commands {
-		go ins.ProcessCommand(slist, command, &waitCommands)
+		go ins.ProcessCommand(ctx, slist, command, &waitCommands)
 	}
 
 	waitCommands.Wait()
 }
 
-func (ins *Instance) ProcessCommand(slist *types.SampleList, command string, wg *sync.WaitGroup) {
+func (ins *Instance) ProcessCommand(ctx context.Context, slist *types.SampleList, command string, wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	out, errbuf, runErr := commandRun(command, time.Duration(ins.Timeout))
+	out, errbuf, runErr := commandRun(ctx, command, time.Duration(ins.Timeout))
 	if runErr != nil || len(errbuf) > 0 {
 		log.Println("E! exec_command:", command, "error:", runErr, "stderr:", string(errbuf))
 		return
@@ -166,13 +172,13 @@ func (ins *Instance) ProcessCommand(slist *types.SampleList, command string, wg
 	}
 }
 
-func commandRun(command string, timeout time.Duration) ([]byte, []byte, error) {
+func commandRun(ctx context.Context, command string, timeout time.Duration) ([]byte, []byte, error) {
 	splitCmd, err := QuoteSplit(command)
 	if err != nil || len(splitCmd) == 0 {
 		return nil, nil, fmt.Errorf("exec: unable to parse command, %s", err)
 	}
 
-	cmd := osExec.Command(splitCmd[0], splitCmd[1:]...)
+	cmd := osExec.CommandContext(ctx, splitCmd[0], splitCmd[1:]...)
 
 	var (
 		out    bytes.Buffer
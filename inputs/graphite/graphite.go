@@ -0,0 +1,343 @@
+package graphite
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/inputs"
+	"flashcat.cloud/categraf/pkg/listener"
+	"flashcat.cloud/categraf/types"
+)
+
+const (
+	inputName = "graphite"
+)
+
+type Graphite struct {
+	config.PluginConfig
+	Instances []*Instance `toml:"instances"`
+}
+
+var _ inputs.ServiceInput = new(Graphite)
+var _ inputs.InstancesGetter = new(Graphite)
+var _ inputs.SampleGatherer = new(Instance)
+
+func init() {
+	inputs.Add(inputName, func() inputs.Input {
+		return &Graphite{}
+	})
+}
+
+func (g *Graphite) Clone() inputs.Input {
+	return &Graphite{}
+}
+
+func (g *Graphite) Name() string {
+	return inputName
+}
+
+func (g *Graphite) GetInstances() []inputs.Instance {
+	ret := make([]inputs.Instance, len(g.Instances))
+	for i := 0; i < len(g.Instances); i++ {
+		ret[i] = g.Instances[i]
+	}
+	return ret
+}
+
+func (g *Graphite) Start(_ *types.SampleList) error {
+	for _, ins := range g.Instances {
+		if !ins.Initialized() {
+			continue
+		}
+		if err := ins.start(); err != nil {
+			log.Println("E! failed to start graphite listener:", err)
+		}
+	}
+	return nil
+}
+
+func (g *Graphite) Drop() {
+	for _, ins := range g.Instances {
+		ins.Drop()
+	}
+}
+
+type Instance struct {
+	config.InstanceConfig
+
+	// plaintext protocol, tcp://:2003 or udp://:2003
+	ServiceAddress string `toml:"service_address"`
+	// pickle protocol, tcp only, e.g. tcp://:2004
+	PickleAddress string     `toml:"pickle_address"`
+	Mappings      []*Mapping `toml:"mappings"`
+	// drop paths that match no mapping
+	StrictMatch bool `toml:"strict_match"`
+	// samples waiting to be gathered, more are dropped
+	MaxPendingSamples int `toml:"max_pending_samples"`
+	MaxTCPConnections int `toml:"max_tcp_connections"`
+	// max bytes of a pickle payload, each connection may hold one in memory
+	MaxPickleSize int `toml:"max_pickle_size"`
+
+	buffer  *types.SampleList
+	dropped uint64
+
+	server    *listener.Server
+	startOnce sync.Once
+}
+
+func (ins *Instance) Init() error {
+	if len(ins.ServiceAddress) == 0 && len(ins.PickleAddress) == 0 {
+		return types.ErrInstancesEmpty
+	}
+	for _, m := range ins.Mappings {
+		if err := m.init(); err != nil {
+			return err
+		}
+	}
+	if ins.MaxPendingSamples <= 0 {
+		ins.MaxPendingSamples = 100000
+	}
+	if ins.MaxTCPConnections <= 0 {
+		ins.MaxTCPConnections = 250
+	}
+	if ins.MaxPickleSize <= 0 {
+		ins.MaxPickleSize = 1024 * 1024
+	}
+	if len(ins.PickleAddress) > 0 {
+		if network, _ := listener.SplitAddress(ins.PickleAddress, "tcp"); !strings.HasPrefix(network, "tcp") {
+			return fmt.Errorf("pickle_address only supports tcp")
+		}
+	}
+	ins.buffer = types.NewSampleList()
+	ins.server = &listener.Server{Name: inputName, MaxTCPConnections: ins.MaxTCPConnections}
+	return nil
+}
+
+func (ins *Instance) start() error {
+	var err error
+	ins.startOnce.Do(func() {
+		if len(ins.ServiceAddress) > 0 {
+			if err = ins.listen(ins.ServiceAddress, ins.handlePlaintext); err != nil {
+				return
+			}
+		}
+		if len(ins.PickleAddress) > 0 {
+			err = ins.listen(ins.PickleAddress, ins.handlePickle)
+		}
+	})
+	return err
+}
+
+func (ins *Instance) listen(address string, handle func(net.Conn)) error {
+	network, addr := listener.SplitAddress(address, "tcp")
+	switch network {
+	case "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6":
+	default:
+		return fmt.Errorf("unsupported network %q of %s", network, address)
+	}
+	err := ins.server.Listen(network, addr, func(data []byte) {
+		for _, line := range strings.Split(string(data), "\n") {
+			ins.handleLine(line)
+		}
+	}, handle)
+	if err != nil {
+		return err
+	}
+	log.Println("I! graphite listening on", address)
+	return nil
+}
+
+func (ins *Instance) handlePlaintext(conn net.Conn) {
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		ins.handleLine(scanner.Text())
+	}
+}
+
+// handlePickle reads payloads of carbon pickle protocol,
+// each is a 4 bytes big endian length and the pickled data
+func (ins *Instance) handlePickle(conn net.Conn) {
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		size := binary.BigEndian.Uint32(header)
+		if uint64(size) > uint64(ins.MaxPickleSize) {
+			log.Println("E! graphite pickle payload too large:", size, "from", conn.RemoteAddr())
+			return
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(conn, data); err != nil {
+			return
+		}
+
+		v, err := unpickle(data)
+		if err != nil {
+			log.Println("E! failed to decode graphite pickle from", conn.RemoteAddr(), "error:", err)
+			return
+		}
+		l, ok := v.(*pickleList)
+		if !ok {
+			log.Println("E! graphite pickle payload is not a list, from", conn.RemoteAddr())
+			return
+		}
+		for _, item := range l.items {
+			path, value, ts, err := pickleItem(item)
+			if err != nil {
+				if ins.DebugMod {
+					log.Println("D! graphite:", err)
+				}
+				continue
+			}
+			ins.push(path, value, ts)
+		}
+	}
+}
+
+// pickleItem decodes (path, (timestamp, value))
+func pickleItem(item interface{}) (string, float64, time.Time, error) {
+	tuple := pickleItems(item)
+	if len(tuple) != 2 {
+		return "", 0, time.Time{}, fmt.Errorf("invalid pickle item: %v", item)
+	}
+	path, ok := tuple[0].(string)
+	if !ok {
+		return "", 0, time.Time{}, fmt.Errorf("invalid pickle path: %v", tuple[0])
+	}
+	point := pickleItems(tuple[1])
+	if len(point) != 2 {
+		return "", 0, time.Time{}, fmt.Errorf("invalid pickle point of %s: %v", path, tuple[1])
+	}
+	ts, err := pickleFloat(point[0])
+	if err != nil {
+		return "", 0, time.Time{}, err
+	}
+	value, err := pickleFloat(point[1])
+	if err != nil {
+		return "", 0, time.Time{}, err
+	}
+	return path, value, unixTime(ts), nil
+}
+
+func pickleItems(v interface{}) []interface{} {
+	switch t := v.(type) {
+	case []interface{}:
+		return t
+	case *pickleList:
+		return t.items
+	}
+	return nil
+}
+
+func pickleFloat(v interface{}) (float64, error) {
+	switch t := v.(type) {
+	case int64:
+		return float64(t), nil
+	case float64:
+		return t, nil
+	case string:
+		return strconv.ParseFloat(t, 64)
+	}
+	return 0, fmt.Errorf("invalid pickle number: %v", v)
+}
+
+// unixTime converts seconds to time, negative means now
+func unixTime(ts float64) time.Time {
+	if ts < 0 {
+		return time.Now()
+	}
+	sec, frac := math.Modf(ts)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
+
+func (ins *Instance) handleLine(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+	path, value, ts, err := parseLine(line)
+	if err != nil {
+		if ins.DebugMod {
+			log.Println("D! graphite:", err)
+		}
+		return
+	}
+	ins.push(path, value, ts)
+}
+
+// parseLine parses plaintext protocol: <path> <value> [timestamp]
+func parseLine(line string) (string, float64, time.Time, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return "", 0, time.Time{}, fmt.Errorf("invalid line: %s", line)
+	}
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return "", 0, time.Time{}, fmt.Errorf("invalid value of line: %s", line)
+	}
+	ts := time.Now()
+	if len(fields) == 3 {
+		sec, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return "", 0, time.Time{}, fmt.Errorf("invalid timestamp of line: %s", line)
+		}
+		ts = unixTime(sec)
+	}
+	return fields[0], value, ts, nil
+}
+
+// toSample maps the path to a sample, tags of tagged paths
+// such as a.b;tag1=v1;tag2=v2 are kept as labels
+func (ins *Instance) toSample(path string, value float64, ts time.Time) *types.Sample {
+	parts := strings.Split(path, ";")
+	name, labels, drop := mapPath(ins.Mappings, parts[0], ins.StrictMatch)
+	if drop {
+		return nil
+	}
+	for _, tag := range parts[1:] {
+		k, v, found := strings.Cut(tag, "=")
+		if !found || k == "" || v == "" {
+			continue
+		}
+		if _, has := labels[k]; !has {
+			labels[k] = v
+		}
+	}
+	return types.NewSample("", name, value, labels).SetTime(ts)
+}
+
+func (ins *Instance) push(path string, value float64, ts time.Time) {
+	s := ins.toSample(path, value, ts)
+	if s == nil {
+		return
+	}
+	if !ins.buffer.PushFrontIfNotFull(s, ins.MaxPendingSamples) {
+		atomic.AddUint64(&ins.dropped, 1)
+	}
+}
+
+func (ins *Instance) Gather(slist *types.SampleList) {
+	if n := atomic.SwapUint64(&ins.dropped, 0); n > 0 {
+		log.Println("W! graphite dropped", n, "samples, consider increasing max_pending_samples")
+	}
+	slist.PushFrontN(ins.buffer.PopBackAll())
+}
+
+func (ins *Instance) Drop() {
+	if ins.server != nil {
+		ins.server.Close()
+	}
+}
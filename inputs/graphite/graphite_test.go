@@ -0,0 +1,100 @@
+package graphite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func TestMapping(t *testing.T) {
+	ins := &Instance{
+		ServiceAddress: "tcp://:2003",
+		Mappings: []*Mapping{
+			{Match: "servers.*.cpu.*", Name: "server_cpu_${2}", Labels: map[string]string{"host": "${1}"}},
+			{Match: `^app\.(\w+)\.latency$`, MatchType: "regex", Name: "app_latency", Labels: map[string]string{"app": "${1}"}},
+			{Match: "debug.*", Action: "drop"},
+		},
+	}
+	if err := ins.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := ins.toSample("servers.web01.cpu.idle;dc=bj", 90, unixTime(1700000000))
+	if s.Metric != "server_cpu_idle" || s.Labels["host"] != "web01" || s.Labels["dc"] != "bj" {
+		t.Fatalf("unexpected sample: %+v", s)
+	}
+	if s.Timestamp.Unix() != 1700000000 {
+		t.Fatalf("unexpected timestamp: %v", s.Timestamp)
+	}
+
+	s = ins.toSample("app.order.latency", 1, unixTime(-1))
+	if s.Metric != "app_latency" || s.Labels["app"] != "order" {
+		t.Fatalf("unexpected sample: %+v", s)
+	}
+
+	if s = ins.toSample("debug.foo", 1, unixTime(-1)); s != nil {
+		t.Fatalf("expected dropped, got %+v", s)
+	}
+
+	s = ins.toSample("other.path", 1, unixTime(-1))
+	if s.Metric != "other_path" {
+		t.Fatalf("unexpected sample: %+v", s)
+	}
+
+	ins.StrictMatch = true
+	if s = ins.toSample("other.path", 1, unixTime(-1)); s != nil {
+		t.Fatalf("expected dropped by strict_match, got %+v", s)
+	}
+}
+
+func TestMappingTemplate(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"cpu_${1}_${2}", true},
+		{"cost_$$", true},
+		{"cpu_$1", false},
+		{"cpu_${3}", false},
+		{"cpu_${1", false},
+	}
+	for _, tt := range tests {
+		m := &Mapping{Match: "servers.*.cpu.*", Name: tt.name}
+		if err := m.init(); (err == nil) != tt.ok {
+			t.Fatalf("%s: expected ok=%v, got %v", tt.name, tt.ok, err)
+		}
+	}
+}
+
+func TestUnpickle(t *testing.T) {
+	// pickle.dumps([("a.b", (1700000000, 1.5)), ("c", (1700000001, 2))], protocol=2)
+	var buf bytes.Buffer
+	buf.Write([]byte{0x80, 2, ']', 'q', 0, '('})
+	buf.Write([]byte{'U', 3, 'a', '.', 'b', 'J'})
+	binary.Write(&buf, binary.LittleEndian, uint32(1700000000))
+	buf.WriteByte('G')
+	binary.Write(&buf, binary.BigEndian, math.Float64bits(1.5))
+	buf.Write([]byte{0x86, 0x86, 'U', 1, 'c', 'J'})
+	binary.Write(&buf, binary.LittleEndian, uint32(1700000001))
+	buf.Write([]byte{'K', 2, 0x86, 0x86, 'e', '.'})
+	data := buf.Bytes()
+
+	v, err := unpickle(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, ok := v.(*pickleList)
+	if !ok || len(l.items) != 2 {
+		t.Fatalf("unexpected result: %#v", v)
+	}
+
+	path, value, ts, err := pickleItem(l.items[0])
+	if err != nil || path != "a.b" || value != 1.5 || ts.Unix() != 1700000000 {
+		t.Fatalf("unexpected item: %s %v %v %v", path, value, ts, err)
+	}
+	path, value, ts, err = pickleItem(l.items[1])
+	if err != nil || path != "c" || value != 2 || ts.Unix() != 1700000001 {
+		t.Fatalf("unexpected item: %s %v %v %v", path, value, ts, err)
+	}
+}
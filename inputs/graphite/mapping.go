@@ -0,0 +1,143 @@
+package graphite
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	matchTypeGlob  = "glob"
+	matchTypeRegex = "regex"
+
+	actionMap  = "map"
+	actionDrop = "drop"
+)
+
+// Mapping maps a dotted graphite path to a metric name and labels,
+// it works like the mapping rules of graphite_exporter
+type Mapping struct {
+	// servers.*.cpu.* for glob, ^servers\.([^.]+)\.cpu\.(.*)$ for regex
+	Match string `toml:"match"`
+	// glob(default) or regex
+	MatchType string `toml:"match_type"`
+	// metric name, ${1} is replaced with the captured group, the braces are
+	// required since $1_cpu would refer to a group named 1_cpu
+	Name   string            `toml:"name"`
+	Labels map[string]string `toml:"labels"`
+	// map(default) or drop
+	Action string `toml:"action"`
+
+	re *regexp.Regexp
+}
+
+func (m *Mapping) init() error {
+	if m.Match == "" {
+		return fmt.Errorf("match of mapping is required")
+	}
+	if m.MatchType == "" {
+		m.MatchType = matchTypeGlob
+	}
+	if m.Action == "" {
+		m.Action = actionMap
+	}
+
+	var expr string
+	switch m.MatchType {
+	case matchTypeGlob:
+		// * matches one path component or a part of it
+		expr = "^" + strings.ReplaceAll(regexp.QuoteMeta(m.Match), `\*`, `([^.]*)`) + "$"
+	case matchTypeRegex:
+		expr = m.Match
+	default:
+		return fmt.Errorf("unsupported match_type %q of mapping %s", m.MatchType, m.Match)
+	}
+
+	switch m.Action {
+	case actionMap:
+		if m.Name == "" {
+			return fmt.Errorf("name of mapping %s is required", m.Match)
+		}
+	case actionDrop:
+	default:
+		return fmt.Errorf("unsupported action %q of mapping %s", m.Action, m.Match)
+	}
+
+	var err error
+	m.re, err = regexp.Compile(expr)
+	if err != nil {
+		return fmt.Errorf("failed to compile mapping %s: %v", m.Match, err)
+	}
+
+	if err = checkTemplate(m.re, m.Name); err != nil {
+		return fmt.Errorf("invalid name of mapping %s: %v", m.Match, err)
+	}
+	for k, v := range m.Labels {
+		if err = checkTemplate(m.re, v); err != nil {
+			return fmt.Errorf("invalid label %s of mapping %s: %v", k, m.Match, err)
+		}
+	}
+	return nil
+}
+
+// checkTemplate only accepts ${n} or ${name} of existing groups and $$
+func checkTemplate(re *regexp.Regexp, tmpl string) error {
+	for {
+		i := strings.IndexByte(tmpl, '$')
+		if i < 0 {
+			return nil
+		}
+		tmpl = tmpl[i+1:]
+		if strings.HasPrefix(tmpl, "$") {
+			tmpl = tmpl[1:]
+			continue
+		}
+		if !strings.HasPrefix(tmpl, "{") {
+			return fmt.Errorf("group reference must be written as ${1}")
+		}
+		end := strings.IndexByte(tmpl, '}')
+		if end < 0 {
+			return fmt.Errorf("unclosed group reference")
+		}
+		group := tmpl[1:end]
+		tmpl = tmpl[end+1:]
+		if n, err := strconv.Atoi(group); err == nil {
+			if n < 0 || n > re.NumSubexp() {
+				return fmt.Errorf("group ${%s} does not exist", group)
+			}
+			continue
+		}
+		if re.SubexpIndex(group) < 0 {
+			return fmt.Errorf("group ${%s} does not exist", group)
+		}
+	}
+}
+
+// mapPath returns the metric name and labels of a path, the first matched
+// mapping wins. drop is true if the path is dropped
+func mapPath(mappings []*Mapping, path string, strict bool) (name string, labels map[string]string, drop bool) {
+	for _, m := range mappings {
+		idx := m.re.FindStringSubmatchIndex(path)
+		if idx == nil {
+			continue
+		}
+		if m.Action == actionDrop {
+			return "", nil, true
+		}
+
+		name = string(m.re.ExpandString(nil, m.Name, path, idx))
+		labels = make(map[string]string, len(m.Labels))
+		for k, v := range m.Labels {
+			if v = string(m.re.ExpandString(nil, v, path, idx)); v != "" {
+				labels[k] = v
+			}
+		}
+		return name, labels, false
+	}
+
+	if strict {
+		return "", nil, true
+	}
+	return path, map[string]string{}, false
+}
@@ -0,0 +1,412 @@
+package graphite
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// pickle opcodes used by carbon clients, protocol 0 to 4
+const (
+	opMark            = '('
+	opStop            = '.'
+	opPop             = '0'
+	opPopMark         = '1'
+	opDup             = '2'
+	opFloat           = 'F'
+	opInt             = 'I'
+	opBinInt          = 'J'
+	opBinInt1         = 'K'
+	opLong            = 'L'
+	opBinInt2         = 'M'
+	opNone            = 'N'
+	opString          = 'S'
+	opBinString       = 'T'
+	opShortBinString  = 'U'
+	opUnicode         = 'V'
+	opBinUnicode      = 'X'
+	opAppend          = 'a'
+	opGet             = 'g'
+	opBinGet          = 'h'
+	opLongBinGet      = 'j'
+	opList            = 'l'
+	opEmptyList       = ']'
+	opPut             = 'p'
+	opBinPut          = 'q'
+	opLongBinPut      = 'r'
+	opTuple           = 't'
+	opEmptyTuple      = ')'
+	opAppends         = 'e'
+	opBinFloat        = 'G'
+	opProto           = 0x80
+	opTuple1          = 0x85
+	opTuple2          = 0x86
+	opTuple3          = 0x87
+	opNewTrue         = 0x88
+	opNewFalse        = 0x89
+	opLong1           = 0x8a
+	opShortBinBytes   = 'C'
+	opBinBytes        = 'B'
+	opShortBinUnicode = 0x8c
+	opMemoize         = 0x94
+	opFrame           = 0x95
+)
+
+var errPickleMark = errors.New("pickle: mark not found")
+
+// pickleList is a python list, it is a pointer so that appends
+// are visible through the memo
+type pickleList struct {
+	items []interface{}
+}
+
+type pickleMark struct{}
+
+// unpickle decodes the subset of python pickle used by carbon clients,
+// which is a list of (path, (timestamp, value)) tuples
+func unpickle(data []byte) (interface{}, error) {
+	r := bufio.NewReader(bytes.NewReader(data))
+	var stack []interface{}
+	memo := make(map[int]interface{})
+
+	pop := func() (interface{}, error) {
+		if len(stack) == 0 {
+			return nil, errors.New("pickle: stack underflow")
+		}
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return v, nil
+	}
+	popMark := func() ([]interface{}, error) {
+		for i := len(stack) - 1; i >= 0; i-- {
+			if _, ok := stack[i].(pickleMark); ok {
+				items := append([]interface{}{}, stack[i+1:]...)
+				stack = stack[:i]
+				return items, nil
+			}
+		}
+		return nil, errPickleMark
+	}
+	top := func() (interface{}, error) {
+		if len(stack) == 0 {
+			return nil, errors.New("pickle: stack underflow")
+		}
+		return stack[len(stack)-1], nil
+	}
+	readN := func(n int) ([]byte, error) {
+		if n < 0 || n > len(data) {
+			return nil, errors.New("pickle: invalid length")
+		}
+		buf := make([]byte, n)
+		_, err := io.ReadFull(r, buf)
+		return buf, err
+	}
+	readLine := func() (string, error) {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(line, "\n"), nil
+	}
+	readUint := func(n int) (int, error) {
+		buf, err := readN(n)
+		if err != nil {
+			return 0, err
+		}
+		var v uint64
+		for i := n - 1; i >= 0; i-- {
+			v = v<<8 | uint64(buf[i])
+		}
+		return int(v), nil
+	}
+
+	for {
+		op, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("pickle: %w", err)
+		}
+
+		switch op {
+		case opProto:
+			if _, err = r.ReadByte(); err != nil {
+				return nil, err
+			}
+		case opFrame:
+			if _, err = readN(8); err != nil {
+				return nil, err
+			}
+		case opStop:
+			return pop()
+		case opMark:
+			stack = append(stack, pickleMark{})
+		case opPop:
+			if _, err = pop(); err != nil {
+				return nil, err
+			}
+		case opPopMark:
+			if _, err = popMark(); err != nil {
+				return nil, err
+			}
+		case opDup:
+			v, err := top()
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, v)
+		case opNone:
+			stack = append(stack, nil)
+		case opNewTrue:
+			stack = append(stack, true)
+		case opNewFalse:
+			stack = append(stack, false)
+		case opInt:
+			line, err := readLine()
+			if err != nil {
+				return nil, err
+			}
+			switch line {
+			case "00":
+				stack = append(stack, false)
+			case "01":
+				stack = append(stack, true)
+			default:
+				v, err := strconv.ParseInt(line, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("pickle: %w", err)
+				}
+				stack = append(stack, v)
+			}
+		case opLong:
+			line, err := readLine()
+			if err != nil {
+				return nil, err
+			}
+			v, err := strconv.ParseInt(strings.TrimSuffix(line, "L"), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("pickle: %w", err)
+			}
+			stack = append(stack, v)
+		case opBinInt:
+			v, err := readUint(4)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, int64(int32(uint32(v))))
+		case opBinInt1:
+			v, err := readUint(1)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, int64(v))
+		case opBinInt2:
+			v, err := readUint(2)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, int64(v))
+		case opLong1:
+			n, err := readUint(1)
+			if err != nil {
+				return nil, err
+			}
+			buf, err := readN(n)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, decodeLong(buf))
+		case opFloat:
+			line, err := readLine()
+			if err != nil {
+				return nil, err
+			}
+			v, err := strconv.ParseFloat(line, 64)
+			if err != nil {
+				return nil, fmt.Errorf("pickle: %w", err)
+			}
+			stack = append(stack, v)
+		case opBinFloat:
+			buf, err := readN(8)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, math.Float64frombits(binary.BigEndian.Uint64(buf)))
+		case opString:
+			line, err := readLine()
+			if err != nil {
+				return nil, err
+			}
+			v, err := strconv.Unquote(pythonQuoted(line))
+			if err != nil {
+				return nil, fmt.Errorf("pickle: invalid string %s", line)
+			}
+			stack = append(stack, v)
+		case opUnicode:
+			line, err := readLine()
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, line)
+		case opShortBinString, opShortBinBytes, opShortBinUnicode:
+			n, err := readUint(1)
+			if err != nil {
+				return nil, err
+			}
+			buf, err := readN(n)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, string(buf))
+		case opBinString, opBinBytes, opBinUnicode:
+			n, err := readUint(4)
+			if err != nil {
+				return nil, err
+			}
+			buf, err := readN(n)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, string(buf))
+		case opEmptyList:
+			stack = append(stack, &pickleList{})
+		case opList:
+			items, err := popMark()
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, &pickleList{items: items})
+		case opAppend:
+			v, err := pop()
+			if err != nil {
+				return nil, err
+			}
+			if err = appendTo(stack, v); err != nil {
+				return nil, err
+			}
+		case opAppends:
+			items, err := popMark()
+			if err != nil {
+				return nil, err
+			}
+			if err = appendTo(stack, items...); err != nil {
+				return nil, err
+			}
+		case opEmptyTuple:
+			stack = append(stack, []interface{}{})
+		case opTuple:
+			items, err := popMark()
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, items)
+		case opTuple1, opTuple2, opTuple3:
+			n := int(op-opTuple1) + 1
+			if len(stack) < n {
+				return nil, errors.New("pickle: stack underflow")
+			}
+			items := append([]interface{}{}, stack[len(stack)-n:]...)
+			stack = append(stack[:len(stack)-n], items)
+		case opPut:
+			line, err := readLine()
+			if err != nil {
+				return nil, err
+			}
+			idx, err := strconv.Atoi(line)
+			if err != nil {
+				return nil, fmt.Errorf("pickle: %w", err)
+			}
+			if memo[idx], err = top(); err != nil {
+				return nil, err
+			}
+		case opBinPut, opLongBinPut:
+			n := 1
+			if op == opLongBinPut {
+				n = 4
+			}
+			idx, err := readUint(n)
+			if err != nil {
+				return nil, err
+			}
+			if memo[idx], err = top(); err != nil {
+				return nil, err
+			}
+		case opMemoize:
+			if memo[len(memo)], err = top(); err != nil {
+				return nil, err
+			}
+		case opGet, opBinGet, opLongBinGet:
+			var idx int
+			switch op {
+			case opGet:
+				line, err := readLine()
+				if err != nil {
+					return nil, err
+				}
+				if idx, err = strconv.Atoi(line); err != nil {
+					return nil, fmt.Errorf("pickle: %w", err)
+				}
+			case opBinGet:
+				idx, err = readUint(1)
+			default:
+				idx, err = readUint(4)
+			}
+			if err != nil {
+				return nil, err
+			}
+			v, has := memo[idx]
+			if !has {
+				return nil, fmt.Errorf("pickle: memo %d not found", idx)
+			}
+			stack = append(stack, v)
+		default:
+			return nil, fmt.Errorf("pickle: unsupported opcode 0x%x", op)
+		}
+	}
+}
+
+func appendTo(stack []interface{}, items ...interface{}) error {
+	if len(stack) == 0 {
+		return errors.New("pickle: stack underflow")
+	}
+	l, ok := stack[len(stack)-1].(*pickleList)
+	if !ok {
+		return errors.New("pickle: append to non-list")
+	}
+	l.items = append(l.items, items...)
+	return nil
+}
+
+// decodeLong decodes little endian two's complement integer of LONG1
+func decodeLong(buf []byte) interface{} {
+	if len(buf) == 0 {
+		return int64(0)
+	}
+	be := make([]byte, len(buf))
+	for i := range buf {
+		be[len(buf)-1-i] = buf[i]
+	}
+	v := new(big.Int).SetBytes(be)
+	if buf[len(buf)-1]&0x80 != 0 {
+		v.Sub(v, new(big.Int).Lsh(big.NewInt(1), uint(len(buf)*8)))
+	}
+	if v.IsInt64() {
+		return v.Int64()
+	}
+	f, _ := new(big.Float).SetInt(v).Float64()
+	return f
+}
+
+// pythonQuoted converts python repr quoting of protocol 0 strings to go quoting
+func pythonQuoted(s string) string {
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		inner := strings.ReplaceAll(s[1:len(s)-1], `\'`, `'`)
+		return `"` + strings.ReplaceAll(inner, `"`, `\"`) + `"`
+	}
+	return s
+}
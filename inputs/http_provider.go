@@ -1,11 +1,14 @@
 package inputs
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -30,13 +33,19 @@ type (
 		Timeout        int
 		ReloadInterval int
 
+		// long polling and last known good cache
+		LongPollTimeout int
+		CacheFile       string
+
 		tls.ClientConfig
-		client *http.Client
-		stopCh chan struct{}
-		op     InputOperation
+		client   *http.Client
+		cancel   context.CancelFunc
+		reloader sync.WaitGroup
+		op       InputOperation
 
 		configMap map[string]map[string]*cfg.ConfigWithFormat
 		version   string
+		etag      string
 
 		cache *innerCache
 		add   *innerCache
@@ -117,8 +126,19 @@ type httpProviderResponse struct {
 
 	// ConfigMap (InputName -> Config), if version is identical, server side can set Config to nil
 	Configs map[string]map[string]*cfg.ConfigWithFormat `json:"configs"`
+
+	etag string
+}
+
+// httpProviderCache is the last known good remote configs persisted in CacheFile
+type httpProviderCache struct {
+	Version string                                      `json:"version"`
+	ETag    string                                      `json:"etag"`
+	Configs map[string]map[string]*cfg.ConfigWithFormat `json:"configs"`
 }
 
+const defaultHTTPProviderCacheFile = "./data-provider/http_provider.json"
+
 func (hrp *HTTPProvider) Name() string {
 	return "http"
 }
@@ -136,9 +156,16 @@ func newHTTPProvider(c *config.ConfigType, op InputOperation) (*HTTPProvider, er
 		ClientConfig:   c.HTTPProviderConfig.ClientConfig,
 		Timeout:        c.HTTPProviderConfig.Timeout,
 		ReloadInterval: c.HTTPProviderConfig.ReloadInterval,
-		stopCh:         make(chan struct{}, 1),
 		op:             op,
 		cache:          newInnerCache(),
+
+		LongPollTimeout: c.HTTPProviderConfig.LongPollTimeout,
+	}
+	if !c.HTTPProviderConfig.DisableCache {
+		provider.CacheFile = c.HTTPProviderConfig.CacheFile
+		if provider.CacheFile == "" {
+			provider.CacheFile = defaultHTTPProviderCacheFile
+		}
 	}
 
 	if err := provider.check(); err != nil {
@@ -166,8 +193,13 @@ func (hrp *HTTPProvider) check() error {
 		return err
 	}
 
+	if hrp.LongPollTimeout < 0 {
+		hrp.LongPollTimeout = 0
+	}
+
 	hrp.client = &http.Client{
-		Timeout: time.Duration(hrp.Timeout) * time.Second,
+		// the server may hold a long polling request until LongPollTimeout
+		Timeout: time.Duration(hrp.Timeout+hrp.LongPollTimeout) * time.Second,
 		Transport: &http.Transport{
 			TLSClientConfig: tlsc,
 		},
@@ -176,8 +208,8 @@ func (hrp *HTTPProvider) check() error {
 	return nil
 }
 
-func (hrp *HTTPProvider) doReq() (*httpProviderResponse, error) {
-	req, err := http.NewRequest("GET", hrp.RemoteUrl, nil)
+func (hrp *HTTPProvider) doReq(ctx context.Context) (*httpProviderResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", hrp.RemoteUrl, nil)
 	if err != nil {
 		log.Println("E! http provider: build reload config request error:", err)
 		return nil, err
@@ -194,14 +226,27 @@ func (hrp *HTTPProvider) doReq() (*httpProviderResponse, error) {
 		req.SetBasicAuth(hrp.AuthUsername, hrp.AuthPassword)
 	}
 
+	hrp.RLock()
+	version, etag := hrp.version, hrp.etag
+	hrp.RUnlock()
+
+	// the server replies 304 if configs are not changed
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
 	// build query parameters
 	q := req.URL.Query()
 	for k, v := range config.GlobalLabels() {
 		q.Add(k, v)
 	}
 	q.Add("timestamp", fmt.Sprint(time.Now().Unix()))
-	q.Add("version", hrp.version)
+	q.Add("version", version)
 	q.Add("agent_hostname", config.Config.GetHostname())
+	if hrp.LongPollTimeout > 0 {
+		// the server may hold the request until configs change or wait seconds passed
+		q.Add("wait", fmt.Sprint(hrp.LongPollTimeout))
+	}
 	req.URL.RawQuery = q.Encode()
 
 	resp, err := hrp.client.Do(req)
@@ -216,6 +261,13 @@ func (hrp *HTTPProvider) doReq() (*httpProviderResponse, error) {
 		return nil, err
 	}
 
+	if resp.StatusCode == http.StatusNotModified {
+		return &httpProviderResponse{Version: version, etag: etag}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("http provider: remote returned %s", resp.Status)
+	}
+
 	confResp := &httpProviderResponse{}
 	err = json.Unmarshal(respData, confResp)
 	if err != nil {
@@ -223,37 +275,74 @@ func (hrp *HTTPProvider) doReq() (*httpProviderResponse, error) {
 		return nil, err
 	}
 
-	// set checksum for each config
+	confResp.Configs = normalizeConfigs(confResp.Configs)
+	confResp.etag = resp.Header.Get("ETag")
+
+	return confResp, nil
+}
+
+// normalizeConfigs lowercases input names and sets checksum for each config
+func normalizeConfigs(configs map[string]map[string]*cfg.ConfigWithFormat) map[string]map[string]*cfg.ConfigWithFormat {
 	newCfg := make(map[string]map[string]*cfg.ConfigWithFormat)
-	for k := range confResp.Configs {
+	for k := range configs {
 		lk := strings.TrimPrefix(strings.ToLower(k), "input.")
-		if _, ok := newCfg[lk]; !ok {
-			newCfg[lk] = make(map[string]*cfg.ConfigWithFormat)
-		}
-		for kk, vv := range confResp.Configs[k] {
+		for kk, vv := range configs[k] {
+			if vv == nil {
+				continue
+			}
+			if _, ok := newCfg[lk]; !ok {
+				newCfg[lk] = make(map[string]*cfg.ConfigWithFormat)
+			}
 			vv.SetCheckSum(kk)
 			newCfg[lk][kk] = vv
 		}
 	}
-	confResp.Configs = newCfg
-
-	return confResp, nil
+	return newCfg
 }
 
 func (hrp *HTTPProvider) LoadConfig() (bool, error) {
+	return hrp.loadConfig(context.Background())
+}
+
+func (hrp *HTTPProvider) loadConfig(ctx context.Context) (bool, error) {
+	confResp, err := hrp.request(ctx)
+	return hrp.updateConfig(ctx, confResp, err)
+}
+
+func (hrp *HTTPProvider) request(ctx context.Context) (*httpProviderResponse, error) {
 	log.Println("I! http provider: start reload config from remote:", hrp.RemoteUrl)
 
-	confResp, err := hrp.doReq()
+	confResp, err := hrp.doReq(ctx)
 	if err != nil {
 		log.Printf("W! http provider: request remote err: [%+v]", err)
+	}
+	return confResp, err
+}
+
+// updateConfig takes the configs of a response, err is the error of the request
+func (hrp *HTTPProvider) updateConfig(ctx context.Context, confResp *httpProviderResponse, err error) (bool, error) {
+	hrp.RLock()
+	version := hrp.version
+	hrp.RUnlock()
+
+	if err != nil {
+		// remote is down at startup
+		if version == "" && ctx.Err() == nil {
+			if changed, cerr := hrp.loadCache(); cerr == nil {
+				return changed, nil
+			}
+		}
 		return false, err
 	}
+	hrp.Lock()
+	hrp.etag = confResp.etag
+	hrp.Unlock()
 
 	// if config version is identical or empty , means config is not changed
-	if confResp.Version == hrp.version || confResp.Version == "" {
+	if confResp.Version == version || confResp.Version == "" {
 		return false, nil
 	}
-	log.Printf("I! remote version:%s, current version:%s", confResp.Version, hrp.version)
+	log.Printf("I! remote version:%s, current version:%s", confResp.Version, version)
 
 	// delete empty entries
 	for k, v := range confResp.Configs {
@@ -269,11 +358,67 @@ func (hrp *HTTPProvider) LoadConfig() (bool, error) {
 		hrp.configMap = confResp.Configs
 		hrp.version = confResp.Version
 		hrp.Unlock()
+		hrp.saveCache(confResp)
 	}
 
 	return changed, nil
 }
 
+// saveCache persists the remote configs as the last known good ones
+func (hrp *HTTPProvider) saveCache(confResp *httpProviderResponse) {
+	if hrp.CacheFile == "" {
+		return
+	}
+	bs, err := json.Marshal(httpProviderCache{
+		Version: confResp.Version,
+		ETag:    confResp.etag,
+		Configs: confResp.Configs,
+	})
+	if err != nil {
+		log.Println("E! http provider: failed to marshal cache:", err)
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(hrp.CacheFile), 0700); err != nil {
+		log.Println("E! http provider: failed to create cache dir:", err)
+		return
+	}
+	// configs may contain credentials
+	tmp := hrp.CacheFile + ".tmp"
+	if err = os.WriteFile(tmp, bs, 0600); err != nil {
+		log.Println("E! http provider: failed to write cache:", err)
+		return
+	}
+	if err = os.Rename(tmp, hrp.CacheFile); err != nil {
+		log.Println("E! http provider: failed to write cache:", err)
+	}
+}
+
+// loadCache loads the last known good remote configs
+func (hrp *HTTPProvider) loadCache() (bool, error) {
+	if hrp.CacheFile == "" {
+		return false, fmt.Errorf("cache is disabled")
+	}
+	bs, err := os.ReadFile(hrp.CacheFile)
+	if err != nil {
+		return false, err
+	}
+	cache := &httpProviderCache{}
+	if err = json.Unmarshal(bs, cache); err != nil {
+		log.Println("E! http provider: failed to unmarshal cache:", err)
+		return false, err
+	}
+	log.Println("W! http provider: remote is unavailable, use cached configs of version:", cache.Version)
+
+	configs := normalizeConfigs(cache.Configs)
+	hrp.caculateDiff(configs)
+	hrp.Lock()
+	hrp.configMap = configs
+	hrp.version = cache.Version
+	hrp.etag = cache.ETag
+	hrp.Unlock()
+	return hrp.add.len()+hrp.del.len() > 0, nil
+}
+
 func (hrp *HTTPProvider) serviceInput(inputKey string) bool {
 	switch inputKey {
 	case "zabbix":
@@ -294,48 +439,84 @@ func (hrp *HTTPProvider) preStop(inputKey string) error {
 	return nil
 }
 
+// pollWait returns the wait before the next request, with long polling the
+// server holds the request, so the next one is sent right after a response.
+// a response without changes far earlier than long_poll_timeout means the
+// server does not hold requests, the next one waits reload_interval
+func (hrp *HTTPProvider) pollWait(err error, changed bool, took time.Duration) time.Duration {
+	if hrp.LongPollTimeout <= 0 || err != nil {
+		return time.Duration(hrp.ReloadInterval) * time.Second
+	}
+	if !changed && took < time.Duration(hrp.LongPollTimeout)*time.Second/2 {
+		return time.Duration(hrp.ReloadInterval) * time.Second
+	}
+	return time.Second
+}
+
+// StartReloader polls the remote, changes are applied with the reload lock
+// of the provider held, so they do not interleave with admin api reloads
 func (hrp *HTTPProvider) StartReloader() {
+	ctx, cancel := context.WithCancel(context.Background())
+	hrp.cancel = cancel
+	hrp.reloader.Add(1)
 	go func() {
+		defer hrp.reloader.Done()
+		wait := hrp.pollWait(nil, true, 0)
 		for {
 			select {
-			case <-time.After(time.Duration(hrp.ReloadInterval) * time.Second):
-				changed, err := hrp.LoadConfig()
-				if err != nil {
-					continue
+			case <-time.After(wait):
+				start := time.Now()
+				confResp, err := hrp.request(ctx)
+				took := time.Since(start)
+				if ctx.Err() != nil {
+					return
 				}
-				if changed {
-					if hrp.add.len() > 0 {
-						log.Println("I! http provider: new or updated inputs:", hrp.add)
-						for inputKey, cm := range hrp.add.snapshot() {
-							hrp.preStop(inputKey)
-							for _, conf := range cm {
-								hrp.op.RegisterInput(FormatInputName(hrp.Name(), inputKey), []cfg.ConfigWithFormat{conf})
-							}
-						}
-					}
-
-					if hrp.del.len() > 0 {
-						log.Println("I! http provider: deleted inputs:", hrp.del)
-						for inputKey, cm := range hrp.del.snapshot() {
-							if hrp.serviceInput(inputKey) {
-								continue
-							}
-							for sum := range cm {
-								hrp.op.DeregisterInput(FormatInputName(hrp.Name(), inputKey), sum)
-							}
-						}
-					}
-
+				lock := ReloadLock(hrp.Name())
+				lock.Lock()
+				changed, err := hrp.updateConfig(ctx, confResp, err)
+				if err == nil && changed {
+					hrp.applyChanges()
 				}
-			case <-hrp.stopCh:
+				lock.Unlock()
+				wait = hrp.pollWait(err, changed, took)
+			case <-ctx.Done():
 				return
 			}
 		}
 	}()
 }
 
+// applyChanges registers new or updated inputs and deregisters deleted ones
+func (hrp *HTTPProvider) applyChanges() {
+	if hrp.add.len() > 0 {
+		log.Println("I! http provider: new or updated inputs:", hrp.add)
+		for inputKey, cm := range hrp.add.snapshot() {
+			hrp.preStop(inputKey)
+			for _, conf := range cm {
+				hrp.op.RegisterInput(FormatInputName(hrp.Name(), inputKey), []cfg.ConfigWithFormat{conf})
+			}
+		}
+	}
+
+	if hrp.del.len() > 0 {
+		log.Println("I! http provider: deleted inputs:", hrp.del)
+		for inputKey, cm := range hrp.del.snapshot() {
+			if hrp.serviceInput(inputKey) {
+				continue
+			}
+			for sum := range cm {
+				hrp.op.DeregisterInput(FormatInputName(hrp.Name(), inputKey), sum)
+			}
+		}
+	}
+}
+
+// StopReloader returns after the reloader exits
 func (hrp *HTTPProvider) StopReloader() {
-	hrp.stopCh <- struct{}{}
+	if hrp.cancel != nil {
+		hrp.cancel()
+	}
+	hrp.reloader.Wait()
 }
 
 func (hrp *HTTPProvider) GetInputs() ([]string, error) {
@@ -437,6 +618,14 @@ func (hrp *HTTPProvider) LoadInputConfig(configs []cfg.ConfigWithFormat, input I
 			}
 			continue
 		}
+		if err = checkUnknownKeys([]cfg.ConfigWithFormat{c}, nInput); err != nil {
+			log.Println("E! load http config error:", err)
+			continue
+		}
+		if err = config.ResolveSecrets(nInput); err != nil {
+			log.Println("E! resolve secrets of http config error:", err)
+			continue
+		}
 		inputs[c.CheckSum()] = nInput
 	}
 	return inputs, nil
@@ -1,8 +1,15 @@
 package inputs
 
 import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"flashcat.cloud/categraf/config"
 	"flashcat.cloud/categraf/pkg/cfg"
 )
 
@@ -57,3 +64,104 @@ func TestInnerCacheSnapshotReturnsCopy(t *testing.T) {
 		t.Fatal("mutating snapshot added input to cache")
 	}
 }
+
+func TestHTTPProviderETagAndCache(t *testing.T) {
+	if config.Config == nil {
+		config.Config = &config.ConfigType{}
+	}
+	if config.HostInfo == nil {
+		config.HostInfo = &config.HostInfoCache{}
+	}
+
+	requests, notModified := 0, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Query().Get("wait") != "30" {
+			t.Errorf("expected wait=30, got %q", r.URL.RawQuery)
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`{"version":"v1","configs":{"input.cpu":{"sum-a":{"config":"collect_per_cpu = true","format":"toml"}}}}`))
+	}))
+
+	cacheFile := filepath.Join(t.TempDir(), "http_provider.json")
+	c := &config.ConfigType{HTTPProviderConfig: &config.HTTPProviderConfig{
+		RemoteUrl:       ts.URL,
+		Timeout:         5,
+		ReloadInterval:  10,
+		LongPollTimeout: 30,
+		CacheFile:       cacheFile,
+	}}
+	hrp, err := newHTTPProvider(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := hrp.LoadConfig(); err != nil || !changed {
+		t.Fatalf("expected configs loaded, changed:%v err:%v", changed, err)
+	}
+	if changed, err := hrp.LoadConfig(); err != nil || changed {
+		t.Fatalf("expected configs not changed, changed:%v err:%v", changed, err)
+	}
+	if requests != 2 || notModified != 1 {
+		t.Fatalf("expected a conditional request, requests:%d not modified:%d", requests, notModified)
+	}
+	if info, err := os.Stat(cacheFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("expected cache file written: %v", err)
+	}
+
+	// remote is down at startup
+	ts.Close()
+	hrp, err = newHTTPProvider(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := hrp.LoadConfig(); err != nil || !changed {
+		t.Fatalf("expected configs loaded from cache, changed:%v err:%v", changed, err)
+	}
+	configs, err := hrp.GetInputConfig("cpu")
+	if err != nil || len(configs) != 1 || configs[0].CheckSum() != "sum-a" {
+		t.Fatalf("unexpected cached configs: %+v %v", configs, err)
+	}
+	if hrp.version != "v1" || hrp.etag != `"v1"` {
+		t.Fatalf("unexpected cached version:%s etag:%s", hrp.version, hrp.etag)
+	}
+
+	c.HTTPProviderConfig.DisableCache = true
+	hrp, err = newHTTPProvider(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hrp.LoadConfig(); err == nil {
+		t.Fatal("expected error without cache")
+	}
+}
+
+func TestHTTPProviderPollWait(t *testing.T) {
+	hrp := &HTTPProvider{ReloadInterval: 120, LongPollTimeout: 30}
+	tests := []struct {
+		name    string
+		err     error
+		changed bool
+		took    time.Duration
+		want    time.Duration
+	}{
+		{name: "held until timeout", took: 30 * time.Second, want: time.Second},
+		{name: "changed early", changed: true, took: time.Second, want: time.Second},
+		{name: "not held", took: 100 * time.Millisecond, want: 120 * time.Second},
+		{name: "error", err: errors.New("refused"), took: 30 * time.Second, want: 120 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := hrp.pollWait(tt.err, tt.changed, tt.took); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+
+	hrp.LongPollTimeout = 0
+	if got := hrp.pollWait(nil, true, 0); got != 120*time.Second {
+		t.Errorf("expected reload_interval without long polling, got %v", got)
+	}
+}
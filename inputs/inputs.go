@@ -1,6 +1,8 @@
 package inputs
 
 import (
+	"context"
+
 	"flashcat.cloud/categraf/config"
 	"flashcat.cloud/categraf/types"
 )
@@ -13,6 +15,18 @@ type SampleGatherer interface {
 	Gather(*types.SampleList)
 }
 
+// ErrorGatherer is implemented by inputs that report the error of a gather,
+// which is recorded in the gather health of the input
+type ErrorGatherer interface {
+	GatherWithError(*types.SampleList) error
+}
+
+// ContextGatherer is implemented by inputs that stop gathering
+// when the context is canceled by gather_timeout
+type ContextGatherer interface {
+	GatherContext(context.Context, *types.SampleList)
+}
+
 type Dropper interface {
 	Drop()
 }
@@ -28,10 +42,24 @@ func MayInit(t interface{}) error {
 	return nil
 }
 
-func MayGather(t interface{}, slist *types.SampleList) {
+// MayGather prefers GatherWithError to Gather
+func MayGather(t interface{}, slist *types.SampleList) error {
+	if gather, ok := t.(ErrorGatherer); ok {
+		return gather.GatherWithError(slist)
+	}
 	if gather, ok := t.(SampleGatherer); ok {
 		gather.Gather(slist)
 	}
+	return nil
+}
+
+// MayGatherContext prefers GatherContext to MayGather
+func MayGatherContext(ctx context.Context, t interface{}, slist *types.SampleList) error {
+	if gather, ok := t.(ContextGatherer); ok {
+		gather.GatherContext(ctx, slist)
+		return nil
+	}
+	return MayGather(t, slist)
 }
 
 func MayDrop(t interface{}) {
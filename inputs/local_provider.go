@@ -2,9 +2,11 @@ package inputs
 
 import (
 	"fmt"
+	"log"
 	"path"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/toolkits/pkg/file"
 
@@ -18,12 +20,26 @@ type LocalProvider struct {
 
 	configDir  string
 	inputNames []string
+
+	op       InputOperation
+	watch    bool
+	debounce time.Duration
+	watcher  *configWatcher
 }
 
-func newLocalProvider(c *config.ConfigType) (*LocalProvider, error) {
-	return &LocalProvider{
+func newLocalProvider(c *config.ConfigType, op InputOperation) (*LocalProvider, error) {
+	lp := &LocalProvider{
 		configDir: c.ConfigDir,
-	}, nil
+		op:        op,
+		debounce:  2 * time.Second,
+	}
+	if c.LocalProviderConfig != nil {
+		lp.watch = c.LocalProviderConfig.Watch
+		if c.LocalProviderConfig.Debounce > 0 {
+			lp.debounce = time.Duration(c.LocalProviderConfig.Debounce)
+		}
+	}
+	return lp, nil
 }
 
 func (lp *LocalProvider) Name() string {
@@ -31,9 +47,26 @@ func (lp *LocalProvider) Name() string {
 }
 
 // StartReloader 内部可以检查是否有配置的变更,如果有变更,则可以手动执行reloadFunc来重启插件
-func (lp *LocalProvider) StartReloader() {}
+// with watch enabled, changed inputs are reloaded after the debounce window
+func (lp *LocalProvider) StartReloader() {
+	if !lp.watch {
+		return
+	}
+	w, err := newConfigWatcher(lp)
+	if err != nil {
+		log.Println("E! local provider: failed to watch config dir:", err)
+		return
+	}
+	lp.watcher = w
+	w.start()
+}
 
-func (lp *LocalProvider) StopReloader() {}
+func (lp *LocalProvider) StopReloader() {
+	if lp.watcher != nil {
+		lp.watcher.stop()
+		lp.watcher = nil
+	}
+}
 
 func (lp *LocalProvider) LoadConfig() (bool, error) {
 	dirs, err := file.DirsUnder(lp.configDir)
@@ -104,6 +137,12 @@ func (lp *LocalProvider) LoadInputConfig(configs []cfg.ConfigWithFormat, input I
 	if err != nil {
 		return nil, err
 	}
+	if err = checkUnknownKeys(configs, input); err != nil {
+		return nil, err
+	}
+	if err = config.ResolveSecrets(input); err != nil {
+		return nil, err
+	}
 	return map[string]Input{
 		"default": input,
 	}, nil
@@ -0,0 +1,187 @@
+package inputs
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"flashcat.cloud/categraf/pkg/cfg"
+)
+
+// configWatcher watches the input config dirs of the local provider, and
+// restarts only the inputs whose configs changed
+type configWatcher struct {
+	lp      *LocalProvider
+	watcher *fsnotify.Watcher
+	// checksums of the running configs of inputs
+	sums   map[string]string
+	stopCh chan struct{}
+	done   sync.WaitGroup
+}
+
+func newConfigWatcher(lp *LocalProvider) (*configWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &configWatcher{
+		lp:      lp,
+		watcher: watcher,
+		sums:    make(map[string]string),
+		stopCh:  make(chan struct{}),
+	}
+	if err = watcher.Add(lp.configDir); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	w.watchInputDirs()
+	for inputKey, sum := range w.checksums() {
+		w.sums[inputKey] = sum
+	}
+	return w, nil
+}
+
+func (w *configWatcher) stop() {
+	close(w.stopCh)
+	w.done.Wait()
+	w.watcher.Close()
+}
+
+func (w *configWatcher) start() {
+	w.done.Add(1)
+	go w.run()
+}
+
+func (w *configWatcher) run() {
+	defer w.done.Done()
+
+	timer := time.NewTimer(w.lp.debounce)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-w.stopCh:
+			return
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			// reload once after the last change of the window
+			timer.Reset(w.lp.debounce)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Println("E! local provider: watch config dir error:", err)
+		case <-timer.C:
+			w.watchInputDirs()
+			w.reload()
+		}
+	}
+}
+
+// watchInputDirs watches new input dirs, removed ones are dropped by fsnotify
+func (w *configWatcher) watchInputDirs() {
+	matches, err := filepath.Glob(filepath.Join(w.lp.configDir, inputFilePrefix+"*"))
+	if err != nil {
+		return
+	}
+	for _, dir := range matches {
+		if err := w.watcher.Add(dir); err != nil {
+			log.Println("W! local provider: failed to watch", dir, "error:", err)
+		}
+	}
+}
+
+// checksums returns the checksum of configs of every input
+func (w *configWatcher) checksums() map[string]string {
+	ret := make(map[string]string)
+	if _, err := w.lp.LoadConfig(); err != nil {
+		log.Println("E! local provider: failed to load config:", err)
+		return ret
+	}
+	names, _ := w.lp.GetInputs()
+	for _, inputKey := range names {
+		configs, err := w.lp.GetInputConfig(inputKey)
+		if err != nil {
+			log.Println("E! local provider: failed to read config of input:", inputKey, "error:", err)
+			continue
+		}
+		ret[inputKey] = configsSum(configs)
+	}
+	return ret
+}
+
+func configsSum(configs []cfg.ConfigWithFormat) string {
+	h := md5.New()
+	for _, c := range configs {
+		h.Write([]byte(c.Format))
+		h.Write([]byte{0})
+		h.Write([]byte(c.Config))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// reload restarts the inputs with changed configs, a config failed to load or
+// init keeps the running input, and is retried on the next change. configs are
+// loaded once by ReplaceInput or RegisterInput, which resolves their secrets
+func (w *configWatcher) reload() {
+	lock := ReloadLock(w.lp.Name())
+	lock.Lock()
+	defer lock.Unlock()
+
+	sums := w.checksums()
+	var changed, removed []string
+	for inputKey, sum := range sums {
+		if w.sums[inputKey] != sum {
+			changed = append(changed, inputKey)
+		}
+	}
+	for inputKey := range w.sums {
+		if _, has := sums[inputKey]; !has {
+			removed = append(removed, inputKey)
+		}
+	}
+
+	for _, inputKey := range changed {
+		configs, err := w.lp.GetInputConfig(inputKey)
+		if err != nil {
+			log.Println("E! local provider: failed to read config of input:", inputKey, "error:", err)
+			continue
+		}
+		if _, has := InputCreators[inputKey]; !has {
+			w.sums[inputKey] = sums[inputKey]
+			continue
+		}
+
+		name := FormatInputName(w.lp.Name(), inputKey)
+		if _, had := w.sums[inputKey]; had {
+			if err := w.lp.op.ReplaceInput(name, configs); err != nil {
+				log.Println("E! local provider:", err, ", keep the running one")
+				continue
+			}
+		} else {
+			w.lp.op.RegisterInput(name, configs)
+		}
+		w.sums[inputKey] = sums[inputKey]
+		log.Println("I! local provider: input:", inputKey, "reloaded")
+	}
+
+	for _, inputKey := range removed {
+		if _, has := InputCreators[inputKey]; has {
+			w.lp.op.DeregisterInput(FormatInputName(w.lp.Name(), inputKey), "")
+			log.Println("I! local provider: input:", inputKey, "removed")
+		}
+		delete(w.sums, inputKey)
+	}
+}
@@ -0,0 +1,118 @@
+package inputs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/cfg"
+)
+
+type watchTestInput struct {
+	config.PluginConfig
+	Value string `toml:"value"`
+}
+
+func (w *watchTestInput) Clone() Input { return &watchTestInput{} }
+func (w *watchTestInput) Name() string { return "watch_test" }
+
+type watchTestOp struct {
+	registered   []string
+	deregistered []string
+	replaced     []string
+	// load loads the configs like ReplaceInput, which counts the loads
+	load  func([]cfg.ConfigWithFormat) error
+	loads int
+	// error of ReplaceInput, e.g. the new input failed to init
+	replaceErr error
+}
+
+func (op *watchTestOp) RegisterInput(name string, _ []cfg.ConfigWithFormat) {
+	op.registered = append(op.registered, name)
+}
+
+func (op *watchTestOp) DeregisterInput(name string, _ string) {
+	op.deregistered = append(op.deregistered, name)
+}
+
+func (op *watchTestOp) ReplaceInput(name string, configs []cfg.ConfigWithFormat) error {
+	op.loads++
+	if err := op.load(configs); err != nil {
+		return err
+	}
+	if op.replaceErr != nil {
+		return op.replaceErr
+	}
+	op.replaced = append(op.replaced, name)
+	return nil
+}
+
+func TestConfigWatcherReload(t *testing.T) {
+	if config.Config == nil {
+		config.Config = &config.ConfigType{}
+	}
+	Add("watch_test", func() Input { return &watchTestInput{} })
+	defer delete(InputCreators, "watch_test")
+
+	dir := t.TempDir()
+	inputDir := filepath.Join(dir, "input.watch_test")
+	if err := os.Mkdir(inputDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	conf := filepath.Join(inputDir, "watch_test.toml")
+	if err := os.WriteFile(conf, []byte(`value = "a"`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	op := &watchTestOp{}
+	lp, _ := newLocalProvider(&config.ConfigType{ConfigDir: dir}, op)
+	op.load = func(configs []cfg.ConfigWithFormat) error {
+		_, err := lp.LoadInputConfig(configs, &watchTestInput{})
+		return err
+	}
+	w, err := newConfigWatcher(lp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.stop()
+
+	w.reload()
+	if len(op.registered)+len(op.deregistered)+len(op.replaced) != 0 {
+		t.Fatalf("unexpected reload without changes: %+v", op)
+	}
+
+	// broken config keeps the running input
+	if err := os.WriteFile(conf, []byte(`value = `), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w.reload()
+	if len(op.registered)+len(op.deregistered)+len(op.replaced) != 0 || op.loads != 1 {
+		t.Fatalf("unexpected reload of broken config: %+v", op)
+	}
+
+	// config failed to init keeps the running input, and is retried
+	if err := os.WriteFile(conf, []byte(`value = "b"`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	op.replaceErr = errors.New("init failed")
+	w.reload()
+	if len(op.registered)+len(op.deregistered)+len(op.replaced) != 0 {
+		t.Fatalf("unexpected reload of config failed to init: %+v", op)
+	}
+
+	op.replaceErr = nil
+	w.reload()
+	if len(op.replaced) != 1 || len(op.registered)+len(op.deregistered) != 0 || op.replaced[0] != "local.watch_test" || op.loads != 3 {
+		t.Fatalf("expected input restarted: %+v", op)
+	}
+
+	if err := os.RemoveAll(inputDir); err != nil {
+		t.Fatal(err)
+	}
+	w.reload()
+	if len(op.deregistered) != 1 || len(op.registered) != 0 {
+		t.Fatalf("expected input removed: %+v", op)
+	}
+}
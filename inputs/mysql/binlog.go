@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"strconv"
@@ -10,12 +11,12 @@ import (
 	"flashcat.cloud/categraf/types"
 )
 
-func (ins *Instance) gatherBinlog(slist *types.SampleList, db *sql.DB, globalTags map[string]string) {
+func (ins *Instance) gatherBinlog(ctx context.Context, slist *types.SampleList, db *sql.DB, globalTags map[string]string) {
 	if ins.DisablebinLogs {
 		return
 	}
 	var logBin uint8
-	err := db.QueryRow(`SELECT @@log_bin`).Scan(&logBin)
+	err := db.QueryRowContext(ctx, `SELECT @@log_bin`).Scan(&logBin)
 	if err != nil {
 		log.Println("E! failed to query SELECT @@log_bin:", err)
 		return
@@ -26,7 +27,7 @@ func (ins *Instance) gatherBinlog(slist *types.SampleList, db *sql.DB, globalTag
 		return
 	}
 
-	rows, err := db.Query(`SHOW BINARY LOGS`)
+	rows, err := db.QueryContext(ctx, `SHOW BINARY LOGS`)
 	if err != nil {
 		log.Println("E! failed to query SHOW BINARY LOGS:", err)
 		return
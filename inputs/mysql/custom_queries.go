@@ -13,26 +13,26 @@ import (
 	"flashcat.cloud/categraf/types"
 )
 
-func (ins *Instance) gatherCustomQueries(slist *types.SampleList, db *sql.DB, globalTags map[string]string) {
+func (ins *Instance) gatherCustomQueries(ctx context.Context, slist *types.SampleList, db *sql.DB, globalTags map[string]string) {
 	wg := new(sync.WaitGroup)
 	defer wg.Wait()
 
 	for i := 0; i < len(ins.Queries); i++ {
 		wg.Add(1)
-		go ins.gatherOneQuery(slist, db, globalTags, wg, ins.Queries[i])
+		go ins.gatherOneQuery(ctx, slist, db, globalTags, wg, ins.Queries[i])
 	}
 
 	for i := 0; i < len(ins.GlobalQueries); i++ {
 		wg.Add(1)
-		go ins.gatherOneQuery(slist, db, globalTags, wg, ins.GlobalQueries[i])
+		go ins.gatherOneQuery(ctx, slist, db, globalTags, wg, ins.GlobalQueries[i])
 	}
 }
 
-func (ins *Instance) gatherOneQuery(slist *types.SampleList, db *sql.DB, globalTags map[string]string, wg *sync.WaitGroup, query QueryConfig) {
+func (ins *Instance) gatherOneQuery(ctx context.Context, slist *types.SampleList, db *sql.DB, globalTags map[string]string, wg *sync.WaitGroup, query QueryConfig) {
 	defer wg.Done()
 
 	timeout := time.Duration(query.Timeout)
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	rows, err := db.QueryContext(ctx, query.Request)
@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"regexp"
@@ -11,11 +12,11 @@ import (
 	"flashcat.cloud/categraf/types"
 )
 
-func (ins *Instance) gatherEngineInnodbStatus(slist *types.SampleList, db *sql.DB, globalTags map[string]string, cache map[string]float64) {
+func (ins *Instance) gatherEngineInnodbStatus(ctx context.Context, slist *types.SampleList, db *sql.DB, globalTags map[string]string, cache map[string]float64) {
 	if ins.DisableInnodbStatus {
 		return
 	}
-	rows, err := db.Query(SQL_ENGINE_INNODB_STATUS)
+	rows, err := db.QueryContext(ctx, SQL_ENGINE_INNODB_STATUS)
 	if err != nil {
 		log.Println("E! failed to query engine innodb status:", err)
 		return
@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"regexp"
@@ -15,11 +16,11 @@ import (
 // Regexp to match various groups of status vars.
 var globalStatusRE = regexp.MustCompile(`^(com|handler|connection_errors|innodb_buffer_pool_pages|innodb_rows|performance_schema)_(.*)$`)
 
-func (ins *Instance) gatherGlobalStatus(slist *types.SampleList, db *sql.DB, globalTags map[string]string, cache map[string]float64) {
+func (ins *Instance) gatherGlobalStatus(ctx context.Context, slist *types.SampleList, db *sql.DB, globalTags map[string]string, cache map[string]float64) {
 	if ins.DisableGlobalStatus {
 		return
 	}
-	rows, err := db.Query(SQL_GLOBAL_STATUS)
+	rows, err := db.QueryContext(ctx, SQL_GLOBAL_STATUS)
 	if err != nil {
 		log.Println("E! failed to query global status:", err)
 		return
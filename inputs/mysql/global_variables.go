@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"regexp"
@@ -11,11 +12,11 @@ import (
 	"flashcat.cloud/categraf/types"
 )
 
-func (ins *Instance) gatherGlobalVariables(slist *types.SampleList, db *sql.DB, globalTags map[string]string, cache map[string]float64) {
+func (ins *Instance) gatherGlobalVariables(ctx context.Context, slist *types.SampleList, db *sql.DB, globalTags map[string]string, cache map[string]float64) {
 	if ins.DisableGlobalStatus {
 		return
 	}
-	rows, err := db.Query(SQL_GLOBAL_VARIABLES)
+	rows, err := db.QueryContext(ctx, SQL_GLOBAL_VARIABLES)
 	if err != nil {
 		log.Println("E! failed to query global variables:", err)
 		return
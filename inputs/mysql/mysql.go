@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
@@ -191,6 +192,11 @@ func (m *MySQL) GetInstances() []inputs.Instance {
 }
 
 func (ins *Instance) Gather(slist *types.SampleList) {
+	ins.GatherContext(context.Background(), slist)
+}
+
+// GatherContext stops the running queries once ctx is done, e.g. on gather_timeout
+func (ins *Instance) GatherContext(ctx context.Context, slist *types.SampleList) {
 	tags := map[string]string{"address": ins.Address}
 
 	begun := time.Now()
@@ -214,7 +220,7 @@ func (ins *Instance) Gather(slist *types.SampleList) {
 	db.SetMaxIdleConns(1)
 	db.SetConnMaxLifetime(time.Minute)
 
-	if err = db.Ping(); err != nil {
+	if err = db.PingContext(ctx); err != nil {
 		slist.PushSample(inputName, "up", 0, tags)
 		log.Println("E! failed to ping mysql:", err)
 		return
@@ -224,19 +230,19 @@ func (ins *Instance) Gather(slist *types.SampleList) {
 
 	cache := make(map[string]float64)
 
-	ins.gatherGlobalStatus(slist, db, tags, cache)
-	ins.gatherGlobalVariables(slist, db, tags, cache)
-	ins.gatherEngineInnodbStatus(slist, db, tags, cache)
+	ins.gatherGlobalStatus(ctx, slist, db, tags, cache)
+	ins.gatherGlobalVariables(ctx, slist, db, tags, cache)
+	ins.gatherEngineInnodbStatus(ctx, slist, db, tags, cache)
 	ins.gatherEngineInnodbStatusCompute(slist, db, tags, cache)
-	ins.gatherBinlog(slist, db, tags)
-	ins.gatherProcesslistByState(slist, db, tags)
-	ins.gatherProcesslistByUser(slist, db, tags)
-	ins.gatherSchemaSize(slist, db, tags)
-	ins.gatherTableSize(slist, db, tags, false)
-	ins.gatherTableSize(slist, db, tags, true)
-	ins.gatherSlaveStatus(slist, db, tags)
-	ins.gatherCustomQueries(slist, db, tags)
-	ins.gatherBinaryLogs(slist, db, tags)
-	ins.gatherReplicaStatus(slist, db, tags)
+	ins.gatherBinlog(ctx, slist, db, tags)
+	ins.gatherProcesslistByState(ctx, slist, db, tags)
+	ins.gatherProcesslistByUser(ctx, slist, db, tags)
+	ins.gatherSchemaSize(ctx, slist, db, tags)
+	ins.gatherTableSize(ctx, slist, db, tags, false)
+	ins.gatherTableSize(ctx, slist, db, tags, true)
+	ins.gatherSlaveStatus(ctx, slist, db, tags)
+	ins.gatherCustomQueries(ctx, slist, db, tags)
+	ins.gatherBinaryLogs(ctx, slist, db, tags)
+	ins.gatherReplicaStatus(ctx, slist, db, tags)
 
 }
@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"strings"
@@ -89,12 +90,12 @@ var (
 	}
 )
 
-func (ins *Instance) gatherProcesslistByState(slist *types.SampleList, db *sql.DB, globalTags map[string]string) {
+func (ins *Instance) gatherProcesslistByState(ctx context.Context, slist *types.SampleList, db *sql.DB, globalTags map[string]string) {
 	if !ins.GatherProcessListProcessByState {
 		return
 	}
 
-	rows, err := db.Query(SQL_INFO_SCHEMA_PROCESSLIST)
+	rows, err := db.QueryContext(ctx, SQL_INFO_SCHEMA_PROCESSLIST)
 	if err != nil {
 		log.Println("E! failed to get processlist:", err)
 		return
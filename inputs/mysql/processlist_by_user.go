@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"log"
 
@@ -8,12 +9,12 @@ import (
 	"flashcat.cloud/categraf/types"
 )
 
-func (ins *Instance) gatherProcesslistByUser(slist *types.SampleList, db *sql.DB, globalTags map[string]string) {
+func (ins *Instance) gatherProcesslistByUser(ctx context.Context, slist *types.SampleList, db *sql.DB, globalTags map[string]string) {
 	if !ins.GatherProcessListProcessByUser {
 		return
 	}
 
-	rows, err := db.Query(SQL_INFO_SCHEMA_PROCESSLIST_BY_USER)
+	rows, err := db.QueryContext(ctx, SQL_INFO_SCHEMA_PROCESSLIST_BY_USER)
 	if err != nil {
 		log.Println("E! failed to get processlist:", err)
 		return
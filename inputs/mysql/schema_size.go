@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"log"
 
@@ -8,12 +9,12 @@ import (
 	"flashcat.cloud/categraf/types"
 )
 
-func (ins *Instance) gatherSchemaSize(slist *types.SampleList, db *sql.DB, globalTags map[string]string) {
+func (ins *Instance) gatherSchemaSize(ctx context.Context, slist *types.SampleList, db *sql.DB, globalTags map[string]string) {
 	if !ins.GatherSchemaSize {
 		return
 	}
 
-	rows, err := db.Query(SQL_QUERY_SCHEMA_SIZE)
+	rows, err := db.QueryContext(ctx, SQL_QUERY_SCHEMA_SIZE)
 	if err != nil {
 		log.Println("E! failed to get schema size of", ins.Address, err)
 		return
@@ -2,6 +2,7 @@ package mysql
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
@@ -17,16 +18,16 @@ var slaveStatusQuerySuffixes = [3]string{" NONBLOCKING", " NOLOCK", ""}
 var replicaStatusQuery = [2]string{"SHOW ALL REPLICAS STATUS", "SHOW REPLICA STATUS"}
 var binaryLogsQuery = `SHOW BINARY LOGS`
 
-func querySlaveStatus(db *sql.DB) (rows *sql.Rows, err error) {
+func querySlaveStatus(ctx context.Context, db *sql.DB) (rows *sql.Rows, err error) {
 	for _, query := range slaveStatusQueries {
-		rows, err = db.Query(query)
+		rows, err = db.QueryContext(ctx, query)
 		if err == nil {
 			return rows, nil
 		}
 
 		// Leverage lock-free SHOW SLAVE STATUS by guessing the right suffix
 		for _, suffix := range slaveStatusQuerySuffixes {
-			rows, err = db.Query(fmt.Sprint(query, suffix))
+			rows, err = db.QueryContext(ctx, fmt.Sprint(query, suffix))
 			if err == nil {
 				return rows, nil
 			}
@@ -35,12 +36,12 @@ func querySlaveStatus(db *sql.DB) (rows *sql.Rows, err error) {
 	return
 }
 
-func (ins *Instance) gatherSlaveStatus(slist *types.SampleList, db *sql.DB, globalTags map[string]string) {
+func (ins *Instance) gatherSlaveStatus(ctx context.Context, slist *types.SampleList, db *sql.DB, globalTags map[string]string) {
 	if !ins.GatherSlaveStatus {
 		return
 	}
 
-	rows, err := querySlaveStatus(db)
+	rows, err := querySlaveStatus(ctx, db)
 	if err != nil {
 		log.Println("E! failed to query slave status:", err)
 		return
@@ -119,12 +120,12 @@ func columnValue(scanArgs []interface{}, slaveCols []string, colName string) str
 	return string(*scanArgs[columnIndex].(*sql.RawBytes))
 }
 
-func (ins *Instance) gatherBinaryLogs(slist *types.SampleList, db *sql.DB, tags map[string]string) error {
+func (ins *Instance) gatherBinaryLogs(ctx context.Context, slist *types.SampleList, db *sql.DB, tags map[string]string) error {
 	if !ins.GatherBinaryLogs {
 		return nil
 	}
 	// run query
-	rows, err := db.Query(binaryLogsQuery)
+	rows, err := db.QueryContext(ctx, binaryLogsQuery)
 	if err != nil {
 		return err
 	}
@@ -168,13 +169,13 @@ func (ins *Instance) gatherBinaryLogs(slist *types.SampleList, db *sql.DB, tags
 	return nil
 }
 
-func (ins *Instance) gatherReplicaStatus(slist *types.SampleList, db *sql.DB, globalTags map[string]string) error {
+func (ins *Instance) gatherReplicaStatus(ctx context.Context, slist *types.SampleList, db *sql.DB, globalTags map[string]string) error {
 	if !ins.GatherReplicaStatus {
 		return nil
 	}
 	var err error
 	for _, query := range replicaStatusQuery {
-		err = ins.gatherReplicaStatusOnce(slist, db, globalTags, query)
+		err = ins.gatherReplicaStatusOnce(ctx, slist, db, globalTags, query)
 		if err == nil {
 			return nil
 		}
@@ -184,13 +185,13 @@ func (ins *Instance) gatherReplicaStatus(slist *types.SampleList, db *sql.DB, gl
 	return err
 }
 
-func (ins *Instance) gatherReplicaStatusOnce(slist *types.SampleList, db *sql.DB, globalTags map[string]string, query string) error {
+func (ins *Instance) gatherReplicaStatusOnce(ctx context.Context, slist *types.SampleList, db *sql.DB, globalTags map[string]string, query string) error {
 	// run query
 	var rows *sql.Rows
 	var err error
 	tags := tagx.Copy(globalTags)
 
-	rows, err = db.Query(query)
+	rows, err = db.QueryContext(ctx, query)
 	if err != nil {
 		return err
 	}
@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"log"
 
@@ -8,7 +9,7 @@ import (
 	"flashcat.cloud/categraf/types"
 )
 
-func (ins *Instance) gatherTableSize(slist *types.SampleList, db *sql.DB, globalTags map[string]string, isSystem bool) {
+func (ins *Instance) gatherTableSize(ctx context.Context, slist *types.SampleList, db *sql.DB, globalTags map[string]string, isSystem bool) {
 	query := SQL_QUERY_TABLE_SIZE
 	if isSystem {
 		query = SQL_QUERY_SYSTEM_TABLE_SIZE
@@ -21,7 +22,7 @@ func (ins *Instance) gatherTableSize(slist *types.SampleList, db *sql.DB, global
 		}
 	}
 
-	rows, err := db.Query(query)
+	rows, err := db.QueryContext(ctx, query)
 	if err != nil {
 		log.Println("E! failed to get table size:", err)
 		return
@@ -3,6 +3,7 @@ package inputs
 import (
 	"log"
 	"strings"
+	"sync"
 
 	"flashcat.cloud/categraf/config"
 	"flashcat.cloud/categraf/pkg/cfg"
@@ -13,6 +14,18 @@ const inputFilePrefix = "input."
 type InputOperation interface {
 	RegisterInput(string, []cfg.ConfigWithFormat)
 	DeregisterInput(string, string)
+	// ReplaceInput stops the running input only after the new one is loaded and initialized
+	ReplaceInput(string, []cfg.ConfigWithFormat) error
+}
+
+// reloadLocks are the reload locks of providers by name
+var reloadLocks sync.Map
+
+// ReloadLock returns the lock held while inputs of a provider are reloaded,
+// by its reloader or watcher, admin apis and the agent
+func ReloadLock(provider string) *sync.Mutex {
+	lock, _ := reloadLocks.LoadOrStore(provider, new(sync.Mutex))
+	return lock.(*sync.Mutex)
 }
 
 // FormatInputName providerName + '.' + inputKey
@@ -81,7 +94,7 @@ func NewProvider(c *config.ConfigType, op InputOperation) ([]Provider, error) {
 			}
 			providers = append(providers, provider)
 		case "local":
-			provider, err := newLocalProvider(c)
+			provider, err := newLocalProvider(c, op)
 			if err != nil {
 				return nil, err
 			}
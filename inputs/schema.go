@@ -0,0 +1,20 @@
+package inputs
+
+import (
+	"flashcat.cloud/categraf/pkg/cfg"
+)
+
+// Schema returns the json schema of the toml options of every registered input
+func Schema() map[string]interface{} {
+	props := make(map[string]interface{}, len(InputCreators))
+	for name, creator := range InputCreators {
+		props[name] = cfg.Schema(creator())
+	}
+	return map[string]interface{}{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"title":       "categraf inputs",
+		"description": "toml options of inputs, keyed by input name",
+		"type":        "object",
+		"properties":  props,
+	}
+}
@@ -8,6 +8,8 @@ import (
 
 	"flashcat.cloud/categraf/config"
 	"flashcat.cloud/categraf/inputs"
+	"flashcat.cloud/categraf/pkg/cardinality"
+	"flashcat.cloud/categraf/pkg/health"
 	"flashcat.cloud/categraf/pkg/metrics"
 	"flashcat.cloud/categraf/types"
 	"flashcat.cloud/categraf/writer"
@@ -53,6 +55,61 @@ func (ins *Categraf) Gather(slist *types.SampleList) {
 	slist.PushSample(defaultPrefix, "metrics_enqueue_failed_sum", ss.FailTotal, vTag)
 	slist.PushSample(defaultPrefix, "metrics_enqueue_failed_count", ss.FailCount, vTag)
 	slist.PushSample(defaultPrefix, "current_queue_size", ss.QueueSize, vTag)
+	slist.PushSample(defaultPrefix, "disk_buffer_size_bytes", ss.DiskBufferSize, vTag)
+	slist.PushSample(defaultPrefix, "disk_buffer_oldest_age_seconds", ss.DiskBufferOldestAge, vTag)
+
+	// writer metrics
+	for _, ws := range writer.WriterMetrics() {
+		wTag := map[string]string{
+			"version": config.Version,
+			"url":     ws.Url,
+		}
+		slist.PushSample(defaultPrefix, "writer_queue_size", ws.QueueSize, wTag)
+		slist.PushSample(defaultPrefix, "writer_circuit_breaker_state", ws.BreakerState, wTag)
+		slist.PushSample(defaultPrefix, "writer_retry_total", ws.RetryTotal, wTag)
+		slist.PushSample(defaultPrefix, "writer_failed_total", ws.FailTotal, wTag)
+		slist.PushSample(defaultPrefix, "writer_dropped_series_total", ws.DropTotal, wTag)
+		slist.PushSample(defaultPrefix, "writer_skipped_histograms_total", ws.SkippedHistogramTotal, wTag)
+		slist.PushSample(defaultPrefix, "writer_disk_buffer_size_bytes", ws.DiskBufferSize, wTag)
+		slist.PushSample(defaultPrefix, "writer_disk_buffer_oldest_age_seconds", ws.DiskBufferOldestAge, wTag)
+	}
+
+	// series limit metrics
+	if g := cardinality.Global(); g != nil {
+		slist.PushSample(defaultPrefix, "series_limit_global_series", g.Len(), vTag)
+	}
+	for _, ds := range cardinality.Dropped(10) {
+		dTag := map[string]string{
+			"version": config.Version,
+			"input":   ds.Input,
+			"scope":   ds.Scope,
+		}
+		slist.PushSample(defaultPrefix, "series_limit_dropped_total", ds.Dropped, dTag)
+		for _, mc := range ds.Top {
+			slist.PushSample(defaultPrefix, "series_limit_top_dropped", mc.Count, dTag, map[string]string{"metric": mc.Metric})
+		}
+	}
+
+	// gather health of inputs and instances
+	for _, hs := range health.All() {
+		hTag := map[string]string{
+			"version": config.Version,
+			"input":   hs.Input,
+		}
+		if hs.Instance != "" {
+			hTag["instance"] = hs.Instance
+		}
+		slist.PushSample(defaultPrefix, "input_gather_total", hs.Gathers, hTag)
+		slist.PushSample(defaultPrefix, "input_gather_duration_seconds", hs.Duration, hTag)
+		slist.PushSample(defaultPrefix, "input_gather_samples", hs.Samples, hTag)
+		slist.PushSample(defaultPrefix, "input_gather_panics_total", hs.Panics, hTag)
+		slist.PushSample(defaultPrefix, "input_gather_skipped_total", hs.Skipped, hTag)
+		slist.PushSample(defaultPrefix, "input_gather_timeouts_total", hs.Timeouts, hTag)
+		slist.PushSample(defaultPrefix, "input_gather_errors_total", hs.Errors, hTag)
+		if !hs.LastSuccess.IsZero() {
+			slist.PushSample(defaultPrefix, "input_gather_last_success_timestamp_seconds", hs.LastSuccess.Unix(), hTag)
+		}
+	}
 
 	for _, mf := range mfs {
 		metricName := mf.GetName()
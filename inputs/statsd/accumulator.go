@@ -0,0 +1,138 @@
+package statsd
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"flashcat.cloud/categraf/pkg/metrics"
+	"flashcat.cloud/categraf/types"
+)
+
+type series struct {
+	name string
+	typ  string
+	tags map[string]string
+
+	// counter and gauge
+	value float64
+	// set
+	set map[string]struct{}
+	// timer, histogram and distribution, count and sum are scaled by sample rate
+	count  float64
+	sum    float64
+	min    float64
+	max    float64
+	values []float64
+}
+
+// accumulator aggregates parsed metrics in a flush interval
+type accumulator struct {
+	percentiles  []float64
+	limit        int
+	deleteGauges bool
+
+	lock   sync.Mutex
+	series map[string]*series
+}
+
+func newAccumulator(percentiles []float64, limit int, deleteGauges bool) *accumulator {
+	return &accumulator{
+		percentiles:  percentiles,
+		limit:        limit,
+		deleteGauges: deleteGauges,
+		series:       make(map[string]*series),
+	}
+}
+
+func (a *accumulator) add(m *metric) {
+	typ := m.typ
+	if typ == typeHistogram || typ == typeDistribution {
+		typ = typeTimer
+	}
+	key := types.SeriesKey(m.name+"|"+typ, m.tags)
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	s, has := a.series[key]
+	if !has {
+		s = &series{name: m.name, typ: typ, tags: m.tags}
+		a.series[key] = s
+	}
+
+	for _, v := range m.values {
+		switch typ {
+		case typeSet:
+			if s.set == nil {
+				s.set = make(map[string]struct{})
+			}
+			s.set[v] = struct{}{}
+			continue
+		}
+
+		f, _ := strconv.ParseFloat(v, 64)
+		switch typ {
+		case typeCounter:
+			s.value += f / m.rate
+		case typeGauge:
+			// +N and -N change the gauge if it exists
+			if has && (strings.HasPrefix(v, "+") || strings.HasPrefix(v, "-")) {
+				s.value += f
+			} else {
+				s.value = f
+			}
+		case typeTimer:
+			if s.count == 0 || f < s.min {
+				s.min = f
+			}
+			if s.count == 0 || f > s.max {
+				s.max = f
+			}
+			s.count += 1 / m.rate
+			s.sum += f / m.rate
+			if len(s.values) < a.limit {
+				s.values = append(s.values, f)
+			}
+		}
+		has = true
+	}
+}
+
+// flush pushes the aggregated samples and resets the state,
+// gauges are kept unless delete_gauges is set
+func (a *accumulator) flush(slist *types.SampleList) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	for key, s := range a.series {
+		switch s.typ {
+		case typeCounter:
+			slist.PushFront(types.NewSample("", s.name, s.value, s.tags))
+			delete(a.series, key)
+		case typeGauge:
+			slist.PushFront(types.NewSample("", s.name, s.value, s.tags))
+			if a.deleteGauges {
+				delete(a.series, key)
+			}
+		case typeSet:
+			slist.PushFront(types.NewSample("", s.name, len(s.set), s.tags))
+			delete(a.series, key)
+		case typeTimer:
+			if s.count > 0 {
+				slist.PushFront(types.NewSample("", s.name+"_count", s.count, s.tags))
+				slist.PushFront(types.NewSample("", s.name+"_sum", s.sum, s.tags))
+				slist.PushFront(types.NewSample("", s.name+"_min", s.min, s.tags))
+				slist.PushFront(types.NewSample("", s.name+"_max", s.max, s.tags))
+				slist.PushFront(types.NewSample("", s.name+"_mean", s.sum/s.count, s.tags))
+				sort.Float64s(s.values)
+				for _, p := range a.percentiles {
+					name := s.name + "_p" + strings.ReplaceAll(strconv.FormatFloat(p, 'f', -1, 64), ".", "_")
+					slist.PushFront(types.NewSample("", name, metrics.Percentile(s.values, p), s.tags))
+				}
+			}
+			delete(a.series, key)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// metric types of statsd and dogstatsd
+const (
+	typeCounter      = "c"
+	typeGauge        = "g"
+	typeSet          = "s"
+	typeTimer        = "ms"
+	typeHistogram    = "h"
+	typeDistribution = "d"
+)
+
+var errSkipped = errors.New("skipped")
+
+// metric is one parsed statsd line, a line may carry several values
+// with the dogstatsd v1.1 protocol: <name>:<v1>:<v2>|<type>
+type metric struct {
+	name   string
+	typ    string
+	values []string
+	rate   float64
+	tags   map[string]string
+}
+
+// parseLine parses <name>:<value>|<type>[|@<rate>][|#<tag>:<value>,...]
+// dogstatsd events and service checks are skipped
+func parseLine(line string, datadog bool) (*metric, error) {
+	if strings.HasPrefix(line, "_e{") || strings.HasPrefix(line, "_sc|") {
+		return nil, errSkipped
+	}
+
+	colon := strings.IndexByte(line, ':')
+	if colon <= 0 {
+		return nil, fmt.Errorf("no value in line: %s", line)
+	}
+
+	m := &metric{
+		name: line[:colon],
+		rate: 1,
+	}
+
+	parts := strings.Split(line[colon+1:], "|")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("no type in line: %s", line)
+	}
+
+	m.values = strings.Split(parts[0], ":")
+	m.typ = parts[1]
+	switch m.typ {
+	case typeCounter, typeGauge, typeSet, typeTimer, typeHistogram, typeDistribution:
+	default:
+		return nil, fmt.Errorf("unsupported type %q in line: %s", m.typ, line)
+	}
+
+	for _, part := range parts[2:] {
+		switch {
+		case strings.HasPrefix(part, "@"):
+			rate, err := strconv.ParseFloat(part[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return nil, fmt.Errorf("invalid sample rate in line: %s", line)
+			}
+			m.rate = rate
+		case strings.HasPrefix(part, "#"):
+			if datadog {
+				m.tags = parseTags(part[1:])
+			}
+		}
+		// unknown extensions such as container id(|c:) and timestamp(|T) are ignored
+	}
+
+	for _, v := range m.values {
+		if m.typ == typeSet {
+			continue
+		}
+		if _, err := strconv.ParseFloat(v, 64); err != nil {
+			return nil, fmt.Errorf("invalid value %q in line: %s", v, line)
+		}
+	}
+
+	return m, nil
+}
+
+// parseTags parses dogstatsd tags, a tag without value is kept as <tag>="true"
+func parseTags(s string) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(s, ",") {
+		if tag == "" {
+			continue
+		}
+		k, v, found := strings.Cut(tag, ":")
+		if !found {
+			v = "true"
+		}
+		if k == "" || v == "" {
+			continue
+		}
+		tags[k] = v
+	}
+	return tags
+}
@@ -0,0 +1,221 @@
+package statsd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/inputs"
+	"flashcat.cloud/categraf/pkg/listener"
+	"flashcat.cloud/categraf/types"
+)
+
+const inputName = "statsd"
+
+type Statsd struct {
+	config.PluginConfig
+	Instances []*Instance `toml:"instances"`
+}
+
+var _ inputs.ServiceInput = new(Statsd)
+var _ inputs.InstancesGetter = new(Statsd)
+var _ inputs.SampleGatherer = new(Instance)
+
+func init() {
+	inputs.Add(inputName, func() inputs.Input {
+		return &Statsd{}
+	})
+}
+
+func (s *Statsd) Clone() inputs.Input {
+	return &Statsd{}
+}
+
+func (s *Statsd) Name() string {
+	return inputName
+}
+
+func (s *Statsd) GetInstances() []inputs.Instance {
+	ret := make([]inputs.Instance, len(s.Instances))
+	for i := 0; i < len(s.Instances); i++ {
+		ret[i] = s.Instances[i]
+	}
+	return ret
+}
+
+func (s *Statsd) Start(_ *types.SampleList) error {
+	for _, ins := range s.Instances {
+		if !ins.Initialized() {
+			continue
+		}
+		if err := ins.start(); err != nil {
+			log.Println("E! failed to listen on", ins.ServiceAddress, "error:", err)
+		}
+	}
+	return nil
+}
+
+func (s *Statsd) Drop() {
+	for _, ins := range s.Instances {
+		ins.Drop()
+	}
+}
+
+type Instance struct {
+	config.InstanceConfig
+
+	// udp://:8125, tcp://:8125, unix:///path/to/sock or unixgram:///path/to/sock
+	ServiceAddress string `toml:"service_address"`
+	// parse dogstatsd tags
+	DatadogExtensions bool `toml:"datadog_extensions"`
+	// percentiles of timers, histograms and distributions
+	Percentiles []float64 `toml:"percentiles"`
+	// max values kept for percentiles per series in a flush interval
+	PercentileLimit int `toml:"percentile_limit"`
+	// gauges are kept across flushes by default as statsd does
+	DeleteGauges bool `toml:"delete_gauges"`
+	// packets or lines waiting to be parsed, more are dropped
+	AllowedPendingMessages int `toml:"allowed_pending_messages"`
+	MaxTCPConnections      int `toml:"max_tcp_connections"`
+	// socket read buffer size of udp and unixgram
+	ReadBufferSize int `toml:"read_buffer_size"`
+
+	network string
+	address string
+
+	acc     *accumulator
+	in      chan []byte
+	done    chan struct{}
+	wg      sync.WaitGroup
+	dropped uint64
+
+	server    *listener.Server
+	startOnce sync.Once
+	dropOnce  sync.Once
+}
+
+func (ins *Instance) Init() error {
+	if len(ins.ServiceAddress) == 0 {
+		return types.ErrInstancesEmpty
+	}
+
+	network, address := listener.SplitAddress(ins.ServiceAddress, "udp")
+	switch network {
+	case "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6", "unix", "unixgram":
+	default:
+		return fmt.Errorf("unsupported network %q of service_address", network)
+	}
+	ins.network = network
+	ins.address = address
+
+	if len(ins.Percentiles) == 0 {
+		ins.Percentiles = []float64{50, 90, 99}
+	}
+	for _, p := range ins.Percentiles {
+		if p <= 0 || p > 100 {
+			return fmt.Errorf("invalid percentile %v, should be in (0, 100]", p)
+		}
+	}
+	if ins.PercentileLimit <= 0 {
+		ins.PercentileLimit = 1000
+	}
+	if ins.AllowedPendingMessages <= 0 {
+		ins.AllowedPendingMessages = 10000
+	}
+	if ins.MaxTCPConnections <= 0 {
+		ins.MaxTCPConnections = 250
+	}
+
+	ins.acc = newAccumulator(ins.Percentiles, ins.PercentileLimit, ins.DeleteGauges)
+	ins.in = make(chan []byte, ins.AllowedPendingMessages)
+	ins.done = make(chan struct{})
+	return nil
+}
+
+func (ins *Instance) start() error {
+	var err error
+	ins.startOnce.Do(func() {
+		ins.server = &listener.Server{
+			Name:              inputName,
+			MaxTCPConnections: ins.MaxTCPConnections,
+			ReadBufferSize:    ins.ReadBufferSize,
+		}
+		err = ins.server.Listen(ins.network, ins.address, func(data []byte) {
+			ins.enqueue(bytes.Clone(data))
+		}, ins.handleConn)
+		if err != nil {
+			return
+		}
+		ins.wg.Add(1)
+		go ins.parse()
+		log.Println("I! statsd listening on", ins.ServiceAddress)
+	})
+	return err
+}
+
+func (ins *Instance) handleConn(conn net.Conn) {
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		ins.enqueue(bytes.Clone(scanner.Bytes()))
+	}
+}
+
+func (ins *Instance) enqueue(data []byte) {
+	select {
+	case ins.in <- data:
+	default:
+		atomic.AddUint64(&ins.dropped, 1)
+	}
+}
+
+func (ins *Instance) parse() {
+	defer ins.wg.Done()
+	for {
+		select {
+		case <-ins.done:
+			return
+		case data := <-ins.in:
+			for _, line := range strings.Split(string(data), "\n") {
+				line = strings.TrimSpace(line)
+				if line == "" {
+					continue
+				}
+				m, err := parseLine(line, ins.DatadogExtensions)
+				if err != nil {
+					if err != errSkipped && ins.DebugMod {
+						log.Println("D! statsd:", err)
+					}
+					continue
+				}
+				ins.acc.add(m)
+			}
+		}
+	}
+}
+
+func (ins *Instance) Gather(slist *types.SampleList) {
+	if n := atomic.SwapUint64(&ins.dropped, 0); n > 0 {
+		log.Println("W! statsd dropped", n, "messages of", ins.ServiceAddress, "consider increasing allowed_pending_messages")
+	}
+	ins.acc.flush(slist)
+}
+
+func (ins *Instance) Drop() {
+	if ins.done == nil {
+		return
+	}
+	ins.dropOnce.Do(func() {
+		close(ins.done)
+		if ins.server != nil {
+			ins.server.Close()
+		}
+		ins.wg.Wait()
+	})
+}
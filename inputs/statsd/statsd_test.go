@@ -0,0 +1,86 @@
+package statsd
+
+import (
+	"testing"
+
+	"flashcat.cloud/categraf/types"
+)
+
+func TestParseLine(t *testing.T) {
+	m, err := parseLine("page.views:1|c|@0.5|#env:prod,canary", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.name != "page.views" || m.typ != typeCounter || m.rate != 0.5 {
+		t.Fatalf("unexpected metric: %+v", m)
+	}
+	if m.tags["env"] != "prod" || m.tags["canary"] != "true" {
+		t.Fatalf("unexpected tags: %v", m.tags)
+	}
+
+	if _, err = parseLine("_e{5,4}:title|text", true); err != errSkipped {
+		t.Fatalf("expected event skipped, got %v", err)
+	}
+	for _, line := range []string{"novalue", "name:1", "name:1|x", "name:abc|c", "name:1|c|@2"} {
+		if _, err = parseLine(line, true); err == nil {
+			t.Fatalf("expected error of line %q", line)
+		}
+	}
+}
+
+func TestAccumulatorFlush(t *testing.T) {
+	acc := newAccumulator([]float64{50, 90}, 1000, false)
+	for _, line := range []string{
+		"hits:2|c|@0.5",
+		"hits:1|c",
+		"temp:10|g",
+		"temp:-3|g",
+		"users:a|s",
+		"users:b|s",
+		"users:a|s",
+		"latency:1:2:3:4:5:6:7:8:9:10|ms",
+	} {
+		m, err := parseLine(line, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		acc.add(m)
+	}
+
+	slist := types.NewSampleList()
+	acc.flush(slist)
+	got := make(map[string]float64)
+	for _, s := range slist.PopBackAll() {
+		switch v := s.Value.(type) {
+		case float64:
+			got[s.Metric] = v
+		case int:
+			got[s.Metric] = float64(v)
+		}
+	}
+
+	expected := map[string]float64{
+		"hits":          5,
+		"temp":          7,
+		"users":         2,
+		"latency_count": 10,
+		"latency_sum":   55,
+		"latency_min":   1,
+		"latency_max":   10,
+		"latency_mean":  5.5,
+		"latency_p50":   5,
+		"latency_p90":   9,
+	}
+	for k, v := range expected {
+		if got[k] != v {
+			t.Fatalf("expected %s=%v, got %v", k, v, got[k])
+		}
+	}
+
+	// only gauges are kept after flush
+	acc.flush(slist)
+	ss := slist.PopBackAll()
+	if len(ss) != 1 || ss[0].Metric != "temp" {
+		t.Fatalf("expected only gauge kept, got %d samples", len(ss))
+	}
+}
@@ -0,0 +1,39 @@
+package inputs
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/cfg"
+)
+
+// checkUnknownKeys reports the keys of configs matching no option of the input,
+// the load fails with global.strict_config, otherwise the keys are logged
+func checkUnknownKeys(configs []cfg.ConfigWithFormat, input Input) error {
+	t := reflect.TypeOf(input)
+	if t.Kind() != reflect.Ptr {
+		return nil
+	}
+
+	var unknown []string
+	for _, c := range configs {
+		keys, err := cfg.UnknownKeys(c, reflect.New(t.Elem()).Interface())
+		if err != nil {
+			// reported by the loader
+			continue
+		}
+		unknown = append(unknown, keys...)
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	if config.Config != nil && config.Config.Global.StrictConfig {
+		return fmt.Errorf("unknown keys of input %s: %s", input.Name(), strings.Join(unknown, ", "))
+	}
+	log.Println("W! unknown keys of input", input.Name(), "are ignored:", strings.Join(unknown, ", "))
+	return nil
+}
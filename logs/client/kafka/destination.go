@@ -101,18 +101,7 @@ func newDestination(endpoint logsconfig.Endpoint, contentType string, destinatio
 		}
 	}
 	if coreconfig.Config.Logs.UseCompression {
-		switch coreconfig.Config.Logs.CompressionCodec {
-		case "gzip":
-			coreconfig.Config.Logs.Config.Producer.Compression = sarama.CompressionGZIP
-		case "snappy":
-			coreconfig.Config.Logs.Config.Producer.Compression = sarama.CompressionSnappy
-		case "lz4":
-			coreconfig.Config.Logs.Config.Producer.Compression = sarama.CompressionLZ4
-		case "zstd":
-			coreconfig.Config.Logs.Config.Producer.Compression = sarama.CompressionZSTD
-		default:
-			coreconfig.Config.Logs.Config.Producer.Compression = sarama.CompressionNone
-		}
+		coreconfig.Config.Logs.KafkaConfig.SetupCompression(coreconfig.Config.Logs.Config)
 		coreconfig.Config.Logs.Producer.CompressionLevel = coreconfig.Config.Logs.CompressionLevel
 	}
 
@@ -133,33 +122,8 @@ func newDestination(endpoint logsconfig.Endpoint, contentType string, destinatio
 			return nil, fmt.Errorf("kafka TLS config: %w", err)
 		}
 	}
-	if coreconfig.Config.Logs.SaslEnable {
-		coreconfig.Config.Logs.Config.Net.SASL.Enable = true
-		coreconfig.Config.Logs.Config.Net.SASL.User = coreconfig.Config.Logs.SaslUser
-		coreconfig.Config.Logs.Config.Net.SASL.Password = coreconfig.Config.Logs.SaslPassword
-		coreconfig.Config.Logs.Config.Net.SASL.Mechanism = sarama.SASLMechanism(coreconfig.Config.Logs.SaslMechanism)
-		coreconfig.Config.Logs.Config.Net.SASL.Version = coreconfig.Config.Logs.SaslVersion
-		coreconfig.Config.Logs.Config.Net.SASL.Handshake = coreconfig.Config.Logs.SaslHandshake
-		coreconfig.Config.Logs.Config.Net.SASL.AuthIdentity = coreconfig.Config.Logs.SaslAuthIdentity
+	coreconfig.Config.Logs.KafkaConfig.SetupSarama(coreconfig.Config.Logs.Config)
 
-		if coreconfig.Config.Logs.Config.Net.SASL.Mechanism == sarama.SASLTypeSCRAMSHA256 {
-			coreconfig.Config.Logs.Config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
-				return &XDGSCRAMClient{HashGeneratorFcn: SHA256}
-			}
-		}
-		if coreconfig.Config.Logs.Config.Net.SASL.Mechanism == sarama.SASLTypeSCRAMSHA512 {
-			coreconfig.Config.Logs.Config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &XDGSCRAMClient{HashGeneratorFcn: SHA512} }
-		}
-	}
-
-	if len(coreconfig.Config.Logs.KafkaVersion) != 0 {
-		for _, v := range sarama.SupportedVersions {
-			if v.String() == coreconfig.Config.Logs.KafkaVersion {
-				coreconfig.Config.Logs.Config.Version = v
-				break
-			}
-		}
-	}
 	if util.Debug() {
 		log.Printf("D! saram config: %+v", coreconfig.Config.Logs.Config)
 	}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	_ "net/http/pprof"
 	"os"
@@ -23,6 +25,7 @@ import (
 	"flashcat.cloud/categraf/api"
 	"flashcat.cloud/categraf/config"
 	"flashcat.cloud/categraf/heartbeat"
+	"flashcat.cloud/categraf/inputs"
 	"flashcat.cloud/categraf/pkg/osx"
 	"flashcat.cloud/categraf/writer"
 )
@@ -44,6 +47,10 @@ var (
 	update       = flag.Bool("update", false, "Update categraf binary")
 	updateFile   = flag.String("update_url", "", "new version for categraf to download")
 	userMode     = flag.Bool("user", false, "Install categraf service with user mode")
+	checkConfig  = flag.Bool("check-config", false, "Check config.toml and input configs without running, exit 1 on errors")
+	checkFormat  = flag.String("check-config-format", "text", "Output format of --check-config: text or json")
+	exportSchema = flag.Bool("export-schema", false, "Print the json schema of the options of every input")
+	encryptStore = flag.String("encrypt-secrets", "", "Encrypt a json object of secrets from stdin to the encrypted_file secretstore of the id")
 )
 
 func init() {
@@ -92,11 +99,40 @@ func main() {
 		return
 	}
 
+	if *exportSchema {
+		bs, err := json.MarshalIndent(inputs.Schema(), "", "  ")
+		if err != nil {
+			log.Fatalln("F! failed to marshal schema:", err)
+		}
+		fmt.Println(string(bs))
+		return
+	}
+
+	if *checkConfig {
+		printResults := agent.PrintCheckResults
+		switch *checkFormat {
+		case "text":
+		case "json":
+			printResults = agent.PrintCheckResultsJSON
+		default:
+			log.Fatalln("F! unknown check-config-format:", *checkFormat)
+		}
+		if printResults(os.Stdout, agent.CheckConfig(*configDir)) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
 	// init configs
 	if err := config.InitConfig(*configDir, *debugLevel, *debugMode, *testMode, *interval, *inputFilters); err != nil {
 		log.Fatalln("F! failed to init config:", err)
 	}
 
+	if *encryptStore != "" {
+		encryptSecrets()
+		return
+	}
+
 	doOSsvc()
 	printEnv()
 
@@ -111,9 +147,21 @@ func main() {
 		fmt.Println("F! failed to init agent:", err)
 		os.Exit(-1)
 	}
+	api.SetAgent(ag)
 	runAgent(ag)
 }
 
+func encryptSecrets() {
+	plain, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		log.Fatalln("F! failed to read secrets from stdin:", err)
+	}
+	if err := config.EncryptSecrets(*encryptStore, plain); err != nil {
+		log.Fatalln("F! failed to encrypt secrets:", err)
+	}
+	fmt.Println("secrets encrypted")
+}
+
 func initWriters() {
 	if err := writer.InitWriters(); err != nil {
 		log.Fatalln("F! failed to init writer:", err)
@@ -143,6 +191,7 @@ EXIT:
 	}
 
 	ag.Stop()
+	writer.CloseWriters()
 	log.Println("I! exited")
 }
 
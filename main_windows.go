@@ -17,6 +17,7 @@ import (
 	"flashcat.cloud/categraf/agent"
 	"flashcat.cloud/categraf/config"
 	"flashcat.cloud/categraf/pkg/pprof"
+	"flashcat.cloud/categraf/writer"
 )
 
 var (
@@ -38,7 +39,11 @@ func runAgent(ag *agent.Agent) {
 			initLog(config.Config.Log.FileName)
 		}
 
-		if err := winsvc.RunAsService(*flagWinSvcName, ag.Start, ag.Stop, false); err != nil {
+		stop := func() {
+			ag.Stop()
+			writer.CloseWriters()
+		}
+		if err := winsvc.RunAsService(*flagWinSvcName, ag.Start, stop, false); err != nil {
 			log.Fatalln("F! failed to run windows service:", err)
 		}
 		return
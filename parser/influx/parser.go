@@ -1,7 +1,10 @@
 package influx
 
 import (
+	"fmt"
 	"log"
+	"math"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,7 +17,10 @@ import (
 // parsers.Parser interface.
 type Parser struct {
 	defaultTime TimeFunc
-	precision   lineprotocol.Precision
+	// unit of timestamps of lines
+	unit time.Duration
+	// keep timestamps of lines, otherwise samples are stamped when processed
+	keepTime bool
 }
 
 type TimeFunc func() time.Time
@@ -23,18 +29,63 @@ type TimeFunc func() time.Time
 func NewParser() *Parser {
 	return &Parser{
 		defaultTime: time.Now,
-		precision:   lineprotocol.Nanosecond,
+		unit:        time.Nanosecond,
 	}
 }
 
+// NewTimedParser returns a Parser that keeps timestamps of lines in the given unit
+func NewTimedParser(unit time.Duration) *Parser {
+	return &Parser{
+		defaultTime: time.Now,
+		unit:        unit,
+		keepTime:    true,
+	}
+}
+
+// ParsePrecision converts the precision parameter of influxdb write api,
+// m and h are only supported by v1
+func ParsePrecision(precision string) (time.Duration, error) {
+	switch precision {
+	case "", "n", "ns":
+		return time.Nanosecond, nil
+	case "u", "us":
+		return time.Microsecond, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "s":
+		return time.Second, nil
+	case "m":
+		return time.Minute, nil
+	case "h":
+		return time.Hour, nil
+	}
+	return time.Nanosecond, fmt.Errorf("unsupported precision: %s", precision)
+}
+
 func (p *Parser) Parse(input []byte, slist *types.SampleList) error {
-	metrics := make([]types.Metric, 0)
-	decoder := lineprotocol.NewDecoderWithBytes(input)
+	if bad, err := p.ParseLines(input, slist); bad > 0 {
+		log.Printf("E! failed to parse %d influx lines, first error: %v", bad, err)
+	}
+	return nil
+}
+
+// ParseLines pushes samples of valid lines to slist, it returns the number
+// of invalid lines and the error of the first one
+func (p *Parser) ParseLines(input []byte, slist *types.SampleList) (int, error) {
+	var (
+		metrics  = make([]types.Metric, 0)
+		decoder  = lineprotocol.NewDecoderWithBytes(input)
+		bad      int
+		firstErr error
+	)
 
 	for decoder.Next() {
-		m, err := nextMetric(decoder, p.precision, p.defaultTime)
+		m, err := nextMetric(decoder, p.unit, p.defaultTime)
 		if err != nil {
-			log.Println("E! failed to parse influx line:", string(input), err)
+			if bad == 0 {
+				firstErr = err
+			}
+			bad++
 			continue
 		}
 		metrics = append(metrics, m)
@@ -45,14 +96,18 @@ func (p *Parser) Parse(input []byte, slist *types.SampleList) error {
 		tags := m.Tags()
 		fields := m.Fields()
 		for k, v := range fields {
+			if p.keepTime {
+				slist.PushFront(types.NewSample(name, k, v, tags).SetTime(m.Time()))
+				continue
+			}
 			slist.PushSample(name, k, v, tags)
 		}
 	}
 
-	return nil
+	return bad, firstErr
 }
 
-func nextMetric(decoder *lineprotocol.Decoder, precision lineprotocol.Precision, defaultTime TimeFunc) (types.Metric, error) {
+func nextMetric(decoder *lineprotocol.Decoder, unit time.Duration, defaultTime TimeFunc) (types.Metric, error) {
 	measurement, err := decoder.Measurement()
 	if err != nil {
 		return nil, err
@@ -91,11 +146,23 @@ func nextMetric(decoder *lineprotocol.Decoder, precision lineprotocol.Precision,
 		m.AddField(string(key), value.Interface())
 	}
 
-	t, err := decoder.Time(precision, defaultTime())
+	// lineprotocol has no minute and hour precision, so the raw timestamp is scaled here
+	raw, err := decoder.TimeBytes()
 	if err != nil {
 		return nil, err
 	}
-	m.SetTime(t)
+	if len(raw) == 0 {
+		m.SetTime(defaultTime().Truncate(unit))
+		return m, nil
+	}
+	ts, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp %q: %v", raw, err)
+	}
+	if limit := math.MaxInt64 / int64(unit); ts > limit || ts < -limit {
+		return nil, fmt.Errorf("timestamp %q out of range", raw)
+	}
+	m.SetTime(time.Unix(0, ts*int64(unit)))
 
 	return m, nil
 }
@@ -0,0 +1,171 @@
+package cardinality
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Limiter admits at most limit distinct series, series not seen
+// for expire are forgotten so that their slots can be reused
+type Limiter struct {
+	limit  int
+	expire time.Duration
+
+	lock       sync.Mutex
+	series     map[uint64]time.Time
+	lastExpire time.Time
+}
+
+func NewLimiter(limit int, expire time.Duration) *Limiter {
+	return &Limiter{
+		limit:  limit,
+		expire: expire,
+		series: make(map[uint64]time.Time),
+	}
+}
+
+// Admit reports whether the series is known or there is room for a new one,
+// the series takes a slot if admitted
+func (l *Limiter) Admit(hash uint64, now time.Time) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if !l.allow(hash, now) {
+		return false
+	}
+	l.series[hash] = now
+	return true
+}
+
+// Allow reports whether Admit would admit the series without taking a slot
+func (l *Limiter) Allow(hash uint64, now time.Time) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.allow(hash, now)
+}
+
+func (l *Limiter) allow(hash uint64, now time.Time) bool {
+	if now.Sub(l.lastExpire) > l.expire/2 {
+		for h, seen := range l.series {
+			if now.Sub(seen) > l.expire {
+				delete(l.series, h)
+			}
+		}
+		l.lastExpire = now
+	}
+
+	_, has := l.series[hash]
+	return has || len(l.series) < l.limit
+}
+
+func (l *Limiter) Len() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return len(l.series)
+}
+
+var (
+	global     *Limiter
+	globalLock sync.RWMutex
+)
+
+// SetGlobal sets the limit of series across all inputs, 0 means no limit
+func SetGlobal(limit int, expire time.Duration) {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+	if limit <= 0 {
+		global = nil
+		return
+	}
+	global = NewLimiter(limit, expire)
+}
+
+func Global() *Limiter {
+	globalLock.RLock()
+	defer globalLock.RUnlock()
+	return global
+}
+
+// scopes of limit
+const (
+	ScopeInstance = "instance"
+	ScopeGlobal   = "global"
+)
+
+// distinct metrics tracked of an input and scope, drops of the other
+// metrics are only counted in the total
+const maxDroppedMetrics = 100
+
+type dropKey struct {
+	input string
+	scope string
+}
+
+type dropCounts struct {
+	total   uint64
+	metrics map[string]uint64
+}
+
+// DropStat is the dropped series count of an input
+type DropStat struct {
+	Input   string
+	Scope   string
+	Dropped uint64
+	// metrics with the most dropped series
+	Top []MetricCount
+}
+
+type MetricCount struct {
+	Metric string
+	Count  uint64
+}
+
+var (
+	dropped     = make(map[dropKey]*dropCounts)
+	droppedLock sync.Mutex
+)
+
+// RecordDropped counts dropped series of a metric, at most maxDroppedMetrics
+// metrics are tracked per input and scope so high cardinality names are bounded
+func RecordDropped(input, scope, metric string, n uint64) {
+	droppedLock.Lock()
+	defer droppedLock.Unlock()
+	key := dropKey{input: input, scope: scope}
+	dc, has := dropped[key]
+	if !has {
+		dc = &dropCounts{metrics: make(map[string]uint64)}
+		dropped[key] = dc
+	}
+	dc.total += n
+	if _, has := dc.metrics[metric]; has || len(dc.metrics) < maxDroppedMetrics {
+		dc.metrics[metric] += n
+	}
+}
+
+// Dropped returns the dropped counts of every input with the top n metrics
+func Dropped(n int) []DropStat {
+	droppedLock.Lock()
+	defer droppedLock.Unlock()
+
+	ret := make([]DropStat, 0, len(dropped))
+	for key, dc := range dropped {
+		stat := DropStat{Input: key.input, Scope: key.scope, Dropped: dc.total}
+		top := make([]MetricCount, 0, len(dc.metrics))
+		for metric, count := range dc.metrics {
+			top = append(top, MetricCount{Metric: metric, Count: count})
+		}
+		sort.Slice(top, func(i, j int) bool {
+			if top[i].Count == top[j].Count {
+				return top[i].Metric < top[j].Metric
+			}
+			return top[i].Count > top[j].Count
+		})
+		if len(top) > n {
+			top = top[:n]
+		}
+		stat.Top = top
+		ret = append(ret, stat)
+	}
+	return ret
+}
@@ -0,0 +1,73 @@
+package cardinality
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(2, time.Minute)
+	now := time.Now()
+	if !l.Admit(1, now) || !l.Admit(2, now) {
+		t.Fatal("expected series within limit admitted")
+	}
+	if l.Admit(3, now) {
+		t.Fatal("expected new series beyond limit dropped")
+	}
+	if !l.Admit(1, now.Add(40*time.Second)) {
+		t.Fatal("expected existing series admitted")
+	}
+	// series 2 expires and its slot is reused
+	if !l.Admit(3, now.Add(90*time.Second)) {
+		t.Fatal("expected slot of expired series reused")
+	}
+	if l.Len() != 2 {
+		t.Fatalf("expected 2 series, got %d", l.Len())
+	}
+}
+
+func TestLimiterAllow(t *testing.T) {
+	l := NewLimiter(1, time.Minute)
+	now := time.Now()
+	if !l.Allow(1, now) || !l.Allow(2, now) || l.Len() != 0 {
+		t.Fatal("expected Allow not to take slots")
+	}
+	l.Admit(1, now)
+	if l.Allow(2, now) || !l.Allow(1, now) {
+		t.Fatal("expected only the known series allowed")
+	}
+}
+
+func TestDroppedBounded(t *testing.T) {
+	dropped = make(map[dropKey]*dropCounts)
+	for i := 0; i < maxDroppedMetrics*2; i++ {
+		RecordDropped("bounded", ScopeGlobal, fmt.Sprintf("metric_%d", i), 1)
+	}
+	for _, stat := range Dropped(maxDroppedMetrics * 2) {
+		if stat.Input != "bounded" {
+			continue
+		}
+		if stat.Dropped != maxDroppedMetrics*2 || len(stat.Top) != maxDroppedMetrics {
+			t.Fatalf("expected %d dropped of %d metrics, got %d of %d",
+				maxDroppedMetrics*2, maxDroppedMetrics, stat.Dropped, len(stat.Top))
+		}
+		return
+	}
+	t.Fatal("expected drop stats of input bounded")
+}
+
+func TestDropped(t *testing.T) {
+	dropped = make(map[dropKey]*dropCounts)
+	RecordDropped("prometheus", ScopeInstance, "a", 3)
+	RecordDropped("prometheus", ScopeInstance, "b", 5)
+	RecordDropped("prometheus", ScopeInstance, "c", 1)
+
+	stats := Dropped(2)
+	if len(stats) != 1 || stats[0].Dropped != 9 {
+		t.Fatalf("unexpected stats: %v", stats)
+	}
+	if len(stats[0].Top) != 2 || stats[0].Top[0].Metric != "b" || stats[0].Top[1].Metric != "a" {
+		t.Fatalf("unexpected top metrics: %v", stats[0].Top)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"path"
 	"strings"
 
+	"github.com/BurntSushi/toml"
 	"github.com/koding/multiconfig"
 	"github.com/toolkits/pkg/file"
 )
@@ -143,3 +144,33 @@ func LoadSingleConfig(c ConfigWithFormat, configPtr interface{}) error {
 	}
 	return m.Load(configPtr)
 }
+
+// UnknownKeys returns the keys of a toml config which match no field of
+// configPtr, keys under an unknown table are reported as the table only
+func UnknownKeys(c ConfigWithFormat, configPtr interface{}) ([]string, error) {
+	if c.Format != TomlFormat {
+		return nil, nil
+	}
+	md, err := toml.Decode(c.Config, configPtr)
+	if err != nil {
+		return nil, err
+	}
+	undecoded := make(map[string]struct{})
+	for _, key := range md.Undecoded() {
+		undecoded[key.String()] = struct{}{}
+	}
+	var ret []string
+	for _, key := range md.Undecoded() {
+		parent := false
+		for i := len(key) - 1; i > 0; i-- {
+			if _, has := undecoded[key[:i].String()]; has {
+				parent = true
+				break
+			}
+		}
+		if !parent {
+			ret = append(ret, key.String())
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,36 @@
+package cfg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnknownKeys(t *testing.T) {
+	type instance struct {
+		Address string `toml:"address"`
+	}
+	var c struct {
+		Interval  int        `toml:"interval"`
+		Instances []instance `toml:"instances"`
+	}
+	conf := ConfigWithFormat{Format: TomlFormat, Config: `
+interval = 15
+mesurement = "x"
+
+[[instances]]
+address = "127.0.0.1"
+adress = "127.0.0.1"
+
+[unknown]
+a = 1
+b = 2
+`}
+	keys, err := UnknownKeys(conf, &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"mesurement", "instances.adress", "unknown"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("expected %v, got %v", expected, keys)
+	}
+}
@@ -0,0 +1,168 @@
+package cfg
+
+import (
+	"encoding"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	durationType        = reflect.TypeOf(time.Duration(0))
+)
+
+// Schema returns the json schema of the toml options of a config struct,
+// non-zero fields of v and `default` tags are the defaults
+func Schema(v interface{}) map[string]interface{} {
+	val := reflect.ValueOf(v)
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return typeSchema(val.Type().Elem(), reflect.Value{}, nil)
+		}
+		val = val.Elem()
+	}
+	return typeSchema(val.Type(), val, nil)
+}
+
+func typeSchema(t reflect.Type, v reflect.Value, seen []reflect.Type) map[string]interface{} {
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) || t.Implements(textUnmarshalerType) {
+		s := map[string]interface{}{"type": "string"}
+		if t.Kind() == reflect.Int64 {
+			// durations of config are "10s" or seconds
+			s["type"] = []string{"string", "integer"}
+			s["format"] = "duration"
+		}
+		return s
+	}
+	if t == durationType {
+		return map[string]interface{}{"type": "integer", "format": "nanoseconds"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		var ev reflect.Value
+		if v.IsValid() && !v.IsNil() {
+			ev = v.Elem()
+		}
+		return typeSchema(t.Elem(), ev, seen)
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), reflect.Value{}, seen)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), reflect.Value{}, seen)}
+	case reflect.Struct:
+		for _, st := range seen {
+			if st == t {
+				// recursive type
+				return map[string]interface{}{"type": "object"}
+			}
+		}
+		props := make(map[string]interface{})
+		structProperties(t, v, append(seen, t), props)
+		return map[string]interface{}{"type": "object", "properties": props, "additionalProperties": false}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// structProperties adds the options of the struct to props, options of
+// embedded structs are at the same level as decoded by toml
+func structProperties(t reflect.Type, v reflect.Value, seen []reflect.Type, props map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() && !f.Anonymous {
+			continue
+		}
+		tag := f.Tag.Get("toml")
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+
+		var fv reflect.Value
+		if v.IsValid() {
+			fv = v.Field(i)
+		}
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+			if fv.IsValid() {
+				if fv.IsNil() {
+					fv = reflect.Value{}
+				} else {
+					fv = fv.Elem()
+				}
+			}
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct && !reflect.PointerTo(ft).Implements(textUnmarshalerType) {
+			structProperties(ft, fv, seen, props)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		switch ft.Kind() {
+		case reflect.Interface, reflect.Func, reflect.Chan:
+			// runtime states, e.g. compiled filters
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		s := typeSchema(f.Type, fv, seen)
+		if def, ok := defaultValue(f, fv); ok {
+			s["default"] = def
+		}
+		props[name] = s
+	}
+}
+
+func defaultValue(f reflect.StructField, v reflect.Value) (interface{}, bool) {
+	if tag, ok := f.Tag.Lookup("default"); ok {
+		switch f.Type.Kind() {
+		case reflect.Bool:
+			if b, err := strconv.ParseBool(tag); err == nil {
+				return b, true
+			}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if n, err := strconv.ParseInt(tag, 10, 64); err == nil {
+				return n, true
+			}
+		case reflect.Float32, reflect.Float64:
+			if n, err := strconv.ParseFloat(tag, 64); err == nil {
+				return n, true
+			}
+		}
+		return tag, true
+	}
+	if !v.IsValid() || !v.CanInterface() || v.IsZero() {
+		return nil, false
+	}
+	switch v.Kind() {
+	case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Kind() == reflect.Int64 && reflect.PointerTo(v.Type()).Implements(textUnmarshalerType) {
+			// e.g. config.Duration
+			return time.Duration(v.Int()).String(), true
+		}
+		return v.Interface(), true
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.String {
+			return v.Interface(), true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,43 @@
+package cfg
+
+import (
+	"testing"
+	"time"
+)
+
+type schemaDuration time.Duration
+
+func (d *schemaDuration) UnmarshalText(b []byte) error { return nil }
+
+type schemaBase struct {
+	Labels   map[string]string `toml:"labels"`
+	Interval schemaDuration    `toml:"interval"`
+}
+
+type schemaInput struct {
+	schemaBase
+	Timeout   int      `toml:"timeout" default:"5"`
+	Ignored   string   `toml:"-"`
+	Instances []struct {
+		Address string `toml:"address"`
+	} `toml:"instances"`
+}
+
+func TestSchema(t *testing.T) {
+	s := Schema(&schemaInput{schemaBase: schemaBase{Interval: schemaDuration(15 * time.Second)}})
+	props := s["properties"].(map[string]interface{})
+	if len(props) != 4 {
+		t.Fatalf("expected labels, interval, timeout and instances, got %v", props)
+	}
+	interval := props["interval"].(map[string]interface{})
+	if interval["format"] != "duration" || interval["default"] != "15s" {
+		t.Fatalf("unexpected interval schema: %v", interval)
+	}
+	if props["timeout"].(map[string]interface{})["default"] != int64(5) {
+		t.Fatalf("unexpected timeout schema: %v", props["timeout"])
+	}
+	items := props["instances"].(map[string]interface{})["items"].(map[string]interface{})
+	if _, has := items["properties"].(map[string]interface{})["address"]; !has {
+		t.Fatalf("unexpected instances schema: %v", items)
+	}
+}
@@ -0,0 +1,187 @@
+package health
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Stat is the gather health of an input or an instance
+type Stat struct {
+	input    string
+	instance string
+
+	lock        sync.Mutex
+	lastGather  time.Time
+	duration    time.Duration
+	samples     int
+	gathers     uint64
+	panics      uint64
+	skipped     uint64
+	timeouts    uint64
+	errors      uint64
+	lastSuccess time.Time
+	lastError   string
+}
+
+// Snapshot is a copy of Stat
+type Snapshot struct {
+	Input string `json:"-"`
+	// index of the instance, empty for the plugin level
+	Instance    string    `json:"-"`
+	LastGather  time.Time `json:"last_gather"`
+	Duration    float64   `json:"duration_seconds"`
+	Samples     int       `json:"samples"`
+	Gathers     uint64    `json:"gathers"`
+	Panics      uint64    `json:"panics"`
+	Skipped     uint64    `json:"skipped"`
+	Timeouts    uint64    `json:"timeouts"`
+	Errors      uint64    `json:"errors"`
+	LastSuccess time.Time `json:"last_success"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+var (
+	stats = make(map[*Stat]struct{})
+	lock  sync.RWMutex
+)
+
+// Register adds the stat of an input or an instance to All
+func Register(input, instance string) *Stat {
+	s := &Stat{input: input, instance: instance}
+	lock.Lock()
+	stats[s] = struct{}{}
+	lock.Unlock()
+	return s
+}
+
+func Unregister(s *Stat) {
+	lock.Lock()
+	delete(stats, s)
+	lock.Unlock()
+}
+
+// Gathered records a successful gather
+func (s *Stat) Gathered(start time.Time, samples int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.lastGather = start
+	s.duration = time.Since(start)
+	s.samples = samples
+	s.gathers++
+	s.lastSuccess = start
+	s.lastError = ""
+}
+
+// Failed records a gather which returned an error
+func (s *Stat) Failed(start time.Time, samples int, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.lastGather = start
+	s.duration = time.Since(start)
+	s.samples = samples
+	s.gathers++
+	s.errors++
+	s.lastError = err.Error()
+}
+
+// Panicked records a gather ended with panic
+func (s *Stat) Panicked(start time.Time, rc interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.lastGather = start
+	s.duration = time.Since(start)
+	s.samples = 0
+	s.gathers++
+	s.panics++
+	s.lastError = fmt.Sprint("panic: ", rc)
+}
+
+// TimedOut records a gather abandoned by gather_timeout
+func (s *Stat) TimedOut(start time.Time, timeout time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.lastGather = start
+	s.duration = time.Since(start)
+	s.samples = 0
+	s.gathers++
+	s.timeouts++
+	s.lastError = fmt.Sprint("timeout after ", timeout)
+}
+
+// Skip records runs skipped because the previous one overran the interval
+// or is still running after timeout
+func (s *Stat) Skip(n uint64) {
+	s.lock.Lock()
+	s.skipped += n
+	s.lock.Unlock()
+}
+
+func (s *Stat) Snapshot() Snapshot {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return Snapshot{
+		Input:       s.input,
+		Instance:    s.instance,
+		LastGather:  s.lastGather,
+		Duration:    s.duration.Seconds(),
+		Samples:     s.samples,
+		Gathers:     s.gathers,
+		Panics:      s.panics,
+		Skipped:     s.skipped,
+		Timeouts:    s.timeouts,
+		Errors:      s.errors,
+		LastSuccess: s.lastSuccess,
+		LastError:   s.lastError,
+	}
+}
+
+// All returns the snapshots of registered stats, stats of the same input and
+// instance, e.g. of several configs or a reloading input, are merged into one
+func All() []Snapshot {
+	type key struct{ input, instance string }
+	merged := make(map[key]*Snapshot)
+
+	lock.RLock()
+	for s := range stats {
+		ss := s.Snapshot()
+		m, has := merged[key{ss.Input, ss.Instance}]
+		if !has {
+			merged[key{ss.Input, ss.Instance}] = &ss
+			continue
+		}
+		m.merge(ss)
+	}
+	lock.RUnlock()
+
+	ret := make([]Snapshot, 0, len(merged))
+	for _, m := range merged {
+		ret = append(ret, *m)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Input != ret[j].Input {
+			return ret[i].Input < ret[j].Input
+		}
+		return ret[i].Instance < ret[j].Instance
+	})
+	return ret
+}
+
+// merge sums up the counters and keeps the latest gather of both
+func (m *Snapshot) merge(ss Snapshot) {
+	m.Samples += ss.Samples
+	m.Gathers += ss.Gathers
+	m.Panics += ss.Panics
+	m.Skipped += ss.Skipped
+	m.Timeouts += ss.Timeouts
+	m.Errors += ss.Errors
+	if ss.LastGather.After(m.LastGather) {
+		m.LastGather = ss.LastGather
+		m.Duration = ss.Duration
+		m.LastError = ss.LastError
+	}
+	if ss.LastSuccess.After(m.LastSuccess) {
+		m.LastSuccess = ss.LastSuccess
+	}
+}
@@ -0,0 +1,48 @@
+package health
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStat(t *testing.T) {
+	s := Register("local.cpu", "0")
+	defer Unregister(s)
+
+	start := time.Now()
+	s.Gathered(start, 10)
+	s.Panicked(start.Add(time.Second), "boom")
+	s.Skip(2)
+
+	ss := s.Snapshot()
+	if ss.Gathers != 2 || ss.Panics != 1 || ss.Skipped != 2 || ss.Samples != 0 {
+		t.Fatalf("unexpected snapshot: %+v", ss)
+	}
+	if !ss.LastSuccess.Equal(start) || ss.LastError != "panic: boom" {
+		t.Fatalf("unexpected last success or error: %+v", ss)
+	}
+
+	s.Gathered(start.Add(2*time.Second), 5)
+	if ss = s.Snapshot(); ss.LastError != "" || ss.Samples != 5 {
+		t.Fatalf("expected error cleared, got %+v", ss)
+	}
+
+	s.Failed(start.Add(3*time.Second), 1, errors.New("connection refused"))
+	if ss = s.Snapshot(); ss.Errors != 1 || ss.LastError != "connection refused" || !ss.LastSuccess.Equal(start.Add(2*time.Second)) {
+		t.Fatalf("unexpected failed gather: %+v", ss)
+	}
+
+	// a reloading input has the stats of both readers for a while
+	other := Register("local.cpu", "0")
+	defer Unregister(other)
+	other.Gathered(start.Add(4*time.Second), 3)
+
+	all := All()
+	if len(all) != 1 || all[0].Input != "local.cpu" || all[0].Instance != "0" {
+		t.Fatalf("unexpected stats: %+v", all)
+	}
+	if all[0].Gathers != 5 || all[0].Errors != 1 || all[0].LastError != "" || !all[0].LastSuccess.Equal(start.Add(4*time.Second)) {
+		t.Fatalf("unexpected merged stat: %+v", all[0])
+	}
+}
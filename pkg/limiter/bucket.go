@@ -0,0 +1,115 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+)
+
+// Bucket is a non-blocking token bucket, tokens are refilled at rate
+// per second up to burst
+type Bucket struct {
+	rate  float64
+	burst float64
+
+	lock   sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func NewBucket(rate, burst float64) *Bucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Bucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+	}
+}
+
+// AllowN takes n tokens if there are enough, a batch larger than burst
+// is allowed with a full bucket and the debt is paid by later refills
+func (b *Bucket) AllowN(now time.Time, n float64) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if !b.has(now, n) {
+		return false
+	}
+	b.tokens -= n
+	return true
+}
+
+// HasN reports whether AllowN would take n tokens, no token is taken
+func (b *Bucket) HasN(now time.Time, n float64) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.has(now, n)
+}
+
+func (b *Bucket) has(now time.Time, n float64) bool {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+
+	need := n
+	if need > b.burst {
+		need = b.burst
+	}
+	return b.tokens >= need
+}
+
+// KeyedBuckets keeps a bucket for every key, idle buckets are removed
+type KeyedBuckets struct {
+	rate  float64
+	burst float64
+
+	lock       sync.Mutex
+	buckets    map[string]*Bucket
+	lastExpire time.Time
+}
+
+func NewKeyedBuckets(rate, burst float64) *KeyedBuckets {
+	return &KeyedBuckets{
+		rate:    rate,
+		burst:   burst,
+		buckets: make(map[string]*Bucket),
+	}
+}
+
+const bucketIdle = 10 * time.Minute
+
+func (k *KeyedBuckets) AllowN(key string, now time.Time, n float64) bool {
+	return k.bucket(key, now).AllowN(now, n)
+}
+
+// HasN reports whether AllowN of the key would take n tokens, no token is taken
+func (k *KeyedBuckets) HasN(key string, now time.Time, n float64) bool {
+	return k.bucket(key, now).HasN(now, n)
+}
+
+func (k *KeyedBuckets) bucket(key string, now time.Time) *Bucket {
+	k.lock.Lock()
+	if now.Sub(k.lastExpire) > bucketIdle {
+		for key, b := range k.buckets {
+			b.lock.Lock()
+			idle := now.Sub(b.last) > bucketIdle
+			b.lock.Unlock()
+			if idle {
+				delete(k.buckets, key)
+			}
+		}
+		k.lastExpire = now
+	}
+	b, has := k.buckets[key]
+	if !has {
+		b = NewBucket(k.rate, k.burst)
+		k.buckets[key] = b
+	}
+	k.lock.Unlock()
+	return b
+}
@@ -0,0 +1,157 @@
+// Package listener serves the sockets of push inputs such as statsd and graphite
+package listener
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Server tracks listeners and connections so that Close stops all of them
+type Server struct {
+	// name of the input, used in logs
+	Name              string
+	MaxTCPConnections int
+	// socket read buffer size of udp and unixgram
+	ReadBufferSize int
+
+	lock      sync.Mutex
+	closers   []io.Closer
+	conns     map[net.Conn]struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// SplitAddress splits network://address, network is def if not given
+func SplitAddress(address, def string) (string, string) {
+	network, addr, found := strings.Cut(address, "://")
+	if !found {
+		return def, address
+	}
+	return network, addr
+}
+
+// Listen listens on udp, tcp, unix or unixgram, handlePacket is called with
+// each packet which is only valid during the call, handleConn is called in
+// a goroutine with each stream connection
+func (s *Server) Listen(network, address string, handlePacket func([]byte), handleConn func(net.Conn)) error {
+	switch network {
+	case "udp", "udp4", "udp6", "unixgram":
+		return s.listenPacket(network, address, handlePacket)
+	case "tcp", "tcp4", "tcp6", "unix":
+		return s.listenStream(network, address, handleConn)
+	}
+	return fmt.Errorf("unsupported network %q of %s", network, address)
+}
+
+func (s *Server) listenPacket(network, address string, handle func([]byte)) error {
+	if network == "unixgram" {
+		os.Remove(address)
+	}
+	conn, err := net.ListenPacket(network, address)
+	if err != nil {
+		return err
+	}
+	if s.ReadBufferSize > 0 {
+		if c, ok := conn.(interface{ SetReadBuffer(int) error }); ok {
+			if err := c.SetReadBuffer(s.ReadBufferSize); err != nil {
+				log.Println("W!", s.Name, "failed to set read buffer of", address, "error:", err)
+			}
+		}
+	}
+	s.addCloser(conn)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		buf := make([]byte, 64*1024)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					log.Println("E!", s.Name, "failed to read from", address, "error:", err)
+				}
+				return
+			}
+			handle(buf[:n])
+		}
+	}()
+	return nil
+}
+
+func (s *Server) listenStream(network, address string, handle func(net.Conn)) error {
+	if network == "unix" {
+		os.Remove(address)
+	}
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+	s.addCloser(listener)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					log.Println("E!", s.Name, "failed to accept on", address, "error:", err)
+				}
+				return
+			}
+
+			s.lock.Lock()
+			if s.MaxTCPConnections > 0 && len(s.conns) >= s.MaxTCPConnections {
+				s.lock.Unlock()
+				log.Println("W!", s.Name, "max_tcp_connections reached, refused connection from", conn.RemoteAddr())
+				conn.Close()
+				continue
+			}
+			if s.conns == nil {
+				s.conns = make(map[net.Conn]struct{})
+			}
+			s.conns[conn] = struct{}{}
+			s.lock.Unlock()
+
+			s.wg.Add(1)
+			go func() {
+				defer func() {
+					s.lock.Lock()
+					delete(s.conns, conn)
+					s.lock.Unlock()
+					conn.Close()
+					s.wg.Done()
+				}()
+				handle(conn)
+			}()
+		}
+	}()
+	return nil
+}
+
+func (s *Server) addCloser(c io.Closer) {
+	s.lock.Lock()
+	s.closers = append(s.closers, c)
+	s.lock.Unlock()
+}
+
+// Close closes listeners and connections and waits for the handlers to return
+func (s *Server) Close() {
+	s.closeOnce.Do(func() {
+		s.lock.Lock()
+		for _, c := range s.closers {
+			c.Close()
+		}
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.lock.Unlock()
+		s.wg.Wait()
+	})
+}
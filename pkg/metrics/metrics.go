@@ -15,6 +15,7 @@ import (
 	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/expfmt"
 	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
 
 	"flashcat.cloud/categraf/pkg/prom"
 	"flashcat.cloud/categraf/types"
@@ -74,27 +75,107 @@ func HandleHistogram(defaultPrefix string, m *dto.Metric, tags map[string]string
 	}
 	fn := initTimeFn(tf)
 
-	slist.PushFront(types.NewSample("", prom.BuildMetric(namePrefix, metricName, "count"), float64(m.GetHistogram().GetSampleCount()), tags).SetTime(fn(m.GetTimestampMs())))
-	slist.PushFront(types.NewSample("", prom.BuildMetric(namePrefix, metricName, "sum"), m.GetHistogram().GetSampleSum(), tags).SetTime(fn(m.GetTimestampMs())))
-	slist.PushFront(types.NewSample("", prom.BuildMetric(namePrefix, metricName, "bucket"), float64(m.GetHistogram().GetSampleCount()), tags, map[string]string{"le": "+Inf"}).SetTime(fn(m.GetTimestampMs())))
+	h := m.GetHistogram()
+	if isNativeHistogram(h) {
+		s := types.NewSample("", prom.BuildMetric(namePrefix, metricName), nil, tags).SetTime(fn(m.GetTimestampMs()))
+		s.Histogram = NativeHistogram(h)
+		s.Exemplars = Exemplars(h.GetExemplars()...)
+		slist.PushFront(s)
+		// native only histogram has no classic buckets
+		if len(h.GetBucket()) == 0 {
+			return
+		}
+	}
+
+	slist.PushFront(types.NewSample("", prom.BuildMetric(namePrefix, metricName, "count"), float64(h.GetSampleCount()), tags).SetTime(fn(m.GetTimestampMs())))
+	slist.PushFront(types.NewSample("", prom.BuildMetric(namePrefix, metricName, "sum"), h.GetSampleSum(), tags).SetTime(fn(m.GetTimestampMs())))
+	slist.PushFront(types.NewSample("", prom.BuildMetric(namePrefix, metricName, "bucket"), float64(h.GetSampleCount()), tags, map[string]string{"le": "+Inf"}).SetTime(fn(m.GetTimestampMs())))
 
-	for _, b := range m.GetHistogram().Bucket {
+	for _, b := range h.Bucket {
 		le := fmt.Sprint(b.GetUpperBound())
 		value := float64(b.GetCumulativeCount())
-		slist.PushFront(types.NewSample("", prom.BuildMetric(namePrefix, metricName, "bucket"), value, tags, map[string]string{"le": le}).SetTime(fn(m.GetTimestampMs())))
+		s := types.NewSample("", prom.BuildMetric(namePrefix, metricName, "bucket"), value, tags, map[string]string{"le": le}).SetTime(fn(m.GetTimestampMs()))
+		if b.Exemplar != nil {
+			s.Exemplars = Exemplars(b.Exemplar)
+		}
+		slist.PushFront(s)
+	}
+}
+
+// isNativeHistogram reports whether the histogram carries native buckets
+func isNativeHistogram(h *dto.Histogram) bool {
+	return h.GetSchema() != 0 || h.GetZeroThreshold() > 0 || h.GetZeroCount() > 0 || h.GetZeroCountFloat() > 0 ||
+		len(h.GetPositiveSpan()) > 0 || len(h.GetNegativeSpan()) > 0
+}
+
+// NativeHistogram converts a native histogram of exposition format to remote write format
+func NativeHistogram(h *dto.Histogram) *prompb.Histogram {
+	ret := &prompb.Histogram{
+		Sum:            h.GetSampleSum(),
+		Schema:         h.GetSchema(),
+		ZeroThreshold:  h.GetZeroThreshold(),
+		NegativeSpans:  bucketSpans(h.GetNegativeSpan()),
+		NegativeDeltas: h.GetNegativeDelta(),
+		NegativeCounts: h.GetNegativeCount(),
+		PositiveSpans:  bucketSpans(h.GetPositiveSpan()),
+		PositiveDeltas: h.GetPositiveDelta(),
+		PositiveCounts: h.GetPositiveCount(),
 	}
+	// float histograms carry float counts
+	if h.GetSampleCountFloat() > 0 || h.GetZeroCountFloat() > 0 {
+		ret.Count = &prompb.Histogram_CountFloat{CountFloat: h.GetSampleCountFloat()}
+		ret.ZeroCount = &prompb.Histogram_ZeroCountFloat{ZeroCountFloat: h.GetZeroCountFloat()}
+	} else {
+		ret.Count = &prompb.Histogram_CountInt{CountInt: h.GetSampleCount()}
+		ret.ZeroCount = &prompb.Histogram_ZeroCountInt{ZeroCountInt: h.GetZeroCount()}
+	}
+	return ret
+}
+
+func bucketSpans(spans []*dto.BucketSpan) []prompb.BucketSpan {
+	if len(spans) == 0 {
+		return nil
+	}
+	ret := make([]prompb.BucketSpan, 0, len(spans))
+	for _, span := range spans {
+		ret = append(ret, prompb.BucketSpan{Offset: span.GetOffset(), Length: span.GetLength()})
+	}
+	return ret
+}
+
+// Exemplars converts exemplars of exposition format to remote write format
+func Exemplars(es ...*dto.Exemplar) []prompb.Exemplar {
+	ret := make([]prompb.Exemplar, 0, len(es))
+	for _, e := range es {
+		if e == nil {
+			continue
+		}
+		ex := prompb.Exemplar{Value: e.GetValue()}
+		for _, l := range e.GetLabel() {
+			ex.Labels = append(ex.Labels, prompb.Label{Name: l.GetName(), Value: l.GetValue()})
+		}
+		if e.GetTimestamp() != nil {
+			ex.Timestamp = e.GetTimestamp().AsTime().UnixMilli()
+		}
+		ret = append(ret, ex)
+	}
+	return ret
 }
 
 func HandleGaugeCounter(defaultPrefix string, m *dto.Metric, tags map[string]string, metricName string, tf timeFn, slist *types.SampleList) {
 	fields := getNameAndValue(m, metricName)
 	fn := initTimeFn(tf)
 	for metric, value := range fields {
+		var s *types.Sample
 		if !strings.HasPrefix(metric, defaultPrefix) {
-			slist.PushFront(types.NewSample("", prom.BuildMetric(defaultPrefix, metric, ""), value, tags).SetTime(fn(m.GetTimestampMs())))
+			s = types.NewSample("", prom.BuildMetric(defaultPrefix, metric, ""), value, tags).SetTime(fn(m.GetTimestampMs()))
 		} else {
-			slist.PushFront(types.NewSample("", prom.BuildMetric("", metric, ""), value, tags).SetTime(fn(m.GetTimestampMs())))
+			s = types.NewSample("", prom.BuildMetric("", metric, ""), value, tags).SetTime(fn(m.GetTimestampMs()))
 		}
-
+		if m.GetCounter().GetExemplar() != nil {
+			s.Exemplars = Exemplars(m.GetCounter().GetExemplar())
+		}
+		slist.PushFront(s)
 	}
 }
 
@@ -4,6 +4,11 @@ import (
 	"net/http"
 	"strings"
 	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+
+	"flashcat.cloud/categraf/types"
 )
 
 func TestParseReaderTextFormatUsesValidationScheme(t *testing.T) {
@@ -26,3 +31,40 @@ func TestParseReaderTextFormatRejectsInvalidUTF8MetricName(t *testing.T) {
 		t.Fatal("expected invalid UTF-8 metric name error")
 	}
 }
+
+func TestHandleNativeHistogram(t *testing.T) {
+	m := &dto.Metric{
+		Histogram: &dto.Histogram{
+			SampleCount:   proto.Uint64(3),
+			SampleSum:     proto.Float64(4.5),
+			Schema:        proto.Int32(3),
+			ZeroThreshold: proto.Float64(1e-128),
+			PositiveSpan:  []*dto.BucketSpan{{Offset: proto.Int32(0), Length: proto.Uint32(2)}},
+			PositiveDelta: []int64{1, 1},
+			Exemplars: []*dto.Exemplar{{
+				Label: []*dto.LabelPair{{Name: proto.String("trace_id"), Value: proto.String("abc")}},
+				Value: proto.Float64(1.5),
+			}},
+		},
+		TimestampMs: proto.Int64(1000),
+	}
+
+	slist := types.NewSampleList()
+	HandleHistogram("", m, map[string]string{"job": "api"}, "request_seconds", nil, slist)
+	ss := slist.PopBackAll()
+	if len(ss) != 1 || ss[0].Histogram == nil {
+		t.Fatalf("expected 1 native histogram sample, got %d", len(ss))
+	}
+
+	ts := ss[0].ConvertTimeSeries("ms")
+	if len(ts.Samples) != 0 || len(ts.Histograms) != 1 || len(ts.Exemplars) != 1 {
+		t.Fatalf("unexpected time series: %v", ts)
+	}
+	h := ts.Histograms[0]
+	if h.GetCountInt() != 3 || h.Schema != 3 || h.Timestamp != 1000 || len(h.PositiveSpans) != 1 {
+		t.Fatalf("unexpected histogram: %v", h)
+	}
+	if ts.Exemplars[0].Labels[0].Value != "abc" {
+		t.Fatalf("unexpected exemplar: %v", ts.Exemplars[0])
+	}
+}
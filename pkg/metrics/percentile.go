@@ -0,0 +1,15 @@
+package metrics
+
+import "math"
+
+// Percentile uses the nearest rank method, values must be sorted
+func Percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return math.NaN()
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -1,6 +1,7 @@
 package stringx
 
 import (
+	"strings"
 	"unicode"
 )
 
@@ -29,3 +30,13 @@ func SnakeCase(in string) string {
 
 	return string(out)
 }
+
+// HasAnySuffix tests whether s ends with any of the suffixes
+func HasAnySuffix(s string, suffixes []string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(s, suffix) {
+			return true
+		}
+	}
+	return false
+}
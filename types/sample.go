@@ -22,6 +22,9 @@ type (
 		Timestamp time.Time         `json:"timestamp"`
 		Value     interface{}       `json:"value"`
 		Labels    map[string]string `json:"labels"`
+		// native histogram, Value is ignored if set
+		Histogram *prompb.Histogram `json:"histogram,omitempty"`
+		Exemplars []prompb.Exemplar `json:"exemplars,omitempty"`
 	}
 )
 
@@ -54,12 +57,6 @@ func NewSample(prefix, metric string, value interface{}, labels ...map[string]st
 }
 
 func (item *Sample) ConvertTimeSeries(precision string) *prompb.TimeSeries {
-	value, err := conv.ToFloat64(item.Value)
-	if err != nil {
-		// If the Labels is empty, it means it is abnormal data
-		return nil
-	}
-
 	pt := prompb.TimeSeries{}
 
 	timestamp := item.Timestamp.UnixMilli()
@@ -71,10 +68,23 @@ func (item *Sample) ConvertTimeSeries(precision string) *prompb.TimeSeries {
 		timestamp = ts - ts%60000
 	}
 
-	pt.Samples = append(pt.Samples, prompb.Sample{
-		Timestamp: timestamp,
-		Value:     value,
-	})
+	if item.Histogram != nil {
+		h := *item.Histogram
+		h.Timestamp = timestamp
+		pt.Histograms = append(pt.Histograms, h)
+	} else {
+		value, err := conv.ToFloat64(item.Value)
+		if err != nil {
+			// If the Labels is empty, it means it is abnormal data
+			return nil
+		}
+
+		pt.Samples = append(pt.Samples, prompb.Sample{
+			Timestamp: timestamp,
+			Value:     value,
+		})
+	}
+	pt.Exemplars = item.Exemplars
 
 	// add label: metric
 	pt.Labels = append(pt.Labels, prompb.Label{
@@ -0,0 +1,33 @@
+package types
+
+import (
+	"hash/fnv"
+	"sort"
+	"strings"
+)
+
+// SeriesKey identifies a series by the metric name and the sorted labels
+func SeriesKey(metric string, labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString(metric)
+	for _, k := range names {
+		sb.WriteByte(0xff)
+		sb.WriteString(k)
+		sb.WriteByte('=')
+		sb.WriteString(labels[k])
+	}
+	return sb.String()
+}
+
+// SeriesHash is the 64-bit fnv hash of SeriesKey
+func SeriesHash(metric string, labels map[string]string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(SeriesKey(metric, labels)))
+	return h.Sum64()
+}
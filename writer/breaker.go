@@ -0,0 +1,96 @@
+package writer
+
+import (
+	"sync"
+	"time"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker stops sending to an endpoint after consecutive failures,
+// once the cooldown elapsed a probe is let through to check whether it recovered
+type circuitBreaker struct {
+	sync.Mutex
+
+	threshold int
+	cooldown  time.Duration
+
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// Wait returns how long to wait before the next attempt is allowed
+func (cb *circuitBreaker) Wait() time.Duration {
+	cb.Lock()
+	defer cb.Unlock()
+
+	if cb.state != breakerOpen {
+		return 0
+	}
+	if wait := cb.cooldown - time.Since(cb.openedAt); wait > 0 {
+		return wait
+	}
+	cb.state = breakerHalfOpen
+	return 0
+}
+
+// Open reports whether the endpoint is considered unavailable
+func (cb *circuitBreaker) Open() bool {
+	cb.Lock()
+	defer cb.Unlock()
+	return cb.state == breakerOpen
+}
+
+func (cb *circuitBreaker) State() breakerState {
+	cb.Lock()
+	defer cb.Unlock()
+	return cb.state
+}
+
+// Success closes the breaker and reports whether it was not closed before
+func (cb *circuitBreaker) Success() bool {
+	cb.Lock()
+	defer cb.Unlock()
+	recovered := cb.state != breakerClosed
+	cb.state = breakerClosed
+	cb.failures = 0
+	return recovered
+}
+
+// Failure records a failed attempt and reports whether the breaker has just opened
+func (cb *circuitBreaker) Failure() bool {
+	cb.Lock()
+	defer cb.Unlock()
+	cb.failures++
+	if cb.state == breakerHalfOpen || (cb.state == breakerClosed && cb.failures >= cb.threshold) {
+		cb.state = breakerOpen
+		cb.openedAt = time.Now()
+		return true
+	}
+	return false
+}
@@ -0,0 +1,423 @@
+package writer
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+const (
+	segmentSuffix  = ".seg"
+	cursorFileName = "cursor"
+	// record header: payload length(4) + crc32(4) + enqueue unix ms(8)
+	recordHeaderSize = 16
+)
+
+var errCorruptRecord = errors.New("corrupt record")
+
+type (
+	// diskBuffer is a FIFO of remote write batches persisted in segment files,
+	// the read position is saved in the cursor file so it survives restarts
+	diskBuffer struct {
+		sync.Mutex
+
+		dir         string
+		maxSize     int64
+		segmentSize int64
+		maxAge      time.Duration
+
+		// ordered by seq, oldest first, the last one is the one being written
+		segments  []*segment
+		writeFile *os.File
+		writing   bool
+
+		readFile    *os.File
+		readSeq     uint64
+		readOffset  int64
+		pendingNext int64
+
+		size   int64
+		oldest time.Time
+	}
+
+	segment struct {
+		seq     uint64
+		size    int64
+		modTime time.Time
+	}
+)
+
+func newDiskBuffer(dir string, maxSize, segmentSize int64, maxAge time.Duration) (*diskBuffer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create disk buffer dir %s: %v", dir, err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read disk buffer dir %s: %v", dir, err)
+	}
+
+	db := &diskBuffer{
+		dir:         dir,
+		maxSize:     maxSize,
+		segmentSize: segmentSize,
+		maxAge:      maxAge,
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			log.Println("W! disk buffer: ignore unknown file:", name)
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		db.segments = append(db.segments, &segment{seq: seq, size: info.Size(), modTime: info.ModTime()})
+		db.size += info.Size()
+	}
+	sort.Slice(db.segments, func(i, j int) bool {
+		return db.segments[i].seq < db.segments[j].seq
+	})
+
+	db.readSeq, db.readOffset = db.loadCursor()
+	// segments before the cursor were consumed but not yet deleted
+	for len(db.segments) > 0 && db.segments[0].seq < db.readSeq {
+		if err := os.Remove(db.segmentPath(db.segments[0].seq)); err != nil {
+			log.Println("W! disk buffer: remove segment error:", err)
+		}
+		db.size -= db.segments[0].size
+		db.segments = db.segments[1:]
+	}
+	if len(db.segments) > 0 && db.segments[0].seq != db.readSeq {
+		db.readSeq, db.readOffset = db.segments[0].seq, 0
+	}
+
+	db.Lock()
+	db.expire()
+	db.refreshOldest()
+	db.Unlock()
+
+	return db, nil
+}
+
+func (db *diskBuffer) segmentPath(seq uint64) string {
+	return filepath.Join(db.dir, fmt.Sprintf("%020d%s", seq, segmentSuffix))
+}
+
+func (db *diskBuffer) loadCursor() (uint64, int64) {
+	bs, err := os.ReadFile(filepath.Join(db.dir, cursorFileName))
+	if err != nil {
+		return 0, 0
+	}
+	var (
+		seq    uint64
+		offset int64
+	)
+	if _, err := fmt.Sscanf(string(bs), "%d %d", &seq, &offset); err != nil {
+		log.Println("W! disk buffer: bad cursor file:", err)
+		return 0, 0
+	}
+	return seq, offset
+}
+
+func (db *diskBuffer) saveCursor() error {
+	tmp := filepath.Join(db.dir, cursorFileName+".tmp")
+	if err := os.WriteFile(tmp, []byte(fmt.Sprintf("%d %d", db.readSeq, db.readOffset)), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(db.dir, cursorFileName))
+}
+
+// Append writes a batch to the tail of the buffer
+func (db *diskBuffer) Append(items []prompb.TimeSeries) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	data, err := proto.Marshal(&prompb.WriteRequest{Timeseries: items})
+	if err != nil {
+		return err
+	}
+	payload := snappy.Encode(nil, data)
+
+	now := time.Now()
+	rec := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(rec[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(rec[4:8], crc32.ChecksumIEEE(payload))
+	binary.BigEndian.PutUint64(rec[8:16], uint64(now.UnixMilli()))
+	copy(rec[recordHeaderSize:], payload)
+
+	db.Lock()
+	defer db.Unlock()
+
+	if !db.writing || db.segments[len(db.segments)-1].size+int64(len(rec)) > db.segmentSize {
+		if err := db.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := db.writeFile.Write(rec); err != nil {
+		return err
+	}
+
+	seg := db.segments[len(db.segments)-1]
+	seg.size += int64(len(rec))
+	seg.modTime = now
+	db.size += int64(len(rec))
+	if db.oldest.IsZero() {
+		db.oldest = now
+	}
+
+	db.expire()
+	return nil
+}
+
+// rotate closes the segment being written and starts a new one
+func (db *diskBuffer) rotate() error {
+	if db.writeFile != nil {
+		if err := db.writeFile.Sync(); err != nil {
+			log.Println("W! disk buffer: sync segment error:", err)
+		}
+		db.writeFile.Close()
+		db.writeFile = nil
+	}
+
+	seq := db.readSeq
+	if len(db.segments) > 0 {
+		seq = db.segments[len(db.segments)-1].seq + 1
+	}
+
+	f, err := os.OpenFile(db.segmentPath(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	db.writeFile = f
+	db.writing = true
+	db.segments = append(db.segments, &segment{seq: seq, modTime: time.Now()})
+	if len(db.segments) == 1 {
+		db.readSeq, db.readOffset = seq, 0
+	}
+	return nil
+}
+
+// expire drops the oldest segments beyond max_size or max_age,
+// the segment being written is never dropped
+func (db *diskBuffer) expire() {
+	for len(db.segments) > 0 {
+		if db.tailOnly() {
+			return
+		}
+		seg := db.segments[0]
+		if db.size <= db.maxSize && time.Since(seg.modTime) <= db.maxAge {
+			return
+		}
+		log.Printf("W! disk buffer: drop segment %d(%d bytes) because of size or age limit", seg.seq, seg.size)
+		db.removeHead()
+	}
+}
+
+// tailOnly reports whether the only segment left is the one being written
+func (db *diskBuffer) tailOnly() bool {
+	return db.writing && len(db.segments) == 1
+}
+
+// removeHead deletes the oldest segment and moves the read cursor to the next one
+func (db *diskBuffer) removeHead() {
+	seg := db.segments[0]
+	if db.readFile != nil && db.readSeq == seg.seq {
+		db.readFile.Close()
+		db.readFile = nil
+	}
+	if err := os.Remove(db.segmentPath(seg.seq)); err != nil && !os.IsNotExist(err) {
+		log.Println("W! disk buffer: remove segment error:", err)
+	}
+	db.size -= seg.size
+	db.segments = db.segments[1:]
+
+	if len(db.segments) > 0 {
+		db.readSeq, db.readOffset = db.segments[0].seq, 0
+	} else {
+		db.readSeq, db.readOffset = seg.seq+1, 0
+	}
+	db.pendingNext = 0
+	if err := db.saveCursor(); err != nil {
+		log.Println("W! disk buffer: save cursor error:", err)
+	}
+	db.refreshOldest()
+}
+
+// Peek returns the oldest batch without consuming it, nil means empty
+func (db *diskBuffer) Peek() []prompb.TimeSeries {
+	db.Lock()
+	defer db.Unlock()
+
+	db.expire()
+
+	for len(db.segments) > 0 {
+		payload, _, next, err := db.readRecord()
+		if err != nil {
+			if db.tailOnly() {
+				return nil
+			}
+			if err != io.EOF {
+				log.Printf("W! disk buffer: skip the rest of segment %d: %v", db.readSeq, err)
+			}
+			db.removeHead()
+			continue
+		}
+
+		data, err := snappy.Decode(nil, payload)
+		if err != nil {
+			log.Println("W! disk buffer: skip undecodable record:", err)
+			db.advance(next)
+			continue
+		}
+		var req prompb.WriteRequest
+		if err := proto.Unmarshal(data, &req); err != nil {
+			log.Println("W! disk buffer: skip unmarshalable record:", err)
+			db.advance(next)
+			continue
+		}
+
+		db.pendingNext = next
+		return req.Timeseries
+	}
+
+	return nil
+}
+
+// Commit consumes the batch returned by the last Peek
+func (db *diskBuffer) Commit() {
+	db.Lock()
+	defer db.Unlock()
+
+	if db.pendingNext == 0 {
+		return
+	}
+	db.advance(db.pendingNext)
+	db.pendingNext = 0
+}
+
+func (db *diskBuffer) advance(next int64) {
+	db.readOffset = next
+	if err := db.saveCursor(); err != nil {
+		log.Println("W! disk buffer: save cursor error:", err)
+	}
+	db.refreshOldest()
+}
+
+// readRecord reads the record at the read cursor
+func (db *diskBuffer) readRecord() ([]byte, time.Time, int64, error) {
+	if db.readFile == nil {
+		f, err := os.Open(db.segmentPath(db.readSeq))
+		if err != nil {
+			return nil, time.Time{}, 0, err
+		}
+		db.readFile = f
+	}
+
+	hdr := make([]byte, recordHeaderSize)
+	n, err := db.readFile.ReadAt(hdr, db.readOffset)
+	if n == 0 && err == io.EOF {
+		return nil, time.Time{}, 0, io.EOF
+	}
+	if n < recordHeaderSize {
+		return nil, time.Time{}, 0, errCorruptRecord
+	}
+
+	length := int64(binary.BigEndian.Uint32(hdr[0:4]))
+	sum := binary.BigEndian.Uint32(hdr[4:8])
+	ts := time.UnixMilli(int64(binary.BigEndian.Uint64(hdr[8:16])))
+
+	payload := make([]byte, length)
+	if _, err := db.readFile.ReadAt(payload, db.readOffset+recordHeaderSize); err != nil {
+		return nil, time.Time{}, 0, errCorruptRecord
+	}
+	if crc32.ChecksumIEEE(payload) != sum {
+		return nil, time.Time{}, 0, errCorruptRecord
+	}
+
+	return payload, ts, db.readOffset + recordHeaderSize + length, nil
+}
+
+// refreshOldest updates the enqueue time of the next unread record,
+// exhausted segments before the tail are removed on the way
+func (db *diskBuffer) refreshOldest() {
+	db.oldest = time.Time{}
+	if len(db.segments) == 0 {
+		return
+	}
+	_, ts, _, err := db.readRecord()
+	switch {
+	case err == nil:
+		db.oldest = ts
+	case db.tailOnly():
+		if err != io.EOF {
+			db.oldest = db.segments[0].modTime
+		}
+	default:
+		db.removeHead()
+	}
+}
+
+// Size returns the bytes of all segments on disk
+func (db *diskBuffer) Size() int64 {
+	db.Lock()
+	defer db.Unlock()
+	return db.size
+}
+
+// OldestAge returns how long the oldest unread batch has been buffered
+func (db *diskBuffer) OldestAge() time.Duration {
+	db.Lock()
+	defer db.Unlock()
+	if db.oldest.IsZero() {
+		return 0
+	}
+	return time.Since(db.oldest)
+}
+
+// Empty reports whether there is nothing left to replay
+func (db *diskBuffer) Empty() bool {
+	db.Lock()
+	defer db.Unlock()
+	return db.oldest.IsZero()
+}
+
+func (db *diskBuffer) Close() error {
+	db.Lock()
+	defer db.Unlock()
+
+	if db.readFile != nil {
+		db.readFile.Close()
+		db.readFile = nil
+	}
+	if db.writeFile != nil {
+		err := db.writeFile.Sync()
+		db.writeFile.Close()
+		db.writeFile = nil
+		db.writing = false
+		return err
+	}
+	return nil
+}
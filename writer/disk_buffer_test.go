@@ -0,0 +1,83 @@
+package writer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+func makeSeries(name string) []prompb.TimeSeries {
+	return []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: name}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1000}},
+	}}
+}
+
+func TestDiskBufferReplayInOrderAcrossRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := newDiskBuffer(dir, 1<<20, 128, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		if err := db.Append(makeSeries(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	items := db.Peek()
+	if len(items) != 1 || items[0].Labels[0].Value != "a" {
+		t.Fatalf("expected series a, got %v", items)
+	}
+	db.Commit()
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = newDiskBuffer(dir, 1<<20, 128, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if db.Empty() || db.OldestAge() <= 0 {
+		t.Fatal("expected buffered series after restart")
+	}
+	for _, name := range []string{"b", "c"} {
+		items := db.Peek()
+		if len(items) != 1 || items[0].Labels[0].Value != name {
+			t.Fatalf("expected series %s, got %v", name, items)
+		}
+		db.Commit()
+	}
+	if items := db.Peek(); items != nil {
+		t.Fatalf("expected empty buffer, got %v", items)
+	}
+	if !db.Empty() {
+		t.Fatal("expected empty buffer")
+	}
+}
+
+func TestDiskBufferDropOldestBeyondMaxSize(t *testing.T) {
+	db, err := newDiskBuffer(t.TempDir(), 200, 64, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"} {
+		if err := db.Append(makeSeries(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if db.Size() > 200 {
+		t.Fatalf("expected size bounded by max size, got %d", db.Size())
+	}
+	items := db.Peek()
+	if len(items) != 1 || items[0].Labels[0].Value == "a" {
+		t.Fatalf("expected oldest series dropped, got %v", items)
+	}
+}
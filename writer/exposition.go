@@ -0,0 +1,189 @@
+package writer
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/config"
+)
+
+// exposedSeries is the latest point of a series
+type exposedSeries struct {
+	// sorted by name
+	labels    []prompb.Label
+	sample    *prompb.Sample
+	histogram *prompb.Histogram
+	seen      time.Time
+	// interval of the source, pushed series use the gap between writes
+	interval time.Duration
+	fixed    bool
+}
+
+// exposer keeps the latest point of every written series
+// for the local /metrics endpoint
+type exposer struct {
+	// series not written for staleIntervals*interval are removed
+	staleIntervals int
+	// interval of series whose source interval is unknown yet
+	interval time.Duration
+
+	lock       sync.RWMutex
+	series     map[uint64][]*exposedSeries
+	lastExpire time.Time
+}
+
+var exposed *exposer
+
+func initExposer() {
+	conf := config.Config.HTTP
+	if conf == nil || !conf.Enable || !conf.ExposeMetrics {
+		exposed = nil
+		return
+	}
+	n := conf.ExposeStaleIntervals
+	if n <= 0 {
+		n = 3
+	}
+	exposed = newExposer(n, config.GetInterval())
+}
+
+func newExposer(staleIntervals int, interval time.Duration) *exposer {
+	return &exposer{
+		staleIntervals: staleIntervals,
+		interval:       interval,
+		series:         make(map[uint64][]*exposedSeries),
+	}
+}
+
+// stale returns how long the series is kept without writes
+func (e *exposer) stale(s *exposedSeries) time.Duration {
+	if s.interval > 0 {
+		return time.Duration(e.staleIntervals) * s.interval
+	}
+	return time.Duration(e.staleIntervals) * e.interval
+}
+
+// update keeps the latest points, interval is the interval of the source,
+// zero means unknown and the gap between writes of a series is used
+func (e *exposer) update(timeSeries []prompb.TimeSeries, interval time.Duration, now time.Time) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	for i := range timeSeries {
+		ts := &timeSeries[i]
+		if len(ts.Samples) == 0 && len(ts.Histograms) == 0 {
+			continue
+		}
+		hash := seriesHash(ts, nil)
+		labels := sortedLabels(ts.Labels)
+		s := e.lookup(hash, labels)
+		if s == nil {
+			s = &exposedSeries{labels: append([]prompb.Label(nil), labels...)}
+			e.series[hash] = append(e.series[hash], s)
+		} else if gap := now.Sub(s.seen); interval == 0 && !s.fixed && gap >= time.Second {
+			s.interval = gap
+		}
+		if interval > 0 {
+			s.interval, s.fixed = interval, true
+		}
+		s.seen = now
+		if len(ts.Histograms) > 0 {
+			h := ts.Histograms[len(ts.Histograms)-1]
+			s.histogram, s.sample = &h, nil
+		} else {
+			sample := ts.Samples[len(ts.Samples)-1]
+			s.sample, s.histogram = &sample, nil
+		}
+	}
+
+	if now.Sub(e.lastExpire) > time.Duration(e.staleIntervals)*e.interval {
+		e.expire(now)
+		e.lastExpire = now
+	}
+}
+
+// lookup compares labels since different series may have the same hash
+func (e *exposer) lookup(hash uint64, labels []prompb.Label) *exposedSeries {
+	for _, s := range e.series[hash] {
+		if equalLabels(s.labels, labels) {
+			return s
+		}
+	}
+	return nil
+}
+
+func (e *exposer) expire(now time.Time) {
+	for hash, list := range e.series {
+		kept := list[:0]
+		for _, s := range list {
+			if now.Sub(s.seen) <= e.stale(s) {
+				kept = append(kept, s)
+			}
+		}
+		if len(kept) == 0 {
+			delete(e.series, hash)
+			continue
+		}
+		e.series[hash] = kept
+	}
+}
+
+func sortedLabels(labels []prompb.Label) []prompb.Label {
+	if sort.SliceIsSorted(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name }) {
+		return labels
+	}
+	labels = append([]prompb.Label(nil), labels...)
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+	return labels
+}
+
+func equalLabels(a, b []prompb.Label) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || a[i].Value != b[i].Value {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *exposer) snapshot(now time.Time) []prompb.TimeSeries {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	ret := make([]prompb.TimeSeries, 0, len(e.series))
+	for _, list := range e.series {
+		for _, s := range list {
+			if now.Sub(s.seen) > e.stale(s) {
+				continue
+			}
+			ts := prompb.TimeSeries{Labels: s.labels}
+			if s.histogram != nil {
+				ts.Histograms = []prompb.Histogram{*s.histogram}
+			} else {
+				ts.Samples = []prompb.Sample{*s.sample}
+			}
+			ret = append(ret, ts)
+		}
+	}
+	return ret
+}
+
+// ExposeEnabled reports whether the latest points are kept for /metrics
+func ExposeEnabled() bool {
+	return exposed != nil
+}
+
+// ExposedSeries returns the latest point of every series written
+// within expose_stale_intervals
+func ExposedSeries() []prompb.TimeSeries {
+	if exposed == nil {
+		return nil
+	}
+	return exposed.snapshot(time.Now())
+}
@@ -0,0 +1,87 @@
+package writer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+func TestExposerStale(t *testing.T) {
+	e := newExposer(3, 20*time.Second)
+	now := time.Now()
+
+	cpu := prompb.TimeSeries{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "cpu_usage_idle"}, {Name: "cpu", Value: "cpu-total"}},
+		Samples: []prompb.Sample{{Value: 90, Timestamp: now.UnixMilli()}},
+	}
+	mem := prompb.TimeSeries{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "mem_used_percent"}},
+		Samples: []prompb.Sample{{Value: 30, Timestamp: now.UnixMilli()}},
+	}
+	e.update([]prompb.TimeSeries{cpu, mem}, 0, now)
+
+	cpu.Samples[0].Value = 80
+	e.update([]prompb.TimeSeries{cpu}, 0, now.Add(50*time.Second))
+
+	series := e.snapshot(now.Add(70 * time.Second))
+	if len(series) != 1 || series[0].Samples[0].Value != 80 {
+		t.Fatalf("expected only the latest cpu_usage_idle, got %v", series)
+	}
+
+	// cpu_usage_idle is pushed every 50s, so it is stale after 150s
+	e.update(nil, 0, now.Add(3*time.Minute))
+	if len(e.series) != 1 {
+		t.Fatalf("expected cpu_usage_idle kept, got %d", len(e.series))
+	}
+	e.update(nil, 0, now.Add(5*time.Minute))
+	if len(e.series) != 0 {
+		t.Fatalf("expected stale series removed, got %d", len(e.series))
+	}
+}
+
+func TestExposerSourceInterval(t *testing.T) {
+	e := newExposer(3, 15*time.Second)
+	now := time.Now()
+
+	disk := prompb.TimeSeries{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "disk_used_percent"}},
+		Samples: []prompb.Sample{{Value: 30}},
+	}
+	e.update([]prompb.TimeSeries{disk}, 5*time.Minute, now)
+	// writes without interval do not override the interval of the source
+	e.update([]prompb.TimeSeries{disk}, 0, now.Add(2*time.Second))
+
+	if series := e.snapshot(now.Add(10 * time.Minute)); len(series) != 1 {
+		t.Fatalf("expected series of 5m interval kept, got %v", series)
+	}
+	if series := e.snapshot(now.Add(16 * time.Minute)); len(series) != 0 {
+		t.Fatalf("expected series stale, got %v", series)
+	}
+}
+
+func TestExposerHashCollision(t *testing.T) {
+	e := newExposer(3, 15*time.Second)
+	now := time.Now()
+
+	a := prompb.TimeSeries{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "a"}},
+		Samples: []prompb.Sample{{Value: 1}},
+	}
+	b := prompb.TimeSeries{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "b"}},
+		Samples: []prompb.Sample{{Value: 2}},
+	}
+	e.update([]prompb.TimeSeries{a}, 0, now)
+	// put b under the hash of a as if they collided
+	hash := seriesHash(&a, nil)
+	if s := e.lookup(hash, b.Labels); s != nil {
+		t.Fatalf("expected labels of b not matched, got %v", s.labels)
+	}
+	e.series[hash] = append(e.series[hash], &exposedSeries{labels: b.Labels, sample: &b.Samples[0], seen: now})
+
+	series := e.snapshot(now)
+	if len(series) != 2 {
+		t.Fatalf("expected both series exposed, got %v", series)
+	}
+}
@@ -0,0 +1,109 @@
+package writer
+
+import (
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/filter"
+	modelLabel "flashcat.cloud/categraf/pkg/prom/labels"
+	"flashcat.cloud/categraf/pkg/relabel"
+)
+
+// seriesFilter drops and rewrites series before they enter the queue of a writer
+type seriesFilter struct {
+	metricsPass    filter.Filter
+	metricsDrop    filter.Filter
+	labelsAllow    filter.Filter
+	labelsDeny     filter.Filter
+	relabelConfigs []*relabel.Config
+}
+
+// newSeriesFilter returns nil if no filter is configured
+func newSeriesFilter(opt config.WriterOption) (*seriesFilter, error) {
+	if len(opt.MetricsPass) == 0 && len(opt.MetricsDrop) == 0 &&
+		len(opt.LabelsAllow) == 0 && len(opt.LabelsDeny) == 0 && len(opt.RelabelConfigs) == 0 {
+		return nil, nil
+	}
+
+	var (
+		f   = &seriesFilter{}
+		err error
+	)
+	if f.metricsPass, err = filter.Compile(opt.MetricsPass); err != nil {
+		return nil, err
+	}
+	if f.metricsDrop, err = filter.Compile(opt.MetricsDrop); err != nil {
+		return nil, err
+	}
+	if f.labelsAllow, err = filter.Compile(opt.LabelsAllow); err != nil {
+		return nil, err
+	}
+	if f.labelsDeny, err = filter.Compile(opt.LabelsDeny); err != nil {
+		return nil, err
+	}
+	if f.relabelConfigs, err = config.CompileRelabelConfigs(opt.RelabelConfigs); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// apply returns the series kept by the filter, the input is shared by
+// all writers so it is never modified
+func (f *seriesFilter) apply(items []prompb.TimeSeries) []prompb.TimeSeries {
+	ret := make([]prompb.TimeSeries, 0, len(items))
+	for i := range items {
+		name := metricName(&items[i])
+		if f.metricsDrop != nil && f.metricsDrop.Match(name) {
+			continue
+		}
+		if f.metricsPass != nil && !f.metricsPass.Match(name) {
+			continue
+		}
+
+		labels := make([]prompb.Label, 0, len(items[i].Labels))
+		for _, l := range items[i].Labels {
+			if l.Name != model.MetricNameLabel {
+				if f.labelsAllow != nil && !f.labelsAllow.Match(l.Name) {
+					continue
+				}
+				if f.labelsDeny != nil && f.labelsDeny.Match(l.Name) {
+					continue
+				}
+			}
+			labels = append(labels, l)
+		}
+
+		if len(f.relabelConfigs) != 0 {
+			all := make(modelLabel.Labels, 0, len(labels))
+			for _, l := range labels {
+				all = append(all, modelLabel.Label{Name: l.Name, Value: l.Value})
+			}
+			newAll, keep := relabel.Process(all, f.relabelConfigs...)
+			if !keep {
+				continue
+			}
+			labels = labels[:0]
+			for _, l := range newAll {
+				labels = append(labels, prompb.Label{Name: l.Name, Value: l.Value})
+			}
+		}
+
+		ret = append(ret, prompb.TimeSeries{
+			Labels:     labels,
+			Samples:    items[i].Samples,
+			Exemplars:  items[i].Exemplars,
+			Histograms: items[i].Histograms,
+		})
+	}
+	return ret
+}
+
+func metricName(ts *prompb.TimeSeries) string {
+	for _, l := range ts.Labels {
+		if l.Name == model.MetricNameLabel {
+			return l.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,58 @@
+package writer
+
+import (
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/relabel"
+)
+
+func TestSeriesFilter(t *testing.T) {
+	f, err := newSeriesFilter(config.WriterOption{
+		MetricsDrop: []string{"*_bucket"},
+		LabelsDeny:  []string{"tenant"},
+		RelabelConfigs: []*config.RelabelConfig{{
+			SourceLabels: model.LabelNames{"ident"},
+			TargetLabel:  "host",
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items := []prompb.TimeSeries{
+		{Labels: []prompb.Label{{Name: "__name__", Value: "cpu_usage"}, {Name: "ident", Value: "a"}, {Name: "tenant", Value: "x"}}},
+		{Labels: []prompb.Label{{Name: "__name__", Value: "latency_bucket"}, {Name: "ident", Value: "a"}}},
+	}
+	ret := f.apply(items)
+	if len(ret) != 1 {
+		t.Fatalf("expected 1 series, got %d", len(ret))
+	}
+
+	got := map[string]string{}
+	for _, l := range ret[0].Labels {
+		got[l.Name] = l.Value
+	}
+	if _, has := got["tenant"]; has || got["host"] != "a" || got["__name__"] != "cpu_usage" {
+		t.Fatalf("unexpected labels: %v", got)
+	}
+	// input is shared by writers and must stay untouched
+	if len(items[0].Labels) != 3 || items[0].Labels[2].Name != "tenant" {
+		t.Fatalf("input modified: %v", items[0].Labels)
+	}
+}
+
+func TestSeriesFilterNone(t *testing.T) {
+	f, err := newSeriesFilter(config.WriterOption{})
+	if err != nil || f != nil {
+		t.Fatalf("expected nil filter, got %v %v", f, err)
+	}
+	if _, err := newSeriesFilter(config.WriterOption{
+		RelabelConfigs: []*config.RelabelConfig{{Regex: "(", Action: relabel.Replace}},
+	}); err == nil {
+		t.Fatal("expected regex compile error")
+	}
+}
@@ -0,0 +1,208 @@
+package writer
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// payload formats of kafka writer
+const (
+	FormatProtobuf = "protobuf"
+	FormatJSON     = "json"
+	FormatInflux   = "influx"
+)
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	influxTagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+type (
+	jsonSample struct {
+		Metric    string            `json:"metric"`
+		Labels    map[string]string `json:"labels"`
+		Timestamp int64             `json:"timestamp"`
+		// nil for native histograms
+		Value     *float64       `json:"value,omitempty"`
+		Histogram *jsonHistogram `json:"histogram,omitempty"`
+	}
+
+	// jsonHistogram is a native histogram with sparse buckets, the upper bound
+	// of bucket index i is 2^(i*2^-schema)
+	jsonHistogram struct {
+		Count           float64      `json:"count"`
+		Sum             float64      `json:"sum"`
+		Schema          int32        `json:"schema"`
+		ZeroThreshold   float64      `json:"zero_threshold"`
+		ZeroCount       float64      `json:"zero_count"`
+		PositiveBuckets []jsonBucket `json:"positive_buckets,omitempty"`
+		NegativeBuckets []jsonBucket `json:"negative_buckets,omitempty"`
+	}
+
+	jsonBucket struct {
+		Index int32   `json:"index"`
+		Count float64 `json:"count"`
+	}
+)
+
+func validFormat(format string) error {
+	switch format {
+	case FormatProtobuf, FormatJSON, FormatInflux:
+		return nil
+	}
+	return fmt.Errorf("unsupported format: %s", format)
+}
+
+// encodePayload serializes series in the given format
+func encodePayload(format string, items []prompb.TimeSeries) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		return encodeJSON(items)
+	case FormatInflux:
+		return encodeInflux(items), nil
+	default:
+		return proto.Marshal(&prompb.WriteRequest{Timeseries: items})
+	}
+}
+
+// encodeJSON writes every sample as an object of a json array
+func encodeJSON(items []prompb.TimeSeries) ([]byte, error) {
+	samples := make([]jsonSample, 0, len(items))
+	for i := range items {
+		labels := make(map[string]string, len(items[i].Labels))
+		var name string
+		for _, l := range items[i].Labels {
+			if l.Name == model.MetricNameLabel {
+				name = l.Value
+				continue
+			}
+			labels[l.Name] = l.Value
+		}
+		for _, s := range items[i].Samples {
+			if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				continue
+			}
+			v := s.Value
+			samples = append(samples, jsonSample{
+				Metric:    name,
+				Labels:    labels,
+				Timestamp: s.Timestamp,
+				Value:     &v,
+			})
+		}
+		for _, h := range items[i].Histograms {
+			if value.IsStaleNaN(h.Sum) {
+				continue
+			}
+			samples = append(samples, jsonSample{
+				Metric:    name,
+				Labels:    labels,
+				Timestamp: h.Timestamp,
+				Histogram: toJSONHistogram(h),
+			})
+		}
+	}
+	return json.Marshal(samples)
+}
+
+func toJSONHistogram(h prompb.Histogram) *jsonHistogram {
+	jh := &jsonHistogram{
+		Sum:             h.Sum,
+		Schema:          h.Schema,
+		ZeroThreshold:   h.ZeroThreshold,
+		PositiveBuckets: jsonBuckets(h.PositiveSpans, h.PositiveDeltas, h.PositiveCounts),
+		NegativeBuckets: jsonBuckets(h.NegativeSpans, h.NegativeDeltas, h.NegativeCounts),
+	}
+	if h.IsFloatHistogram() {
+		jh.Count, jh.ZeroCount = h.GetCountFloat(), h.GetZeroCountFloat()
+	} else {
+		jh.Count, jh.ZeroCount = float64(h.GetCountInt()), float64(h.GetZeroCountInt())
+	}
+	return jh
+}
+
+// jsonBuckets resolves the spans and deltas or counts of a native histogram
+func jsonBuckets(spans []prompb.BucketSpan, deltas []int64, counts []float64) []jsonBucket {
+	var (
+		ret   []jsonBucket
+		idx   int32
+		n     int
+		count int64
+	)
+	for i, span := range spans {
+		if i == 0 {
+			idx = span.Offset
+		} else {
+			idx += span.Offset
+		}
+		for j := uint32(0); j < span.Length; j++ {
+			b := jsonBucket{Index: idx}
+			switch {
+			case n < len(deltas):
+				count += deltas[n]
+				b.Count = float64(count)
+			case n < len(counts):
+				b.Count = counts[n]
+			}
+			ret = append(ret, b)
+			idx++
+			n++
+		}
+	}
+	return ret
+}
+
+// supportsHistograms reports whether native histograms can be encoded in the format
+func supportsHistograms(format string) bool {
+	return format != FormatInflux
+}
+
+// encodeInflux writes every sample as a line of influx line protocol,
+// the metric name is the measurement and the value is the field "value"
+func encodeInflux(items []prompb.TimeSeries) []byte {
+	var sb strings.Builder
+	for i := range items {
+		var name string
+		tags := make([]prompb.Label, 0, len(items[i].Labels))
+		for _, l := range items[i].Labels {
+			if l.Name == model.MetricNameLabel {
+				name = l.Value
+				continue
+			}
+			if l.Value == "" {
+				continue
+			}
+			tags = append(tags, l)
+		}
+		sort.Slice(tags, func(a, b int) bool { return tags[a].Name < tags[b].Name })
+
+		for _, s := range items[i].Samples {
+			// line protocol does not support NaN and Inf
+			if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				continue
+			}
+			sb.WriteString(influxMeasurementEscaper.Replace(name))
+			for _, t := range tags {
+				sb.WriteByte(',')
+				sb.WriteString(influxTagEscaper.Replace(t.Name))
+				sb.WriteByte('=')
+				sb.WriteString(influxTagEscaper.Replace(t.Value))
+			}
+			sb.WriteString(" value=")
+			sb.WriteString(strconv.FormatFloat(s.Value, 'g', -1, 64))
+			sb.WriteByte(' ')
+			sb.WriteString(strconv.FormatInt(s.Timestamp*1e6, 10))
+			sb.WriteByte('\n')
+		}
+	}
+	return []byte(sb.String())
+}
@@ -0,0 +1,89 @@
+package writer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/config"
+)
+
+func TestEncodeInflux(t *testing.T) {
+	items := []prompb.TimeSeries{{
+		Labels: []prompb.Label{
+			{Name: "__name__", Value: "cpu usage"},
+			{Name: "ident", Value: "a,b"},
+			{Name: "cpu", Value: "cpu0"},
+		},
+		Samples: []prompb.Sample{{Value: 1.5, Timestamp: 1000}},
+	}}
+	want := `cpu\ usage,cpu=cpu0,ident=a\,b value=1.5 1000000000` + "\n"
+	if got := string(encodeInflux(items)); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestEncodeJSON(t *testing.T) {
+	buf, err := encodeJSON(makeSeries("cpu_usage"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var samples []jsonSample
+	if err := json.Unmarshal(buf, &samples); err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 1 || samples[0].Metric != "cpu_usage" {
+		t.Fatalf("unexpected samples: %s", buf)
+	}
+}
+
+func TestEncodeJSONHistogram(t *testing.T) {
+	buf, err := encodeJSON([]prompb.TimeSeries{{
+		Labels: []prompb.Label{{Name: "__name__", Value: "rpc_latency_seconds"}},
+		Histograms: []prompb.Histogram{{
+			Count:          &prompb.Histogram_CountInt{CountInt: 5},
+			Sum:            2.5,
+			PositiveSpans:  []prompb.BucketSpan{{Offset: 1, Length: 1}, {Offset: 2, Length: 1}},
+			PositiveDeltas: []int64{2, 1},
+			Timestamp:      1000,
+		}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var samples []jsonSample
+	if err := json.Unmarshal(buf, &samples); err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 1 || samples[0].Value != nil || samples[0].Histogram == nil {
+		t.Fatalf("unexpected samples: %s", buf)
+	}
+	h := samples[0].Histogram
+	if h.Count != 5 || len(h.PositiveBuckets) != 2 ||
+		h.PositiveBuckets[0] != (jsonBucket{Index: 1, Count: 2}) || h.PositiveBuckets[1] != (jsonBucket{Index: 4, Count: 3}) {
+		t.Fatalf("unexpected histogram: %s", buf)
+	}
+}
+
+func TestWriterSkipsHistogramsOfInflux(t *testing.T) {
+	w := newTestWriter(t, "kafka://127.0.0.1:9092/metrics")
+	sender, err := newKafkaSender(config.WriterOption{
+		Kafka:  &config.KafkaConfig{Topic: "metrics", Brokers: []string{"127.0.0.1:9092"}},
+		Format: FormatInflux,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Sender = sender
+
+	items := append(makeSeries("cpu"), prompb.TimeSeries{
+		Labels:     []prompb.Label{{Name: "__name__", Value: "rpc_latency_seconds"}},
+		Histograms: []prompb.Histogram{{Sum: 1}},
+	})
+	w.Enqueue(items)
+	batch := w.queue.PopBack()
+	if batch == nil || len(*batch) != 1 || w.skippedHistograms.Load() != 1 {
+		t.Fatalf("expected the histogram skipped and counted, got %v", batch)
+	}
+}
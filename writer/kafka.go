@@ -0,0 +1,208 @@
+package writer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/config"
+)
+
+// kafka message keys
+const (
+	PartitionKeyMetric = "metric"
+	PartitionKeyIdent  = "ident"
+	PartitionKeySeries = "series"
+)
+
+// kafkaSender publishes series to a kafka topic
+type kafkaSender struct {
+	opts     config.WriterOption
+	config   *sarama.Config
+	producer sarama.SyncProducer
+
+	// Close waits for the running Send, the producer is not used after closed
+	lock   sync.Mutex
+	closed bool
+}
+
+// kafkaWriterUrl names a kafka writer which has no url
+func kafkaWriterUrl(kc *config.KafkaConfig) string {
+	return "kafka://" + strings.Join(kc.Brokers, ",") + "/" + kc.Topic
+}
+
+func newKafkaSender(opt config.WriterOption) (*kafkaSender, error) {
+	kc := opt.Kafka
+	if kc == nil || len(kc.Brokers) == 0 || kc.Topic == "" {
+		return nil, errors.New("kafka writer: brokers and topic are required")
+	}
+
+	if opt.Format == "" {
+		opt.Format = FormatProtobuf
+	}
+	if err := validFormat(opt.Format); err != nil {
+		return nil, fmt.Errorf("kafka writer: %v", err)
+	}
+	switch opt.PartitionKey {
+	case "", PartitionKeyMetric, PartitionKeyIdent, PartitionKeySeries:
+	default:
+		return nil, fmt.Errorf("kafka writer: unsupported partition key: %s", opt.PartitionKey)
+	}
+
+	c := kc.Config
+	if c == nil {
+		c = sarama.NewConfig()
+	}
+	c.Producer.Return.Successes = true
+	c.Producer.Return.Errors = true
+	c.Producer.RequiredAcks = sarama.WaitForAll
+	if opt.Timeout > 0 {
+		c.Producer.Timeout = time.Duration(opt.Timeout) * time.Millisecond
+	}
+	if opt.DialTimeout > 0 {
+		c.Net.DialTimeout = time.Duration(opt.DialTimeout) * time.Millisecond
+	}
+	switch kc.PartitionStrategy {
+	case "round_robin":
+		c.Producer.Partitioner = sarama.NewRoundRobinPartitioner
+	case "random":
+		c.Producer.Partitioner = sarama.NewRandomPartitioner
+	default:
+		c.Producer.Partitioner = sarama.NewHashPartitioner
+	}
+	kc.SetupCompression(c)
+	if kc.UseTLS {
+		var err error
+		c.Net.TLS.Enable = true
+		c.Net.TLS.Config, err = kc.ClientConfig.TLSConfig()
+		if err != nil {
+			return nil, fmt.Errorf("kafka writer TLS config: %w", err)
+		}
+	}
+	kc.SetupSarama(c)
+
+	return &kafkaSender{
+		opts:   opt,
+		config: c,
+	}, nil
+}
+
+func (s *kafkaSender) Send(items []prompb.TimeSeries) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return errors.New("kafka writer is closed")
+	}
+
+	// connect lazily, so unreachable brokers at boot do not stop the agent
+	if s.producer == nil {
+		p, err := sarama.NewSyncProducer(s.opts.Kafka.Brokers, s.config)
+		if err != nil {
+			return &writeError{err: fmt.Errorf("kafka producer: %w", err), retryable: true}
+		}
+		s.producer = p
+	}
+
+	msgs, err := s.messages(items)
+	if err != nil {
+		return err
+	}
+
+	if err := s.producer.SendMessages(msgs); err != nil {
+		return &writeError{err: err, retryable: true, failed: failedSeries(err, msgs)}
+	}
+	return nil
+}
+
+// failedSeries returns the series of messages not delivered, so only they are
+// retried, nil means all of them
+func failedSeries(err error, msgs []*sarama.ProducerMessage) []prompb.TimeSeries {
+	var perrs sarama.ProducerErrors
+	if !errors.As(err, &perrs) || len(perrs) == 0 || len(perrs) >= len(msgs) {
+		return nil
+	}
+	failed := make([]prompb.TimeSeries, 0)
+	for _, perr := range perrs {
+		if series, ok := perr.Msg.Metadata.([]prompb.TimeSeries); ok {
+			failed = append(failed, series...)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return failed
+}
+
+func (s *kafkaSender) histograms() bool {
+	return supportsHistograms(s.opts.Format)
+}
+
+// Close is called after LoopWrite exits, the lock also keeps a late Send off
+// the closed producer
+func (s *kafkaSender) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.closed = true
+	if s.producer == nil {
+		return nil
+	}
+	return s.producer.Close()
+}
+
+// messages groups series by partition key, a message is built for every group
+func (s *kafkaSender) messages(items []prompb.TimeSeries) ([]*sarama.ProducerMessage, error) {
+	groups := make(map[string][]prompb.TimeSeries)
+	keys := make([]string, 0)
+	for i := range items {
+		key := s.key(&items[i])
+		if _, has := groups[key]; !has {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], items[i])
+	}
+
+	msgs := make([]*sarama.ProducerMessage, 0, len(keys))
+	for _, key := range keys {
+		value, err := encodePayload(s.opts.Format, groups[key])
+		if err != nil {
+			return nil, err
+		}
+		msg := &sarama.ProducerMessage{
+			Topic: s.opts.Kafka.Topic,
+			Value: sarama.ByteEncoder(value),
+			// series of the message, retried if it fails
+			Metadata: groups[key],
+		}
+		if key != "" {
+			msg.Key = sarama.StringEncoder(key)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+func (s *kafkaSender) key(ts *prompb.TimeSeries) string {
+	switch s.opts.PartitionKey {
+	case PartitionKeyMetric:
+		return metricName(ts)
+	case PartitionKeyIdent:
+		var hostname string
+		for _, l := range ts.Labels {
+			switch l.Name {
+			case "ident":
+				return l.Value
+			case config.AgentHostnameLabelKey:
+				hostname = l.Value
+			}
+		}
+		return hostname
+	case PartitionKeySeries:
+		return fmt.Sprintf("%016x", seriesHash(ts, nil))
+	}
+	return ""
+}
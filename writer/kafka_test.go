@@ -0,0 +1,90 @@
+package writer
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/config"
+)
+
+func TestKafkaMessagesByPartitionKey(t *testing.T) {
+	s, err := newKafkaSender(config.WriterOption{
+		Kafka:        &config.KafkaConfig{Topic: "metrics", Brokers: []string{"127.0.0.1:9092"}},
+		Format:       FormatJSON,
+		PartitionKey: PartitionKeyMetric,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := append(makeSeries("cpu"), makeSeries("mem")...)
+	items = append(items, makeSeries("cpu")...)
+	msgs, err := s.messages(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(msgs))
+	}
+	if key, _ := msgs[0].Key.Encode(); string(key) != "cpu" {
+		t.Fatalf("expected key cpu, got %s", key)
+	}
+}
+
+func TestKafkaFailedSeries(t *testing.T) {
+	msgs := []*sarama.ProducerMessage{
+		{Metadata: makeSeries("cpu")},
+		{Metadata: makeSeries("mem")},
+	}
+	err := sarama.ProducerErrors{{Msg: msgs[1], Err: errors.New("leader not available")}}
+	failed := failedSeries(err, msgs)
+	if len(failed) != 1 || failed[0].Labels[0].Value != "mem" {
+		t.Fatalf("expected series of the failed message, got %v", failed)
+	}
+	if failedSeries(errors.New("closed"), msgs) != nil {
+		t.Fatal("expected all series failed")
+	}
+}
+
+type partialSender struct {
+	sent [][]prompb.TimeSeries
+}
+
+func (s *partialSender) Send(items []prompb.TimeSeries) error {
+	s.sent = append(s.sent, items)
+	if len(s.sent) == 1 {
+		return &writeError{err: errors.New("partial"), retryable: true, failed: items[1:]}
+	}
+	return nil
+}
+
+func (s *partialSender) Close() error { return nil }
+
+func TestWriterRetriesOnlyFailedSeries(t *testing.T) {
+	w := newTestWriter(t, "http://a")
+	sender := &partialSender{}
+	w.Sender = sender
+	if err := w.send(append(makeSeries("cpu"), makeSeries("mem")...)); err != nil {
+		t.Fatal(err)
+	}
+	if len(sender.sent) != 2 || len(sender.sent[1]) != 1 || sender.sent[1][0].Labels[0].Value != "mem" {
+		t.Fatalf("expected only mem retried, got %v", sender.sent)
+	}
+}
+
+func TestKafkaSendAfterClose(t *testing.T) {
+	s, err := newKafkaSender(config.WriterOption{
+		Kafka: &config.KafkaConfig{Topic: "metrics", Brokers: []string{"127.0.0.1:1"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Send(makeSeries("cpu")); err == nil || isRetryable(err) {
+		t.Fatalf("expected a permanent error after close, got %v", err)
+	}
+}
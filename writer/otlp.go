@@ -0,0 +1,502 @@
+package writer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/prompb"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	grpcgzip "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/stringx"
+)
+
+// otlp transport protocols
+const (
+	OtlpProtocolHTTP = "http"
+	OtlpProtocolGRPC = "grpc"
+)
+
+// resource attribute of the agent hostname, see otel semantic conventions
+const otlpHostNameKey = "host.name"
+
+// otlpSender exports series as otlp metrics
+type otlpSender struct {
+	opts   config.WriterOption
+	client *http.Client
+	conn   *grpc.ClientConn
+	grpc   pmetricotlp.GRPCClient
+	// start time of cumulative points per series
+	starts *otlpStarts
+	// native histograms with custom buckets, which have no exponential form
+	skipped atomic.Uint64
+}
+
+func newOtlpSender(opt config.WriterOption) (*otlpSender, error) {
+	if opt.Otlp.Protocol == "" {
+		opt.Otlp.Protocol = OtlpProtocolHTTP
+	}
+	switch opt.Otlp.Compression {
+	case "", "none", "gzip":
+	default:
+		return nil, fmt.Errorf("otlp writer: unsupported compression: %s", opt.Otlp.Compression)
+	}
+
+	if opt.UseTLS || strings.HasPrefix(opt.Url, "https") {
+		opt.UseTLS = true
+	}
+	tlsConfig, err := opt.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &otlpSender{opts: opt, starts: newOtlpStarts()}
+	switch opt.Otlp.Protocol {
+	case OtlpProtocolHTTP:
+		s.client = &http.Client{
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				DialContext: (&net.Dialer{
+					Timeout: time.Duration(opt.DialTimeout) * time.Millisecond,
+				}).DialContext,
+				ResponseHeaderTimeout: time.Duration(opt.Timeout) * time.Millisecond,
+				MaxIdleConnsPerHost:   opt.MaxIdleConnsPerHost,
+				TLSClientConfig:       tlsConfig,
+			},
+		}
+	case OtlpProtocolGRPC:
+		creds := insecure.NewCredentials()
+		if tlsConfig != nil {
+			creds = credentials.NewTLS(tlsConfig)
+		}
+		// grpc connects lazily, the url may carry a scheme for readability
+		target := opt.Url
+		for _, prefix := range []string{"grpc://", "http://", "https://"} {
+			target = strings.TrimPrefix(target, prefix)
+		}
+		s.conn, err = grpc.NewClient(target, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			return nil, fmt.Errorf("otlp writer: failed to create grpc client: %w", err)
+		}
+		s.grpc = pmetricotlp.NewGRPCClient(s.conn)
+	default:
+		return nil, fmt.Errorf("otlp writer: unsupported protocol: %s", opt.Otlp.Protocol)
+	}
+	return s, nil
+}
+
+func (s *otlpSender) Send(items []prompb.TimeSeries) error {
+	md, skipped := toOtlpMetrics(items, s.opts.Otlp.CounterSuffixes, s.starts)
+	s.skipped.Add(uint64(skipped))
+	req := pmetricotlp.NewExportRequestFromMetrics(md)
+	if s.grpc != nil {
+		return s.export(req)
+	}
+
+	data, err := req.MarshalProto()
+	if err != nil {
+		return err
+	}
+	return s.post(data)
+}
+
+func (s *otlpSender) gzip() bool {
+	return s.opts.Otlp.Compression == "gzip"
+}
+
+func (s *otlpSender) post(data []byte) error {
+	if s.gzip() {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		if _, err := gw.Write(data); err != nil {
+			return err
+		}
+		if err := gw.Close(); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	}
+
+	httpReq, err := http.NewRequest("POST", s.opts.Url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	httpReq.Header.Set("User-Agent", "categraf")
+	if s.gzip() {
+		httpReq.Header.Set("Content-Encoding", "gzip")
+	}
+
+	for i := 0; i < len(s.opts.Headers); i += 2 {
+		httpReq.Header.Add(s.opts.Headers[i], s.opts.Headers[i+1])
+		if s.opts.Headers[i] == "Host" {
+			httpReq.Host = s.opts.Headers[i+1]
+		}
+	}
+
+	if s.opts.BasicAuthUser != "" {
+		httpReq.SetBasicAuth(s.opts.BasicAuthUser, s.opts.BasicAuthPass)
+	}
+
+	resp, err := s.client.Do(httpReq)
+	if err != nil {
+		return &writeError{err: err, retryable: true}
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode >= 400 {
+		err = fmt.Errorf("push data with otlp request got status code: %v, response body: %s", resp.StatusCode, string(body))
+		return &writeError{
+			err:        err,
+			retryable:  resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500,
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	ret := pmetricotlp.NewExportResponse()
+	if err := ret.UnmarshalProto(body); err == nil {
+		logPartialSuccess(ret)
+	}
+	return nil
+}
+
+func (s *otlpSender) export(req pmetricotlp.ExportRequest) error {
+	ctx := context.Background()
+	if s.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(s.opts.Timeout)*time.Millisecond)
+		defer cancel()
+	}
+
+	md := metadata.MD{}
+	for i := 0; i < len(s.opts.Headers); i += 2 {
+		md.Append(strings.ToLower(s.opts.Headers[i]), s.opts.Headers[i+1])
+	}
+	if s.opts.BasicAuthUser != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte(s.opts.BasicAuthUser + ":" + s.opts.BasicAuthPass))
+		md.Set("authorization", "Basic "+auth)
+	}
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	var opts []grpc.CallOption
+	if s.gzip() {
+		opts = append(opts, grpc.UseCompressor(grpcgzip.Name))
+	}
+
+	ret, err := s.grpc.Export(ctx, req, opts...)
+	if err != nil {
+		switch status.Code(err) {
+		case codes.Canceled, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted,
+			codes.OutOfRange, codes.Unavailable, codes.DataLoss:
+			return &writeError{err: err, retryable: true}
+		}
+		return &writeError{err: err}
+	}
+	logPartialSuccess(ret)
+	return nil
+}
+
+func (s *otlpSender) skippedHistograms() uint64 {
+	return s.skipped.Load()
+}
+
+func (s *otlpSender) Close() error {
+	if s.conn != nil {
+		return s.conn.Close()
+	}
+	if s.client != nil {
+		s.client.CloseIdleConnections()
+	}
+	return nil
+}
+
+func logPartialSuccess(ret pmetricotlp.ExportResponse) {
+	ps := ret.PartialSuccess()
+	if ps.RejectedDataPoints() > 0 {
+		log.Println("W! otlp receiver rejected data points:", ps.RejectedDataPoints(), "message:", ps.ErrorMessage())
+	}
+}
+
+// toOtlpMetrics converts series into otlp metrics, global labels and agent_hostname
+// become resource attributes and the other labels become data point attributes.
+// remote write carries no metric type, so samples are exported as gauges unless
+// named with one of counterSuffixes, native histograms become exponential histograms.
+// metrics are keyed by name and type, it returns the number of skipped histograms.
+func toOtlpMetrics(items []prompb.TimeSeries, counterSuffixes []string, starts *otlpStarts) (pmetric.Metrics, int) {
+	md := pmetric.NewMetrics()
+
+	resourceKeys := config.Config.Global.Labels
+	scopes := make(map[string]pmetric.ScopeMetrics)
+	metrics := make(map[string]pmetric.Metric)
+	skipped := 0
+	now := time.Now()
+
+	for i := range items {
+		var (
+			name     string
+			resource = make([]prompb.Label, 0, len(resourceKeys)+1)
+			attrs    = make([]prompb.Label, 0, len(items[i].Labels))
+			hostname string
+		)
+		for _, l := range items[i].Labels {
+			switch {
+			case l.Name == model.MetricNameLabel:
+				name = l.Value
+			case l.Name == config.AgentHostnameLabelKey:
+				hostname = l.Value
+			default:
+				if _, has := resourceKeys[l.Name]; has {
+					resource = append(resource, l)
+				} else {
+					attrs = append(attrs, l)
+				}
+			}
+		}
+		if hostname == "" && !config.Config.Global.OmitHostname {
+			hostname = config.Config.GetHostname()
+		}
+		if hostname != "" {
+			resource = append(resource, prompb.Label{Name: otlpHostNameKey, Value: hostname})
+		}
+		sort.Slice(resource, func(a, b int) bool { return resource[a].Name < resource[b].Name })
+
+		var rkey strings.Builder
+		for _, l := range resource {
+			rkey.WriteString(l.Name)
+			rkey.WriteByte(0xff)
+			rkey.WriteString(l.Value)
+			rkey.WriteByte(0xff)
+		}
+
+		sm, has := scopes[rkey.String()]
+		if !has {
+			rm := md.ResourceMetrics().AppendEmpty()
+			for _, l := range resource {
+				rm.Resource().Attributes().PutStr(l.Name, l.Value)
+			}
+			sm = rm.ScopeMetrics().AppendEmpty()
+			sm.Scope().SetName("categraf")
+			sm.Scope().SetVersion(config.Version)
+			scopes[rkey.String()] = sm
+		}
+
+		metric := func(typ pmetric.MetricType) pmetric.Metric {
+			mkey := rkey.String() + name + "\xff" + typ.String()
+			if m, has := metrics[mkey]; has {
+				return m
+			}
+			m := sm.Metrics().AppendEmpty()
+			m.SetName(name)
+			switch typ {
+			case pmetric.MetricTypeExponentialHistogram:
+				m.SetEmptyExponentialHistogram().SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+			case pmetric.MetricTypeSum:
+				sum := m.SetEmptySum()
+				sum.SetIsMonotonic(true)
+				sum.SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+			default:
+				m.SetEmptyGauge()
+			}
+			metrics[mkey] = m
+			return m
+		}
+		hash := seriesHash(&items[i], nil)
+
+		if len(items[i].Histograms) > 0 {
+			points := metric(pmetric.MetricTypeExponentialHistogram).ExponentialHistogram().DataPoints()
+			for _, h := range items[i].Histograms {
+				dp := pmetric.NewExponentialHistogramDataPoint()
+				if !toOtlpHistogram(h, dp) {
+					skipped++
+					continue
+				}
+				for _, l := range attrs {
+					dp.Attributes().PutStr(l.Name, l.Value)
+				}
+				dp.SetStartTimestamp(starts.get(otlpStartKey{hash, pmetric.MetricTypeExponentialHistogram}, dp.Timestamp(), float64(dp.Count()), now))
+				dp.MoveTo(points.AppendEmpty())
+			}
+		}
+		if len(items[i].Samples) == 0 {
+			continue
+		}
+
+		typ := pmetric.MetricTypeGauge
+		if stringx.HasAnySuffix(name, counterSuffixes) {
+			typ = pmetric.MetricTypeSum
+		}
+		m := metric(typ)
+		var points pmetric.NumberDataPointSlice
+		if typ == pmetric.MetricTypeSum {
+			points = m.Sum().DataPoints()
+		} else {
+			points = m.Gauge().DataPoints()
+		}
+		for _, s := range items[i].Samples {
+			dp := points.AppendEmpty()
+			for _, l := range attrs {
+				dp.Attributes().PutStr(l.Name, l.Value)
+			}
+			dp.SetTimestamp(pcommon.Timestamp(s.Timestamp * int64(time.Millisecond)))
+			if typ == pmetric.MetricTypeSum {
+				dp.SetStartTimestamp(starts.get(otlpStartKey{hash, typ}, dp.Timestamp(), s.Value, now))
+			}
+			if math.IsNaN(s.Value) {
+				dp.SetFlags(pmetric.DefaultDataPointFlags.WithNoRecordedValue(true))
+				continue
+			}
+			dp.SetDoubleValue(s.Value)
+		}
+	}
+	return md, skipped
+}
+
+// otlpStartTTL is how long the start time of a series is kept since last seen
+const otlpStartTTL = time.Hour
+
+type otlpStartKey struct {
+	hash uint64
+	typ  pmetric.MetricType
+}
+
+type otlpStart struct {
+	start pcommon.Timestamp
+	// timestamp and value of the last point, a smaller value is a reset
+	last  pcommon.Timestamp
+	value float64
+	seen  time.Time
+}
+
+// otlpStarts tracks the start time of cumulative series, which is the first
+// point seen of a series and moves to the point before a reset
+type otlpStarts struct {
+	sync.Mutex
+	series map[otlpStartKey]*otlpStart
+	pruned time.Time
+}
+
+func newOtlpStarts() *otlpStarts {
+	return &otlpStarts{series: make(map[otlpStartKey]*otlpStart), pruned: time.Now()}
+}
+
+// get returns the start time of the point at ts with value v, NaN values
+// keep the start time
+func (st *otlpStarts) get(key otlpStartKey, ts pcommon.Timestamp, v float64, now time.Time) pcommon.Timestamp {
+	st.Lock()
+	defer st.Unlock()
+
+	if now.Sub(st.pruned) > otlpStartTTL {
+		for k, s := range st.series {
+			if now.Sub(s.seen) > otlpStartTTL {
+				delete(st.series, k)
+			}
+		}
+		st.pruned = now
+	}
+
+	s, has := st.series[key]
+	if !has {
+		if math.IsNaN(v) {
+			return ts
+		}
+		st.series[key] = &otlpStart{start: ts, last: ts, value: v, seen: now}
+		return ts
+	}
+	s.seen = now
+	if math.IsNaN(v) {
+		return s.start
+	}
+	if v < s.value && ts > s.last {
+		s.start = s.last
+	}
+	if ts > s.last {
+		s.last = ts
+	}
+	s.value = v
+	return s.start
+}
+
+// toOtlpHistogram converts a prometheus native histogram, histograms with custom
+// buckets have no exponential form and are not converted
+func toOtlpHistogram(h prompb.Histogram, dp pmetric.ExponentialHistogramDataPoint) bool {
+	if h.Schema < -4 || h.Schema > 8 {
+		return false
+	}
+	dp.SetTimestamp(pcommon.Timestamp(h.Timestamp * int64(time.Millisecond)))
+	dp.SetScale(h.Schema)
+	dp.SetSum(h.Sum)
+	dp.SetZeroThreshold(h.ZeroThreshold)
+	if h.IsFloatHistogram() {
+		dp.SetCount(uint64(math.Round(h.GetCountFloat())))
+		dp.SetZeroCount(uint64(math.Round(h.GetZeroCountFloat())))
+	} else {
+		dp.SetCount(h.GetCountInt())
+		dp.SetZeroCount(h.GetZeroCountInt())
+	}
+	if value.IsStaleNaN(h.Sum) {
+		dp.SetFlags(pmetric.DefaultDataPointFlags.WithNoRecordedValue(true))
+	}
+	setOtlpBuckets(dp.Positive(), h.PositiveSpans, h.PositiveDeltas, h.PositiveCounts)
+	setOtlpBuckets(dp.Negative(), h.NegativeSpans, h.NegativeDeltas, h.NegativeCounts)
+	return true
+}
+
+// setOtlpBuckets expands the sparse buckets of prometheus into contiguous otlp
+// buckets, bucket i of prometheus is (base^(i-1), base^i] which is i-1 in otlp
+func setOtlpBuckets(b pmetric.ExponentialHistogramDataPointBuckets, spans []prompb.BucketSpan, deltas []int64, counts []float64) {
+	if len(spans) == 0 {
+		return
+	}
+	var (
+		out []uint64
+		n   int
+		cur int64
+	)
+	for i, span := range spans {
+		if i > 0 {
+			for j := int32(0); j < span.Offset; j++ {
+				out = append(out, 0)
+			}
+		}
+		for j := uint32(0); j < span.Length; j++ {
+			switch {
+			case n < len(deltas):
+				cur += deltas[n]
+				out = append(out, uint64(cur))
+			case n < len(counts):
+				out = append(out, uint64(math.Round(counts[n])))
+			default:
+				out = append(out, 0)
+			}
+			n++
+		}
+	}
+	b.SetOffset(spans[0].Offset - 1)
+	b.BucketCounts().FromRaw(out)
+}
@@ -0,0 +1,193 @@
+package writer
+
+import (
+	"compress/gzip"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+
+	"flashcat.cloud/categraf/config"
+)
+
+func TestToOtlpMetrics(t *testing.T) {
+	config.Config = &config.ConfigType{
+		Global: config.Global{Labels: map[string]string{"region": "bj"}, OmitHostname: true},
+	}
+	series := func(name, ident string) prompb.TimeSeries {
+		return prompb.TimeSeries{
+			Labels: []prompb.Label{
+				{Name: "__name__", Value: name},
+				{Name: "region", Value: "bj"},
+				{Name: "agent_hostname", Value: ident},
+				{Name: "cpu", Value: "cpu0"},
+			},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1000}},
+		}
+	}
+
+	md, _ := toOtlpMetrics([]prompb.TimeSeries{
+		series("cpu_usage", "a"), series("http_requests_total", "a"), series("cpu_usage", "b"),
+	}, []string{"_total"}, newOtlpStarts())
+	if md.ResourceMetrics().Len() != 2 {
+		t.Fatalf("expected 2 resources, got %d", md.ResourceMetrics().Len())
+	}
+
+	rm := md.ResourceMetrics().At(0)
+	if v, _ := rm.Resource().Attributes().Get("host.name"); v.Str() != "a" {
+		t.Fatalf("expected host.name a, got %s", v.Str())
+	}
+	if v, _ := rm.Resource().Attributes().Get("region"); v.Str() != "bj" {
+		t.Fatalf("expected region bj, got %s", v.Str())
+	}
+
+	ms := rm.ScopeMetrics().At(0).Metrics()
+	if ms.Len() != 2 || ms.At(0).Type() != pmetric.MetricTypeGauge || ms.At(1).Type() != pmetric.MetricTypeSum {
+		t.Fatalf("unexpected metrics of resource a")
+	}
+	if ms.At(1).Sum().DataPoints().At(0).StartTimestamp().AsTime().UnixMilli() != 1000 {
+		t.Fatal("expected start timestamp of the first point of cumulative sum")
+	}
+	dp := ms.At(0).Gauge().DataPoints().At(0)
+	if _, has := dp.Attributes().Get("region"); has || dp.Attributes().Len() != 1 {
+		t.Fatalf("unexpected data point attributes: %v", dp.Attributes().AsRaw())
+	}
+	if dp.Timestamp().AsTime().UnixMilli() != 1000 || dp.DoubleValue() != 1 {
+		t.Fatalf("unexpected data point: %v %v", dp.Timestamp(), dp.DoubleValue())
+	}
+}
+
+func TestToOtlpMetricsGaugeByDefault(t *testing.T) {
+	config.Config = &config.ConfigType{Global: config.Global{OmitHostname: true}}
+	md, _ := toOtlpMetrics(makeSeries("mysql_threads_count"), nil, newOtlpStarts())
+	m := md.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics().At(0)
+	if m.Type() != pmetric.MetricTypeGauge {
+		t.Fatalf("expected gauge, got %s", m.Type())
+	}
+}
+
+func TestToOtlpExponentialHistogram(t *testing.T) {
+	config.Config = &config.ConfigType{Global: config.Global{OmitHostname: true}}
+	md, _ := toOtlpMetrics([]prompb.TimeSeries{{
+		Labels: []prompb.Label{{Name: "__name__", Value: "rpc_latency_seconds"}},
+		Histograms: []prompb.Histogram{{
+			Count:         &prompb.Histogram_CountInt{CountInt: 6},
+			ZeroCount:     &prompb.Histogram_ZeroCountInt{ZeroCountInt: 1},
+			Sum:           3.5,
+			Schema:        0,
+			ZeroThreshold: 0.001,
+			// buckets 1, 2 and 4: (0.5, 1], (1, 2] and (4, 8]
+			PositiveSpans:  []prompb.BucketSpan{{Offset: 0, Length: 2}, {Offset: 1, Length: 1}},
+			PositiveDeltas: []int64{2, -1, 1},
+			Timestamp:      1000,
+		}},
+	}}, nil, newOtlpStarts())
+	m := md.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics().At(0)
+	if m.Type() != pmetric.MetricTypeExponentialHistogram {
+		t.Fatalf("expected exponential histogram, got %s", m.Type())
+	}
+	dp := m.ExponentialHistogram().DataPoints().At(0)
+	if dp.Count() != 6 || dp.ZeroCount() != 1 || dp.Sum() != 3.5 || dp.Scale() != 0 {
+		t.Fatalf("unexpected data point: %d %d %v %d", dp.Count(), dp.ZeroCount(), dp.Sum(), dp.Scale())
+	}
+	got := dp.Positive().BucketCounts().AsRaw()
+	if dp.Positive().Offset() != -1 || len(got) != 4 || got[0] != 2 || got[1] != 1 || got[2] != 0 || got[3] != 2 {
+		t.Fatalf("unexpected buckets: offset %d counts %v", dp.Positive().Offset(), got)
+	}
+}
+
+func TestToOtlpMetricsMixedShapes(t *testing.T) {
+	config.Config = &config.ConfigType{Global: config.Global{OmitHostname: true}}
+	name := []prompb.Label{{Name: "__name__", Value: "rpc_latency_seconds"}}
+	md, skipped := toOtlpMetrics([]prompb.TimeSeries{
+		{Labels: name, Samples: []prompb.Sample{{Value: 1, Timestamp: 1000}}},
+		{Labels: name, Histograms: []prompb.Histogram{
+			{Count: &prompb.Histogram_CountInt{CountInt: 1}, Timestamp: 1000},
+			// custom buckets have no exponential form
+			{Count: &prompb.Histogram_CountInt{CountInt: 1}, Schema: -53, Timestamp: 1000},
+		}},
+	}, nil, newOtlpStarts())
+	ms := md.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics()
+	if ms.Len() != 2 || ms.At(0).Type() != pmetric.MetricTypeGauge || ms.At(1).Type() != pmetric.MetricTypeExponentialHistogram {
+		t.Fatalf("expected a gauge and a histogram, got %d metrics", ms.Len())
+	}
+	if ms.At(1).ExponentialHistogram().DataPoints().Len() != 1 || skipped != 1 {
+		t.Fatalf("expected 1 histogram point and 1 skipped, got %d %d", ms.At(1).ExponentialHistogram().DataPoints().Len(), skipped)
+	}
+}
+
+func TestOtlpStartsReset(t *testing.T) {
+	starts := newOtlpStarts()
+	key := otlpStartKey{hash: 1, typ: pmetric.MetricTypeSum}
+	now := time.Now()
+	for _, p := range []struct {
+		ts, want pcommon.Timestamp
+		v        float64
+	}{
+		{ts: 1000, v: 5, want: 1000},
+		{ts: 2000, v: 8, want: 1000},
+		{ts: 3000, v: math.NaN(), want: 1000},
+		// reset between 2000 and 4000
+		{ts: 4000, v: 2, want: 2000},
+		{ts: 5000, v: 3, want: 2000},
+	} {
+		if got := starts.get(key, p.ts, p.v, now); got != p.want {
+			t.Fatalf("expected start %d of point %d, got %d", p.want, p.ts, got)
+		}
+	}
+
+	starts.get(otlpStartKey{hash: 2, typ: pmetric.MetricTypeSum}, 1000, 1, now.Add(otlpStartTTL/2))
+	starts.get(key, 6000, 4, now.Add(otlpStartTTL+time.Minute))
+	if len(starts.series) != 2 {
+		t.Fatalf("expected series seen within ttl kept, got %d", len(starts.series))
+	}
+	starts.get(key, 7000, 5, now.Add(3*otlpStartTTL))
+	if len(starts.series) != 1 {
+		t.Fatalf("expected stale series pruned, got %d", len(starts.series))
+	}
+}
+
+func TestOtlpSenderHTTPGzip(t *testing.T) {
+	config.Config = &config.ConfigType{Global: config.Global{OmitHostname: true}}
+	var got pmetricotlp.ExportRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "gzip" || r.Header.Get("Authorization") == "" {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		gr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(gr)
+		got = pmetricotlp.NewExportRequest()
+		if err := got.UnmarshalProto(body); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}))
+	defer srv.Close()
+
+	s, err := newOtlpSender(config.WriterOption{
+		Url:           srv.URL,
+		BasicAuthUser: "categraf",
+		Otlp:          config.OtlpConfig{Compression: "gzip"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Send(makeSeries("cpu_usage")); err != nil {
+		t.Fatal(err)
+	}
+	if got.Metrics().DataPointCount() != 1 {
+		t.Fatalf("expected 1 data point, got %d", got.Metrics().DataPointCount())
+	}
+}
@@ -0,0 +1,134 @@
+package writer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/api"
+	"github.com/prometheus/prometheus/prompb"
+
+	"flashcat.cloud/categraf/config"
+)
+
+// writer types
+const (
+	TypeRemoteWrite = "remote_write"
+	TypeKafka       = "kafka"
+	TypeOtlp        = "otlp"
+)
+
+// remoteWriteSender posts series with prometheus remote write protocol
+type remoteWriteSender struct {
+	opts   config.WriterOption
+	client api.Client
+}
+
+func newRemoteWriteSender(opt config.WriterOption) (*remoteWriteSender, error) {
+	tr := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout: time.Duration(opt.DialTimeout) * time.Millisecond,
+		}).DialContext,
+		ResponseHeaderTimeout: time.Duration(opt.Timeout) * time.Millisecond,
+		MaxIdleConnsPerHost:   opt.MaxIdleConnsPerHost,
+	}
+	if opt.UseTLS || strings.HasPrefix(opt.Url, "https") {
+		opt.UseTLS = true
+		tlsConfig, err := opt.TLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		tr.TLSClientConfig = tlsConfig
+	}
+	cli, err := api.NewClient(api.Config{
+		Address:      opt.Url,
+		RoundTripper: tr,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &remoteWriteSender{
+		opts:   opt,
+		client: cli,
+	}, nil
+}
+
+func (s *remoteWriteSender) Send(items []prompb.TimeSeries) error {
+	req := &prompb.WriteRequest{
+		Timeseries: items,
+	}
+
+	data, err := proto.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	return s.post(snappy.Encode(nil, data))
+}
+
+func (s *remoteWriteSender) post(req []byte) error {
+	httpReq, err := http.NewRequest("POST", s.opts.Url, bytes.NewReader(req))
+	if err != nil {
+		return err
+	}
+
+	httpReq.Header.Add("Content-Encoding", "snappy")
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	httpReq.Header.Set("User-Agent", "categraf")
+	httpReq.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	for i := 0; i < len(s.opts.Headers); i += 2 {
+		httpReq.Header.Add(s.opts.Headers[i], s.opts.Headers[i+1])
+		if s.opts.Headers[i] == "Host" {
+			httpReq.Host = s.opts.Headers[i+1]
+		}
+	}
+
+	if s.opts.BasicAuthUser != "" {
+		httpReq.SetBasicAuth(s.opts.BasicAuthUser, s.opts.BasicAuthPass)
+	}
+
+	resp, body, err := s.client.Do(context.Background(), httpReq)
+	if err != nil {
+		return &writeError{err: fmt.Errorf("%w, response body: %s", err, string(body)), retryable: true}
+	}
+
+	if resp.StatusCode >= 400 {
+		err = fmt.Errorf("push data with remote write request got status code: %v, response body: %s", resp.StatusCode, string(body))
+		return &writeError{
+			err:        err,
+			retryable:  resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500,
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	return nil
+}
+
+func (s *remoteWriteSender) Close() error {
+	return nil
+}
+
+// parseRetryAfter parses Retry-After header in delay-seconds or http-date format
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
@@ -0,0 +1,152 @@
+package writer
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// routing modes of multiple writers
+const (
+	ModeBroadcast  = "broadcast"
+	ModeRoundRobin = "round_robin"
+	ModeFailover   = "failover"
+	ModeHash       = "hash"
+)
+
+// virtual nodes of every writer in the hash ring
+const ringReplicas = 128
+
+func validMode(mode string) error {
+	switch mode {
+	case ModeBroadcast, ModeRoundRobin, ModeFailover, ModeHash:
+		return nil
+	}
+	return fmt.Errorf("unsupported writer mode: %s", mode)
+}
+
+// route puts series into the queue of writers according to the mode
+func (ws *Writers) route(items []prompb.TimeSeries) {
+	if len(ws.list) == 0 {
+		return
+	}
+
+	switch ws.mode {
+	case ModeRoundRobin:
+		start := int((ws.rr.Add(1) - 1) % uint64(len(ws.list)))
+		ws.healthy(start).Enqueue(items)
+	case ModeFailover:
+		ws.healthy(0).Enqueue(items)
+	case ModeHash:
+		shards := make(map[*Writer][]prompb.TimeSeries, len(ws.list))
+		for i := range items {
+			w := ws.ring.get(seriesHash(&items[i], ws.hashLabels))
+			shards[w] = append(shards[w], items[i])
+		}
+		for w, shard := range shards {
+			w.Enqueue(shard)
+		}
+	default:
+		for _, w := range ws.list {
+			w.Enqueue(items)
+		}
+	}
+}
+
+// healthy returns the first writer whose circuit breaker is not open, starting
+// from index start in config order, the writer at start is returned if all are down
+func (ws *Writers) healthy(start int) *Writer {
+	for i := 0; i < len(ws.list); i++ {
+		w := ws.list[(start+i)%len(ws.list)]
+		if !w.breaker.Open() {
+			return w
+		}
+	}
+	return ws.list[start]
+}
+
+// handoff enqueues a batch failed on a writer to the next healthy writer in
+// config order, it reports false if there is none
+func (ws *Writers) handoff(from *Writer, items []prompb.TimeSeries) bool {
+	idx := 0
+	for i, w := range ws.list {
+		if w == from {
+			idx = i
+			break
+		}
+	}
+	for i := 1; i < len(ws.list); i++ {
+		w := ws.list[(idx+i)%len(ws.list)]
+		if !w.breaker.Open() {
+			w.Enqueue(items)
+			return true
+		}
+	}
+	return false
+}
+
+// seriesHash hashes the given labels of a series, or all labels if none given
+func seriesHash(ts *prompb.TimeSeries, names []string) uint64 {
+	h := fnv.New64a()
+	if len(names) == 0 {
+		labels := ts.Labels
+		if !sort.SliceIsSorted(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name }) {
+			labels = append([]prompb.Label(nil), labels...)
+			sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+		}
+		for _, l := range labels {
+			h.Write([]byte(l.Name))
+			h.Write([]byte{0xff})
+			h.Write([]byte(l.Value))
+			h.Write([]byte{0xff})
+		}
+		return h.Sum64()
+	}
+
+	for _, name := range names {
+		for _, l := range ts.Labels {
+			if l.Name == name {
+				h.Write([]byte(l.Value))
+				break
+			}
+		}
+		h.Write([]byte{0xff})
+	}
+	return h.Sum64()
+}
+
+// hashRing is a consistent hash ring, so adding or removing a writer
+// only moves the series of its neighbours
+type hashRing struct {
+	hashes []uint64
+	nodes  map[uint64]*Writer
+}
+
+func newHashRing(list []*Writer) *hashRing {
+	r := &hashRing{
+		hashes: make([]uint64, 0, len(list)*ringReplicas),
+		nodes:  make(map[uint64]*Writer, len(list)*ringReplicas),
+	}
+	for _, w := range list {
+		for i := 0; i < ringReplicas; i++ {
+			h := fnv.New64a()
+			h.Write([]byte(w.Opts.Url + "#" + strconv.Itoa(i)))
+			sum := h.Sum64()
+			r.hashes = append(r.hashes, sum)
+			r.nodes[sum] = w
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+	return r
+}
+
+func (r *hashRing) get(key uint64) *Writer {
+	idx := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= key })
+	if idx == len(r.hashes) {
+		idx = 0
+	}
+	return r.nodes[r.hashes[idx]]
+}
@@ -0,0 +1,135 @@
+package writer
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+func newTestWriters(t *testing.T, mode string, urls ...string) *Writers {
+	t.Helper()
+	ws := &Writers{mode: mode, hashLabels: []string{"ident"}}
+	for _, url := range urls {
+		w := newTestWriter(t, url)
+		ws.list = append(ws.list, w)
+		if mode == ModeFailover {
+			w.handoff = ws.handoff
+		}
+	}
+	ws.ring = newHashRing(ws.list)
+	return ws
+}
+
+func TestRouteFailover(t *testing.T) {
+	ws := newTestWriters(t, ModeFailover, "http://a", "http://b")
+
+	ws.route(makeSeries("a"))
+	if ws.list[0].queue.Len() != 1 || ws.list[1].queue.Len() != 0 {
+		t.Fatal("expected batch routed to the first writer")
+	}
+
+	ws.list[0].breaker.Failure()
+	ws.route(makeSeries("b"))
+	if ws.list[0].queue.Len() != 1 || ws.list[1].queue.Len() != 1 {
+		t.Fatal("expected batch routed to the second writer")
+	}
+}
+
+func TestFailoverHandoff(t *testing.T) {
+	var calls atomic.Int32
+	bad := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer bad.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		rw.WriteHeader(http.StatusNoContent)
+	}))
+	defer good.Close()
+
+	ws := newTestWriters(t, ModeFailover, bad.URL, good.URL)
+	// the breaker of the first writer stays closed after a failure
+	ws.list[0].breaker = newCircuitBreaker(100, time.Hour)
+
+	ws.route(makeSeries("a"))
+	ws.route(makeSeries("b"))
+	ws.list[0].writeOnce()
+	if ws.list[0].queue.Len() != 0 || ws.list[1].queue.Len() != 2 {
+		t.Fatalf("expected failed and queued batches handed off, got %d and %d",
+			ws.list[0].queue.Len(), ws.list[1].queue.Len())
+	}
+	for ws.list[1].writeOnce() {
+	}
+	if calls.Load() != 2 || ws.list[0].dropped.Load() != 0 {
+		t.Fatalf("expected 2 batches written by the second writer, got %d", calls.Load())
+	}
+}
+
+func TestRouteRoundRobinWraps(t *testing.T) {
+	ws := newTestWriters(t, ModeRoundRobin, "http://a", "http://b", "http://c")
+	ws.rr.Store(math.MaxUint64)
+	// must not panic with a negative index
+	ws.route(makeSeries("a"))
+	ws.route(makeSeries("a"))
+}
+
+func TestRouteRoundRobin(t *testing.T) {
+	ws := newTestWriters(t, ModeRoundRobin, "http://a", "http://b", "http://c")
+	for i := 0; i < 6; i++ {
+		ws.route(makeSeries("a"))
+	}
+	for _, w := range ws.list {
+		if w.queue.Len() != 2 {
+			t.Fatalf("expected 2 batches in %s, got %d", w.Opts.Url, w.queue.Len())
+		}
+	}
+}
+
+func TestRouteHashIsStable(t *testing.T) {
+	ws := newTestWriters(t, ModeHash, "http://a", "http://b", "http://c")
+
+	series := func(ident, name string) prompb.TimeSeries {
+		return prompb.TimeSeries{
+			Labels: []prompb.Label{
+				{Name: "__name__", Value: name},
+				{Name: "ident", Value: ident},
+			},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: time.Now().UnixMilli()}},
+		}
+	}
+
+	for i := 0; i < 20; i++ {
+		ident := "host-" + string(rune('a'+i))
+		ws.route([]prompb.TimeSeries{series(ident, "cpu"), series(ident, "mem")})
+	}
+
+	total := 0
+	for _, w := range ws.list {
+		for _, batch := range w.queue.PopBackAll() {
+			total += len(batch)
+			for _, ts := range batch {
+				if ws.ring.get(seriesHash(&ts, ws.hashLabels)) != w {
+					t.Fatalf("series %v routed to wrong writer %s", ts.Labels, w.Opts.Url)
+				}
+			}
+			// series of the same ident always land on the same writer
+			if len(batch) != 2 {
+				t.Fatalf("expected cpu and mem of an ident in one batch, got %d", len(batch))
+			}
+		}
+	}
+	if total != 40 {
+		t.Fatalf("expected 40 series, got %d", total)
+	}
+}
+
+func TestValidMode(t *testing.T) {
+	if err := validMode("random"); err == nil {
+		t.Fatal("expected error for unsupported mode")
+	}
+}
@@ -1,115 +1,399 @@
 package writer
 
 import (
-	"bytes"
-	"context"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"log"
-	"net"
-	"net/http"
-	"strings"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/golang/protobuf/proto"
-	"github.com/golang/snappy"
-	"github.com/prometheus/client_golang/api"
 	"github.com/prometheus/prometheus/prompb"
 
 	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/backoff"
+	"flashcat.cloud/categraf/types"
 )
 
+// Sender delivers a batch of series to a backend, errors are retried
+// only if they are writeError with retryable set
+type Sender interface {
+	Send(items []prompb.TimeSeries) error
+	// Close releases connections of the backend
+	Close() error
+}
+
 type Writer struct {
 	Opts   config.WriterOption
-	Client api.Client
+	Sender Sender
+
+	// every writer has its own queue, so a dead endpoint never blocks the others
+	queue   *types.SafeListLimited[[]prompb.TimeSeries]
+	buffer  *diskBuffer
+	breaker *circuitBreaker
+	backoff backoff.Policy
+	// filter is nil if no filter is configured
+	filter *seriesFilter
+	// handoff passes a failed batch to another writer, nil if not failover mode
+	handoff func(from *Writer, items []prompb.TimeSeries) bool
+
+	// stop ends LoopWrite, which closes done after the queue is flushed
+	stop chan struct{}
+	done chan struct{}
+	// closed rejects batches once the writer is closing
+	closed    bool
+	closeLock sync.RWMutex
+
+	retries atomic.Uint64
+	failed  atomic.Uint64
+	dropped atomic.Uint64
+	// native histograms skipped because the format cannot encode them
+	skippedHistograms atomic.Uint64
+}
+
+// histogramSender is implemented by senders which may not encode native histograms
+type histogramSender interface {
+	histograms() bool
+}
+
+// skippedSender is implemented by senders which skip native histograms they cannot encode
+type skippedSender interface {
+	skippedHistograms() uint64
+}
+
+// writeError is returned by post, retryable is true for network errors, 429 and 5xx
+type writeError struct {
+	err        error
+	retryable  bool
+	retryAfter time.Duration
+	// failed is the series not delivered of a partially failed batch, nil means all
+	failed []prompb.TimeSeries
+}
+
+func (e *writeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *writeError) Unwrap() error {
+	return e.err
+}
+
+func isRetryable(err error) bool {
+	var we *writeError
+	return errors.As(err, &we) && we.retryable
+}
+
+// undelivered returns the series of items not delivered because of err
+func undelivered(err error, items []prompb.TimeSeries) []prompb.TimeSeries {
+	var we *writeError
+	if errors.As(err, &we) && we.failed != nil {
+		return we.failed
+	}
+	return items
 }
 
 // newWriter creates a new Writer from config.WriterOption
-func newWriter(opt config.WriterOption) (Writer, error) {
-	tr := &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		DialContext: (&net.Dialer{
-			Timeout: time.Duration(opt.DialTimeout) * time.Millisecond,
-		}).DialContext,
-		ResponseHeaderTimeout: time.Duration(opt.Timeout) * time.Millisecond,
-		MaxIdleConnsPerHost:   opt.MaxIdleConnsPerHost,
-	}
-	if opt.UseTLS || strings.HasPrefix(opt.Url, "https") {
-		opt.UseTLS = true
-		tlsConfig, err := opt.TLSConfig()
-		if err != nil {
-			return Writer{}, err
-		}
-		tr.TLSClientConfig = tlsConfig
+func newWriter(opt config.WriterOption) (*Writer, error) {
+	if opt.QueueSize <= 0 {
+		opt.QueueSize = config.Config.WriterOpt.ChanSize/config.Config.WriterOpt.Batch + 1
+	}
+	if opt.MaxRetries <= 0 {
+		opt.MaxRetries = 3
+	}
+	if opt.RetryBackoffBase <= 0 {
+		opt.RetryBackoffBase = config.Duration(500 * time.Millisecond)
+	}
+	if opt.RetryBackoffMax <= 0 {
+		opt.RetryBackoffMax = config.Duration(30 * time.Second)
+	}
+	if opt.CircuitBreakerThreshold <= 0 {
+		opt.CircuitBreakerThreshold = 5
+	}
+	if opt.CircuitBreakerCooldown <= 0 {
+		opt.CircuitBreakerCooldown = config.Duration(30 * time.Second)
+	}
+
+	sender, err := newSender(opt)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Writer{
+		Opts:    opt,
+		Sender:  sender,
+		queue:   types.NewSafeListLimited[[]prompb.TimeSeries](opt.QueueSize),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		breaker: newCircuitBreaker(opt.CircuitBreakerThreshold, time.Duration(opt.CircuitBreakerCooldown)),
+		backoff: backoff.NewPolicy(2,
+			time.Duration(opt.RetryBackoffBase).Seconds(),
+			time.Duration(opt.RetryBackoffMax).Seconds(), 1, false),
 	}
-	cli, err := api.NewClient(api.Config{
-		Address:      opt.Url,
-		RoundTripper: tr,
-	})
 
+	w.filter, err = newSeriesFilter(opt)
 	if err != nil {
-		return Writer{}, err
+		return nil, fmt.Errorf("writer %s: %v", opt.Url, err)
+	}
+
+	if bopt := config.Config.WriterOpt.DiskBuffer; bopt.Enable {
+		h := fnv.New64a()
+		h.Write([]byte(opt.Url))
+		dir := filepath.Join(bopt.Path, fmt.Sprintf("%016x", h.Sum64()))
+		w.buffer, err = newDiskBuffer(dir, bopt.MaxSize*1024*1024, bopt.SegmentSize*1024*1024, time.Duration(bopt.MaxAge))
+		if err != nil {
+			return nil, err
+		}
+		log.Println("I! writer", opt.Url, "disk buffer enabled, path:", dir)
 	}
 
-	return Writer{
-		Opts:   opt,
-		Client: cli,
-	}, nil
+	return w, nil
+}
+
+func newSender(opt config.WriterOption) (Sender, error) {
+	switch opt.Type {
+	case "", TypeRemoteWrite:
+		return newRemoteWriteSender(opt)
+	case TypeKafka:
+		return newKafkaSender(opt)
+	case TypeOtlp:
+		return newOtlpSender(opt)
+	}
+	return nil, fmt.Errorf("unsupported writer type: %s", opt.Type)
 }
 
-func (w Writer) Write(items []prompb.TimeSeries) {
+// Enqueue filters a batch and puts it into the writer queue, the batch is
+// spilled to disk buffer if the queue is full or the endpoint is unavailable
+func (w *Writer) Enqueue(items []prompb.TimeSeries) {
+	w.closeLock.RLock()
+	defer w.closeLock.RUnlock()
+	if w.closed {
+		w.drop(len(items), "writer is closed")
+		return
+	}
+	if w.filter != nil {
+		items = w.filter.apply(items)
+	}
+	if hs, ok := w.Sender.(histogramSender); ok && !hs.histograms() {
+		items = w.skipHistograms(items)
+	}
 	if len(items) == 0 {
 		return
 	}
+	// fresh batches go behind the buffered ones while the buffer is not drained
+	if w.buffer != nil && (w.breaker.Open() || !w.buffer.Empty()) && w.spill(items) {
+		return
+	}
+	if w.queue.PushFront(items) || w.spill(items) {
+		return
+	}
+	w.drop(len(items), fmt.Sprintf("queue is full, please increase queue size(%d)", w.Opts.QueueSize))
+}
+
+// skipHistograms removes native histograms of series, the skipped ones are counted
+func (w *Writer) skipHistograms(items []prompb.TimeSeries) []prompb.TimeSeries {
+	ret := items[:0:0]
+	for i := range items {
+		ts := items[i]
+		if len(ts.Histograms) > 0 {
+			w.skippedHistograms.Add(uint64(len(ts.Histograms)))
+			ts.Histograms = nil
+		}
+		if len(ts.Samples) > 0 {
+			ret = append(ret, ts)
+		}
+	}
+	return ret
+}
 
-	req := &prompb.WriteRequest{
-		Timeseries: items,
+func (w *Writer) drop(n int, reason string) {
+	w.dropped.Add(uint64(n))
+	log.Printf("E! writer %s: drop %d time series, %s", w.Opts.Url, n, reason)
+}
+
+func (w *Writer) LoopWrite() {
+	defer close(w.done)
+	for {
+		select {
+		case <-w.stop:
+			w.flush()
+			return
+		default:
+		}
+
+		if wait := w.breaker.Wait(); wait > 0 {
+			w.sleep(wait)
+			continue
+		}
+
+		if !w.writeOnce() {
+			w.sleep(time.Millisecond * 100)
+		}
 	}
+}
 
-	data, err := proto.Marshal(req)
-	if err != nil {
-		log.Println("W! marshal prom data to proto got error:", err, "data:", items)
-		return
+// sleep waits for d, it returns false if the writer is stopped meanwhile
+func (w *Writer) sleep(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-w.stop:
+		return false
 	}
+}
 
-	if err := w.post(snappy.Encode(nil, data)); err != nil {
-		log.Println("W! post to", w.Opts.Url, "got error:", err)
-		log.Println("W! example timeseries:", items[0].String())
+// flush persists the queued batches to disk buffer on shutdown, or sends them
+// once without retry if there is no disk buffer
+func (w *Writer) flush() {
+	for _, items := range w.queue.PopBackAll() {
+		if w.spill(items) {
+			continue
+		}
+		if w.breaker.Open() {
+			w.drop(len(items), "writer is closed while unavailable")
+			continue
+		}
+		if err := w.Sender.Send(items); err != nil {
+			w.drop(len(undelivered(err, items)), fmt.Sprint("writer is closed, last write error: ", err))
+		}
 	}
 }
 
-func (w Writer) post(req []byte) error {
-	httpReq, err := http.NewRequest("POST", w.Opts.Url, bytes.NewReader(req))
-	if err != nil {
-		log.Println("W! create remote write request got error:", err)
-		return err
+// writeOnce sends the oldest batch of disk buffer or queue, a failed batch is
+// spilled to the disk buffer of this writer only, so the other writers never
+// get it twice, it reports whether there was a batch to send
+func (w *Writer) writeOnce() bool {
+	if replayed, pending := w.replay(); replayed || pending {
+		// fresh batches wait until the buffer is replayed, so the order is kept
+		return true
 	}
 
-	httpReq.Header.Add("Content-Encoding", "snappy")
-	httpReq.Header.Set("Content-Type", "application/x-protobuf")
-	httpReq.Header.Set("User-Agent", "categraf")
-	httpReq.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	items := w.queue.PopBack()
+	if items == nil {
+		return false
+	}
 
-	for i := 0; i < len(w.Opts.Headers); i += 2 {
-		httpReq.Header.Add(w.Opts.Headers[i], w.Opts.Headers[i+1])
-		if w.Opts.Headers[i] == "Host" {
-			httpReq.Host = w.Opts.Headers[i+1]
+	err := w.send(*items)
+	if err == nil || !isRetryable(err) {
+		return true
+	}
+	failed := undelivered(err, *items)
+	if w.handoff != nil && w.handoff(w, failed) {
+		// the queued batches would fail as well
+		for _, queued := range w.queue.PopBackAll() {
+			if !w.handoff(w, queued) && !w.spill(queued) {
+				w.drop(len(queued), "no healthy writer to fail over")
+			}
+		}
+		return true
+	}
+	if w.buffer == nil {
+		w.drop(len(failed), "no disk buffer to retry later")
+		return true
+	}
+	if !w.spill(failed) {
+		w.drop(len(failed), "failed to write disk buffer")
+		return true
+	}
+	// the queued batches are newer than the failed one, keep them behind it
+	for _, queued := range w.queue.PopBackAll() {
+		if !w.spill(queued) {
+			w.drop(len(queued), "failed to write disk buffer")
 		}
 	}
+	return true
+}
 
-	if w.Opts.BasicAuthUser != "" {
-		httpReq.SetBasicAuth(w.Opts.BasicAuthUser, w.Opts.BasicAuthPass)
+// replay sends the oldest batch of disk buffer, it reports whether a batch was
+// consumed, and whether buffered batches are still pending after a failure
+func (w *Writer) replay() (bool, bool) {
+	if w.buffer == nil || w.buffer.Empty() {
+		return false, false
 	}
 
-	resp, body, err := w.Client.Do(context.Background(), httpReq)
-	if err != nil {
-		log.Println("W! push data with remote write request got error:", err, "response body:", string(body))
-		return err
+	items := w.buffer.Peek()
+	if len(items) == 0 {
+		return false, false
+	}
+
+	if err := w.send(items); err != nil && isRetryable(err) {
+		return false, true
+	}
+
+	w.buffer.Commit()
+	if config.Config.DebugMode {
+		log.Println("D! writer", w.Opts.Url, "replayed", len(items), "time series from disk buffer")
+	}
+	return true, false
+}
+
+// spill writes a batch to disk buffer, it reports whether the batch was saved
+func (w *Writer) spill(items []prompb.TimeSeries) bool {
+	if w.buffer == nil {
+		return false
+	}
+	if err := w.buffer.Append(items); err != nil {
+		log.Println("E! writer", w.Opts.Url, "write", len(items), "time series to disk buffer error:", err)
+		return false
+	}
+	return true
+}
+
+// send writes a batch with retries, permanent errors are not retried
+func (w *Writer) send(items []prompb.TimeSeries) error {
+	var numErrors int
+	for {
+		err := w.Write(items)
+		if err == nil {
+			if w.breaker.Success() {
+				log.Println("I! writer", w.Opts.Url, "recovered")
+			}
+			return nil
+		}
+
+		var we *writeError
+		if !errors.As(err, &we) || !we.retryable {
+			w.failed.Add(1)
+			w.drop(len(undelivered(err, items)), fmt.Sprint("permanent error: ", err))
+			return err
+		}
+		// only the series not delivered are retried
+		items = undelivered(err, items)
+		we.failed = items
+
+		numErrors++
+		if numErrors > w.Opts.MaxRetries {
+			w.failed.Add(1)
+			log.Println("W! writer", w.Opts.Url, "write", len(items), "time series failed after", w.Opts.MaxRetries, "retries, error:", err)
+			if config.Config.DebugMode {
+				log.Println("D! example timeseries:", items[0].String())
+			}
+			if w.breaker.Failure() {
+				log.Println("E! writer", w.Opts.Url, "circuit breaker opened, cooldown:", time.Duration(w.Opts.CircuitBreakerCooldown))
+			}
+			return err
+		}
+
+		delay := w.backoff.GetBackoffDuration(numErrors)
+		if we.retryAfter > delay {
+			// Retry-After of the server is bounded by retry_backoff_max
+			delay = min(we.retryAfter, time.Duration(w.Opts.RetryBackoffMax))
+		}
+		w.retries.Add(1)
+		if !w.sleep(delay) {
+			// closing, the batch is spilled or flushed by the caller
+			return err
+		}
 	}
+}
 
-	if resp.StatusCode >= 400 {
-		err = fmt.Errorf("push data with remote write request got status code: %v, response body: %s", resp.StatusCode, string(body))
-		return err
+func (w *Writer) Write(items []prompb.TimeSeries) error {
+	if len(items) == 0 {
+		return nil
 	}
 
-	return nil
+	return w.Sender.Send(items)
 }
@@ -0,0 +1,324 @@
+package writer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/storage/remote"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/types"
+)
+
+func newTestWriter(t *testing.T, url string) *Writer {
+	t.Helper()
+	config.Config = &config.ConfigType{
+		WriterOpt: config.WriterOpt{Batch: 1000, ChanSize: 1000000},
+	}
+	w, err := newWriter(config.WriterOption{
+		Url:                     url,
+		Timeout:                 1000,
+		DialTimeout:             1000,
+		MaxRetries:              2,
+		RetryBackoffBase:        config.Duration(time.Millisecond),
+		RetryBackoffMax:         config.Duration(2 * time.Millisecond),
+		CircuitBreakerThreshold: 1,
+		CircuitBreakerCooldown:  config.Duration(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestWriterRetryOnServerError(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	w := newTestWriter(t, srv.URL)
+	if err := w.send(makeSeries("a")); err != nil {
+		t.Fatalf("expected success after retries, got %v", err)
+	}
+	if calls.Load() != 3 || w.retries.Load() != 2 {
+		t.Fatalf("expected 3 calls and 2 retries, got %d calls and %d retries", calls.Load(), w.retries.Load())
+	}
+	if w.breaker.State() != breakerClosed {
+		t.Fatalf("expected closed breaker, got %s", w.breaker.State())
+	}
+}
+
+func TestWriterNoRetryOnClientError(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		rw.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	w := newTestWriter(t, srv.URL)
+	err := w.send(makeSeries("a"))
+	if err == nil || isRetryable(err) {
+		t.Fatalf("expected permanent error, got %v", err)
+	}
+	if calls.Load() != 1 || w.dropped.Load() != 1 {
+		t.Fatalf("expected 1 call and 1 dropped series, got %d calls and %d dropped", calls.Load(), w.dropped.Load())
+	}
+	if w.breaker.State() != breakerClosed {
+		t.Fatalf("expected closed breaker, got %s", w.breaker.State())
+	}
+}
+
+func TestWriterCircuitBreakerOpens(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Retry-After", "0")
+		rw.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	w := newTestWriter(t, srv.URL)
+	err := w.send(makeSeries("a"))
+	if !isRetryable(err) {
+		t.Fatalf("expected retryable error, got %v", err)
+	}
+	if !w.breaker.Open() || w.breaker.Wait() <= 0 {
+		t.Fatal("expected open breaker")
+	}
+}
+
+func TestWriterSpillPerWriter(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	var goodCalls atomic.Int32
+	bad := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	}))
+	defer bad.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		goodCalls.Add(1)
+		rw.WriteHeader(http.StatusNoContent)
+	}))
+	defer good.Close()
+
+	ws := newTestWriters(t, ModeBroadcast, bad.URL, good.URL)
+	dir := t.TempDir()
+	for _, w := range ws.list {
+		buffer, err := newDiskBuffer(filepath.Join(dir, w.Opts.Url[len("http://"):]), 1<<20, 1<<10, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.buffer = buffer
+		// the breaker stays closed, so the failed batch is replayed at once
+		w.Opts.CircuitBreakerThreshold = 100
+		w.breaker = newCircuitBreaker(100, time.Hour)
+	}
+
+	ws.route(makeSeries("a"))
+	for _, w := range ws.list {
+		w.writeOnce()
+	}
+	if ws.list[0].buffer.Empty() || !ws.list[1].buffer.Empty() {
+		t.Fatal("expected the batch spilled to the failing writer only")
+	}
+
+	failing.Store(false)
+	for _, w := range ws.list {
+		w.writeOnce()
+	}
+	if !ws.list[0].buffer.Empty() {
+		t.Fatal("expected the spilled batch replayed")
+	}
+	if goodCalls.Load() != 1 {
+		t.Fatalf("expected the healthy writer written once, got %d", goodCalls.Load())
+	}
+}
+
+func TestWriterKeepsOrderUntilReplayed(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		req, err := remote.DecodeWriteRequest(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		for _, ts := range req.Timeseries {
+			got = append(got, ts.Labels[0].Value)
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	w := newTestWriter(t, srv.URL)
+	w.breaker = newCircuitBreaker(100, time.Hour)
+	buffer, err := newDiskBuffer(t.TempDir(), 1<<20, 1<<10, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.buffer = buffer
+
+	w.Enqueue(makeSeries("a"))
+	w.Enqueue(makeSeries("b"))
+	// a fails and b is spilled behind it
+	w.writeOnce()
+	if w.queue.Len() != 0 || w.buffer.Empty() {
+		t.Fatal("expected the queue spilled to disk buffer")
+	}
+	w.Enqueue(makeSeries("c"))
+	// replay keeps failing, c is not sent ahead of a and b
+	w.writeOnce()
+	if len(got) != 0 {
+		t.Fatalf("expected nothing sent, got %v", got)
+	}
+
+	failing.Store(false)
+	for w.writeOnce() {
+	}
+	if strings.Join(got, ",") != "a,b,c" {
+		t.Fatalf("expected a,b,c in order, got %v", got)
+	}
+}
+
+func TestWriterDropWithoutDiskBuffer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	w := newTestWriter(t, srv.URL)
+	w.Enqueue(makeSeries("a"))
+	w.writeOnce()
+	if w.dropped.Load() != 1 {
+		t.Fatalf("expected 1 dropped series, got %d", w.dropped.Load())
+	}
+}
+
+func TestMigrateDiskBuffer(t *testing.T) {
+	dir := t.TempDir()
+	legacy, err := newDiskBuffer(dir, 1<<20, 1<<10, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy.Append(makeSeries("a"))
+	legacy.Append(makeSeries("b"))
+	legacy.Close()
+
+	ws := newTestWriters(t, ModeBroadcast, "http://a", "http://b")
+	ws.migrateDiskBuffer(config.DiskBuffer{Path: dir, MaxSize: 1, SegmentSize: 1, MaxAge: config.Duration(time.Hour)})
+	for _, w := range ws.list {
+		if w.queue.Len() != 2 {
+			t.Fatalf("expected 2 migrated batches in %s, got %d", w.Opts.Url, w.queue.Len())
+		}
+	}
+	if segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix)); len(segments) != 0 {
+		t.Fatalf("expected segments of old layout removed, got %v", segments)
+	}
+}
+
+func TestCloseWritersPersistsQueued(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	ws := newTestWriters(t, ModeBroadcast, srv.URL)
+	ws.queue = types.NewSafeListLimited[*prompb.TimeSeries](100)
+	ws.stop = make(chan struct{})
+	ws.readDone = make(chan struct{})
+	w := ws.list[0]
+	dir := t.TempDir()
+	buffer, err := newDiskBuffer(dir, 1<<20, 1<<10, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.buffer = buffer
+
+	old := writers
+	writers = ws
+	defer func() { writers = old }()
+
+	w.Enqueue(makeSeries("a"))
+	go w.LoopWrite()
+	go ws.LoopRead()
+	// a fails and the breaker opens for an hour
+	for i := 0; w.buffer.Empty(); i++ {
+		if i > 100 {
+			t.Fatal("expected the failed batch spilled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	b := makeSeries("b")
+	ws.queue.PushFront(&b[0])
+
+	CloseWriters()
+	w.Enqueue(makeSeries("c"))
+	if w.dropped.Load() != 1 {
+		t.Fatalf("expected the batch after close dropped, got %d", w.dropped.Load())
+	}
+
+	reopened, err := newDiskBuffer(dir, 1<<20, 1<<10, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	var got []string
+	for items := reopened.Peek(); len(items) > 0; items = reopened.Peek() {
+		got = append(got, items[0].Labels[0].Value)
+		reopened.Commit()
+	}
+	if strings.Join(got, ",") != "a,b" {
+		t.Fatalf("expected a,b persisted, got %v", got)
+	}
+}
+
+func TestWriterRetryAfterBounded(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Retry-After", "3600")
+		rw.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	w := newTestWriter(t, srv.URL)
+	start := time.Now()
+	if err := w.send(makeSeries("a")); err == nil {
+		t.Fatal("expected an error")
+	}
+	if took := time.Since(start); took > 5*time.Second {
+		t.Fatalf("expected Retry-After bounded by retry_backoff_max, took %v", took)
+	}
+	if w.retries.Load() != 2 {
+		t.Fatalf("expected 2 retries, got %d", w.retries.Load())
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if d := parseRetryAfter("3"); d != 3*time.Second {
+		t.Fatalf("expected 3s, got %s", d)
+	}
+	if d := parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)); d <= 0 || d > time.Minute {
+		t.Fatalf("expected about 1m, got %s", d)
+	}
+	if d := parseRetryAfter("soon"); d != 0 {
+		t.Fatalf("expected 0, got %s", d)
+	}
+}
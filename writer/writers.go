@@ -3,9 +3,12 @@ package writer
 import (
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/prometheus/prompb"
@@ -17,10 +20,21 @@ import (
 // Writers manage all writers and metric queue
 type (
 	Writers struct {
-		writerMap map[string]Writer
-		queue     *types.SafeListLimited[*prompb.TimeSeries]
+		writerMap map[string]*Writer
+		// writers in config order
+		list  []*Writer
+		queue *types.SafeListLimited[*prompb.TimeSeries]
 		sync.Mutex
 
+		mode       string
+		hashLabels []string
+		ring       *hashRing
+		rr         atomic.Uint64
+
+		// stop ends LoopRead, which closes readDone after the queue is routed
+		stop     chan struct{}
+		readDone chan struct{}
+
 		Snapshot
 	}
 
@@ -30,50 +44,160 @@ type (
 		TotalCount uint64
 
 		QueueSize uint64
+
+		DiskBufferSize      uint64
+		DiskBufferOldestAge float64
+	}
+
+	// WriterSnapshot is the state of a single writer
+	WriterSnapshot struct {
+		Url          string
+		QueueSize    uint64
+		BreakerState int
+		RetryTotal   uint64
+		FailTotal    uint64
+		DropTotal    uint64
+		// native histograms the format of the writer cannot encode
+		SkippedHistogramTotal uint64
+
+		DiskBufferSize      uint64
+		DiskBufferOldestAge float64
 	}
 )
 
 var writers *Writers
 
 func InitWriters() error {
-	writerMap := map[string]Writer{}
+	if err := validMode(config.Config.WriterOpt.Mode); err != nil {
+		return err
+	}
+
+	writerMap := map[string]*Writer{}
+	list := make([]*Writer, 0, len(config.Config.Writers))
 	opts := config.Config.Writers
 	for _, opt := range opts {
+		if opt.Url == "" && opt.Type == TypeKafka && opt.Kafka != nil {
+			opt.Url = kafkaWriterUrl(opt.Kafka)
+		}
+		if _, has := writerMap[opt.Url]; has {
+			log.Println("W! duplicate writer:", opt.Url)
+			continue
+		}
 		writer, err := newWriter(opt)
 		if err != nil {
 			return err
 		}
 		writerMap[opt.Url] = writer
+		list = append(list, writer)
 	}
 
 	writers = &Writers{
-		writerMap: writerMap,
-		queue:     types.NewSafeListLimited[*prompb.TimeSeries](config.Config.WriterOpt.ChanSize),
+		writerMap:  writerMap,
+		list:       list,
+		queue:      types.NewSafeListLimited[*prompb.TimeSeries](config.Config.WriterOpt.ChanSize),
+		mode:       config.Config.WriterOpt.Mode,
+		hashLabels: config.Config.WriterOpt.HashLabels,
+		ring:       newHashRing(list),
+		stop:       make(chan struct{}),
+		readDone:   make(chan struct{}),
+	}
+	if writers.mode == ModeFailover {
+		for _, w := range list {
+			w.handoff = writers.handoff
+		}
 	}
 
+	initExposer()
+
+	if bopt := config.Config.WriterOpt.DiskBuffer; bopt.Enable {
+		writers.migrateDiskBuffer(bopt)
+	}
+
+	for _, w := range list {
+		go w.LoopWrite()
+	}
 	go writers.LoopRead()
 	return nil
 }
 
 func (ws *Writers) LoopRead() {
+	defer close(ws.readDone)
+	stopping := false
 	for {
 		series := ws.queue.PopBackN(config.Config.WriterOpt.Batch)
 		if len(series) == 0 {
-			time.Sleep(time.Millisecond * 100)
+			// the queue is drained before exit
+			if stopping {
+				return
+			}
+			select {
+			case <-ws.stop:
+				stopping = true
+			case <-time.After(time.Millisecond * 100):
+			}
 			continue
 		}
 
-		items := make([]prompb.TimeSeries, len(series))
-		for i := 0; i < len(series); i++ {
-			items[i] = *series[i]
+		// exposed when written to the queue
+		ws.route(derefTimeSeries(series))
+	}
+}
+
+// migrateDiskBuffer moves batches of the shared disk buffer of earlier versions,
+// which spilled to <path> directly, into the buffers of writers under <path>/<hash of url>.
+// the writer a batch failed on is unknown, so every writer gets it as before
+func (ws *Writers) migrateDiskBuffer(bopt config.DiskBuffer) {
+	segments, err := filepath.Glob(filepath.Join(bopt.Path, "*"+segmentSuffix))
+	if err != nil || len(segments) == 0 {
+		return
+	}
+
+	legacy, err := newDiskBuffer(bopt.Path, bopt.MaxSize*1024*1024, bopt.SegmentSize*1024*1024, time.Duration(bopt.MaxAge))
+	if err != nil {
+		log.Println("E! failed to open disk buffer of old layout:", err)
+		return
+	}
+	count := 0
+	for {
+		items := legacy.Peek()
+		if len(items) == 0 {
+			break
 		}
+		for _, w := range ws.list {
+			// replayed by LoopWrite before any fresh batch
+			w.Enqueue(items)
+		}
+		legacy.Commit()
+		count += len(items)
+	}
+	legacy.Close()
+
+	for _, f := range append(segments, filepath.Join(bopt.Path, cursorFileName)) {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			log.Println("W! failed to remove disk buffer file of old layout:", err)
+		}
+	}
+	log.Println("I! migrated", count, "time series from disk buffer of old layout", bopt.Path)
+}
 
-		WriteTimeSeries(items)
+// spillable reports whether any writer has disk buffer
+func (ws *Writers) spillable() bool {
+	for _, w := range ws.list {
+		if w.buffer != nil {
+			return true
+		}
 	}
+	return false
 }
 
 // WriteSamples convert samples to []prompb.TimeSeries and batch write to queue
 func WriteSamples(samples []*types.Sample) {
+	WriteSamplesWithInterval(samples, 0)
+}
+
+// WriteSamplesWithInterval is WriteSamples of a source gathered every interval,
+// which decides when the series are stale on /metrics
+func WriteSamplesWithInterval(samples []*types.Sample, interval time.Duration) {
 	if len(samples) == 0 {
 		return
 	}
@@ -93,7 +217,15 @@ func WriteSamples(samples []*types.Sample) {
 		}
 		items = append(items, item)
 	}
+	if exposed != nil {
+		exposed.update(derefTimeSeries(items), interval, time.Now())
+	}
 	success := writers.queue.PushFrontN(items)
+	if !success && writers.spillable() {
+		// memory queue is full, hand over to writers so they can spill to disk
+		writers.route(derefTimeSeries(items))
+		success = true
+	}
 	l := writers.queue.Len()
 	if !success {
 		log.Printf("E! write %d samples failed, please increase queue size(%d)", len(items), l)
@@ -114,31 +246,96 @@ func snapshot(count, size uint64, success bool) {
 
 func QueueMetrics() *Snapshot {
 	writers.Lock()
-	defer writers.Unlock()
 	ss := writers.Snapshot
+	writers.Unlock()
+
+	for _, w := range writers.list {
+		if w.buffer == nil {
+			continue
+		}
+		ss.DiskBufferSize += uint64(w.buffer.Size())
+		if age := w.buffer.OldestAge().Seconds(); age > ss.DiskBufferOldestAge {
+			ss.DiskBufferOldestAge = age
+		}
+	}
 	return &ss
 }
 
-// WriteTimeSeries write prompb.TimeSeries to all writers
+// WriterMetrics returns the state of every writer
+func WriterMetrics() []WriterSnapshot {
+	ret := make([]WriterSnapshot, 0, len(writers.list))
+	for _, w := range writers.list {
+		ws := WriterSnapshot{
+			Url:          w.Opts.Url,
+			QueueSize:    uint64(w.queue.Len()),
+			BreakerState: int(w.breaker.State()),
+			RetryTotal:   w.retries.Load(),
+			FailTotal:    w.failed.Load(),
+			DropTotal:    w.dropped.Load(),
+
+			SkippedHistogramTotal: w.skippedHistograms.Load(),
+		}
+		if ss, ok := w.Sender.(skippedSender); ok {
+			ws.SkippedHistogramTotal += ss.skippedHistograms()
+		}
+		if w.buffer != nil {
+			ws.DiskBufferSize = uint64(w.buffer.Size())
+			ws.DiskBufferOldestAge = w.buffer.OldestAge().Seconds()
+		}
+		ret = append(ret, ws)
+	}
+	return ret
+}
+
+// CloseWriters routes the queued series to writers, waits for the writers to
+// flush their queues, then closes the senders and disk buffers on shutdown
+func CloseWriters() {
+	if writers == nil {
+		return
+	}
+	close(writers.stop)
+	<-writers.readDone
+
+	for _, w := range writers.list {
+		w.closeLock.Lock()
+		w.closed = true
+		w.closeLock.Unlock()
+	}
+	for _, w := range writers.list {
+		close(w.stop)
+	}
+	for _, w := range writers.list {
+		<-w.done
+		if err := w.Sender.Close(); err != nil {
+			log.Println("W! close writer", w.Opts.Url, "error:", err)
+		}
+		if w.buffer != nil {
+			if err := w.buffer.Close(); err != nil {
+				log.Println("W! close disk buffer of writer", w.Opts.Url, "error:", err)
+			}
+		}
+	}
+}
+
+func derefTimeSeries(series []*prompb.TimeSeries) []prompb.TimeSeries {
+	items := make([]prompb.TimeSeries, len(series))
+	for i := range series {
+		items[i] = *series[i]
+	}
+	return items
+}
+
+// WriteTimeSeries put prompb.TimeSeries into the queue of writers according
+// to writer_opt.mode, it never blocks on a slow writer
 func WriteTimeSeries(timeSeries []prompb.TimeSeries) {
 	if len(timeSeries) == 0 {
 		return
 	}
 
-	now := time.Now()
-	wg := sync.WaitGroup{}
-	for key := range writers.writerMap {
-		wg.Add(1)
-		go func(key string) {
-			defer wg.Done()
-			writers.writerMap[key].Write(timeSeries)
-		}(key)
-	}
-	wg.Wait()
-	if config.Config.DebugMode {
-		log.Println("D!, write", len(timeSeries), "time series to all writers, cost:",
-			time.Since(now).Milliseconds(), "ms")
+	if exposed != nil {
+		exposed.update(timeSeries, 0, time.Now())
 	}
+	writers.route(timeSeries)
 }
 
 func printTestMetrics(samples []*types.Sample) {
@@ -170,7 +367,15 @@ func printTestMetric(sample *types.Sample) {
 	}
 
 	sb.WriteString(" ")
-	sb.WriteString(fmt.Sprint(sample.Value))
+	if h := sample.Histogram; h != nil {
+		count := float64(h.GetCountInt())
+		if _, ok := h.Count.(*prompb.Histogram_CountFloat); ok {
+			count = h.GetCountFloat()
+		}
+		sb.WriteString(fmt.Sprintf("histogram{count=%v sum=%v schema=%d}", count, h.Sum, h.Schema))
+	} else {
+		sb.WriteString(fmt.Sprint(sample.Value))
+	}
 
 	fmt.Println(sb.String())
 }